@@ -2,23 +2,154 @@ package bundler
 
 import (
 	"context"
+	"io/fs"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
 	"time"
 
+	"github.com/miorlan/openapi-bundler/internal/domain"
+	"github.com/miorlan/openapi-bundler/internal/infrastructure/httpauth"
+	"github.com/miorlan/openapi-bundler/internal/infrastructure/httpcache"
 	"github.com/miorlan/openapi-bundler/internal/infrastructure/loader"
-	"github.com/miorlan/openapi-bundler/internal/infrastructure/parser"
-	"github.com/miorlan/openapi-bundler/internal/infrastructure/resolver"
 	"github.com/miorlan/openapi-bundler/internal/infrastructure/validator"
+	"github.com/miorlan/openapi-bundler/internal/infrastructure/vendored"
 	"github.com/miorlan/openapi-bundler/internal/infrastructure/writer"
 	"github.com/miorlan/openapi-bundler/internal/usecase"
 )
 
 type Option func(*Config)
 
+// fsScheme is the URI scheme BundleFS serves its FS under
+const fsScheme = "bundle-fs"
+
+// CircularRefPolicy defines how circular references are handled
+type CircularRefPolicy = domain.CircularRefPolicy
+
+const (
+	// CircularRefKeep keeps cycles as internal #/components/... refs
+	CircularRefKeep = domain.CircularRefKeep
+	// CircularRefError fails with an error listing the whole ref chain
+	CircularRefError = domain.CircularRefError
+)
+
+// ErrCircularReference is returned when a cycle is found and CircularRefError is set
+type ErrCircularReference = domain.ErrCircularReference
+
+// NameCollisionStrategy defines how components with the same name but different content are renamed
+type NameCollisionStrategy = domain.NameCollisionStrategy
+
+const (
+	// NameCollisionSuffix adds a numeric suffix: Error, Error2
+	NameCollisionSuffix = domain.NameCollisionSuffix
+	// NameCollisionPrefix prefixes the name with the source file or directory name: BillingError
+	NameCollisionPrefix = domain.NameCollisionPrefix
+	// NameCollisionFail fails with ErrComponentNameCollision
+	NameCollisionFail = domain.NameCollisionFail
+)
+
+// ErrComponentNameCollision is returned when NameCollisionFail is set and two components conflict
+type ErrComponentNameCollision = domain.ErrComponentNameCollision
+
+// ErrPathConflict is returned by Merge when several inputs define the same operation
+type ErrPathConflict = domain.ErrPathConflict
+
+// ErrNotVendored is returned in offline mode for a remote file the vendor directory
+// does not hold
+type ErrNotVendored = domain.ErrNotVendored
+
+// MergeInput is one of the specs combined by Merge: its path, the service name clashing
+// components are prefixed with and an optional path prefix like /billing
+type MergeInput = domain.MergeInput
+
+// DedupeMode defines how structurally equal schemas are detected for deduplication
+type DedupeMode = domain.DedupeMode
+
+const (
+	// DedupeOff disables deduplication
+	DedupeOff = domain.DedupeOff
+	// DedupeExact deduplicates schemas written identically, in the same key order
+	DedupeExact = domain.DedupeExact
+	// DedupeCanonical ignores mapping key order and compares scalars by their JSON value
+	DedupeCanonical = domain.DedupeCanonical
+)
+
+// RefSiblingPolicy defines what happens to keywords written next to a $ref
+type RefSiblingPolicy = domain.RefSiblingPolicy
+
+const (
+	// RefSiblingsAuto picks the policy from the document version
+	RefSiblingsAuto = domain.RefSiblingsAuto
+	// RefSiblingsMerge merges the siblings over the target
+	RefSiblingsMerge = domain.RefSiblingsMerge
+	// RefSiblingsAllOf wraps schema targets in allOf next to the siblings and merges the rest
+	RefSiblingsAllOf = domain.RefSiblingsAllOf
+	// RefSiblingsDrop removes the siblings and reports a warning
+	RefSiblingsDrop = domain.RefSiblingsDrop
+)
+
+// SplitNaming defines how files of a split document are named
+type SplitNaming = domain.SplitNaming
+
+const (
+	// SplitNamingOriginal keeps the component name: UserProfile.yaml
+	SplitNamingOriginal = domain.SplitNamingOriginal
+	// SplitNamingKebab uses kebab-case: user-profile.yaml
+	SplitNamingKebab = domain.SplitNamingKebab
+	// SplitNamingSnake uses snake_case: user_profile.yaml
+	SplitNamingSnake = domain.SplitNamingSnake
+)
+
+// OperationFilter selects the operations kept in the bundle by tag, operationId, path
+// glob and HTTP method. An operation is kept when it matches every include rule that is
+// set and no exclude rule.
+type OperationFilter = domain.OperationFilter
+
+// HostAuth holds the credentials sent to one host: headers, a bearer token or basic
+// auth. Secrets are named by environment variable and read when a request is made.
+type HostAuth = domain.HostAuth
+
+// AuthConfig configures the credentials of remote refs: per-host entries and .netrc
+type AuthConfig = domain.AuthConfig
+
+// SchemeHandler loads the documents of a URI scheme registered with WithSchemeHandler
+type SchemeHandler = domain.SchemeHandler
+
+// SchemeHandlerFunc adapts a function to a SchemeHandler
+type SchemeHandlerFunc = domain.SchemeHandlerFunc
+
+// Report describes changes made to the document while bundling
+type Report = domain.Report
+
+// ComponentRename describes a component renamed to resolve a name collision
+type ComponentRename = domain.ComponentRename
+
 type Config struct {
-	Validate    bool
-	MaxFileSize int64
-	MaxDepth    int
-	HTTPTimeout time.Duration
+	Validate             bool
+	MaxFileSize          int64
+	MaxDepth             int
+	HTTPTimeout          time.Duration
+	Concurrency          int
+	HTTPCache            bool
+	HTTPCacheDir         string
+	HTTPCacheTTL         time.Duration
+	OfflineDir           string
+	Auth                 AuthConfig
+	Schemes              map[string]SchemeHandler
+	Inline               bool
+	CircularRefs         CircularRefPolicy
+	NameCollisions       NameCollisionStrategy
+	Dedupe               DedupeMode
+	RefSiblings          RefSiblingPolicy
+	SplitNaming          SplitNaming
+	EmbedExamples        bool
+	EmbedExamplesMaxSize int64
+	RemoveUnused         bool
+	KeepComponents       []string
+	Operations           OperationFilter
+	MergeOverride        bool
+	Overlays             []string
 }
 
 func WithValidation(validate bool) Option {
@@ -45,18 +176,186 @@ func WithHTTPTimeout(timeout time.Duration) Option {
 	}
 }
 
+// WithConcurrency limits how many external files are loaded at the same time while
+// the ref graph is prefetched, and how many path items are resolved in parallel
+// (10 by default). The bundle does not depend on it.
+func WithConcurrency(n int) Option {
+	return func(c *Config) {
+		c.Concurrency = n
+	}
+}
+
+// WithHTTPCache keeps remote files on disk in dir between runs, the user cache
+// directory when dir is empty. Files cached less than ttl ago are used without a
+// request; older ones are revalidated with their ETag or Last-Modified date.
+func WithHTTPCache(dir string, ttl time.Duration) Option {
+	return func(c *Config) {
+		c.HTTPCache = true
+		c.HTTPCacheDir = dir
+		c.HTTPCacheTTL = ttl
+	}
+}
+
+// WithOffline serves remote refs from the vendor directory dir, written by Vendor,
+// instead of the network. A remote file missing from it fails with ErrNotVendored.
+func WithOffline(dir string) Option {
+	return func(c *Config) {
+		c.OfflineDir = dir
+	}
+}
+
+// WithAuth sends credentials with the requests for remote refs. Each host only gets
+// its own credentials, redirects to other hosts included. Hosts are matched in order.
+func WithAuth(config AuthConfig) Option {
+	return func(c *Config) {
+		c.Auth.Hosts = append(c.Auth.Hosts, config.Hosts...)
+		c.Auth.Netrc = c.Auth.Netrc || config.Netrc
+		if config.NetrcFile != "" {
+			c.Auth.NetrcFile = config.NetrcFile
+		}
+	}
+}
+
+// LoadAuthConfig reads an AuthConfig from a YAML or JSON file with a hosts list of
+// host, headers, tokenEnv, username and passwordEnv, and netrc/netrcFile settings
+func LoadAuthConfig(path string) (AuthConfig, error) {
+	return httpauth.LoadConfig(path)
+}
+
+// WithSchemeHandler loads refs and inputs with the given URI scheme, like s3:, through
+// handler. Relative refs of such documents resolve within their URI. The http, https
+// and data: schemes are built in and can be replaced.
+func WithSchemeHandler(scheme string, handler SchemeHandler) Option {
+	return func(c *Config) {
+		if c.Schemes == nil {
+			c.Schemes = make(map[string]SchemeHandler)
+		}
+		c.Schemes[scheme] = handler
+	}
+}
+
+// EnvSchemeHandler reads env:NAME refs from environment variables, registered with
+// WithSchemeHandler("env", EnvSchemeHandler()). Every document can then read the
+// environment, remote ones included, so only register it for trusted specs.
+func EnvSchemeHandler() SchemeHandler {
+	return loader.NewEnvHandler()
+}
+
+// WithFS serves a URI scheme from fsys, typically embed: from an embed.FS or fs: from
+// an fs.FS: embed:specs/openapi.yaml reads specs/openapi.yaml from fsys
+func WithFS(scheme string, fsys fs.FS) Option {
+	return WithSchemeHandler(scheme, loader.NewFSHandler(fsys))
+}
+
+// WithInline replaces every $ref with its content, like swagger-cli --dereference.
+// Recursive schemas keep an internal ref at the point where they recurse.
+func WithInline(inline bool) Option {
+	return func(c *Config) {
+		c.Inline = inline
+	}
+}
+
+// WithCircularRefs selects how circular references are handled
+func WithCircularRefs(policy CircularRefPolicy) Option {
+	return func(c *Config) {
+		c.CircularRefs = policy
+	}
+}
+
+// WithNameCollisions selects how conflicting component names are resolved
+func WithNameCollisions(strategy NameCollisionStrategy) Option {
+	return func(c *Config) {
+		c.NameCollisions = strategy
+	}
+}
+
+// WithDedupe selects how duplicate schemas are detected and replaced by refs
+func WithDedupe(mode DedupeMode) Option {
+	return func(c *Config) {
+		c.Dedupe = mode
+	}
+}
+
+// WithRefSiblings selects what happens to keywords written next to a $ref
+func WithRefSiblings(policy RefSiblingPolicy) Option {
+	return func(c *Config) {
+		c.RefSiblings = policy
+	}
+}
+
+// WithEmbedExamples loads externalValue example files into the bundle: JSON and YAML
+// become the example value, other files a string. Files larger than maxSize bytes are
+// copied to examples/ next to the output instead; 0 embeds all of them.
+func WithEmbedExamples(maxSize int64) Option {
+	return func(c *Config) {
+		c.EmbedExamples = true
+		c.EmbedExamplesMaxSize = maxSize
+	}
+}
+
+// WithRemoveUnused drops the components that no path, webhook, security requirement or
+// discriminator mapping reaches. Components marked with x-keep: true and those listed in
+// keep, as "Pet" or "schemas/Pet", are kept. Removed components are reported.
+func WithRemoveUnused(keep ...string) Option {
+	return func(c *Config) {
+		c.RemoveUnused = true
+		c.KeepComponents = keep
+	}
+}
+
+// WithOperationFilter keeps only the operations the filter selects. The bundle holds the
+// components and top-level tags those operations use; paths left empty are removed.
+func WithOperationFilter(filter OperationFilter) Option {
+	return func(c *Config) {
+		c.Operations = filter
+	}
+}
+
+// WithOverlays applies OpenAPI Overlay 1.0 documents, in order, to the resolved
+// document before it is written. Actions whose target matches nothing are reported
+// as warnings.
+func WithOverlays(paths ...string) Option {
+	return func(c *Config) {
+		c.Overlays = append(c.Overlays, paths...)
+	}
+}
+
+// WithMergeOverride makes Merge take an operation defined by several inputs from the
+// last one instead of failing with ErrPathConflict
+func WithMergeOverride(override bool) Option {
+	return func(c *Config) {
+		c.MergeOverride = override
+	}
+}
+
+// WithSplitNaming selects how Split names files after path items and components
+func WithSplitNaming(naming SplitNaming) Option {
+	return func(c *Config) {
+		c.SplitNaming = naming
+	}
+}
+
 func defaultConfig() *Config {
 	return &Config{
-		Validate:    false,
-		MaxFileSize: 0, // unlimited
-		MaxDepth:    0, // unlimited
-		HTTPTimeout: 30 * time.Second,
+		Validate:       false,
+		MaxFileSize:    0, // unlimited
+		MaxDepth:       0, // unlimited
+		HTTPTimeout:    30 * time.Second,
+		Concurrency:    10,
+		CircularRefs:   CircularRefKeep,
+		NameCollisions: NameCollisionSuffix,
+		Dedupe:         DedupeExact,
+		RefSiblings:    RefSiblingsAuto,
+		SplitNaming:    SplitNamingOriginal,
 	}
 }
 
 type Bundler struct {
-	useCase *usecase.BundleUseCase
-	config  *Config
+	useCase       *usecase.BundleUseCase
+	splitUseCase  *usecase.SplitUseCase
+	mergeUseCase  *usecase.MergeUseCase
+	vendorUseCase *usecase.VendorUseCase
+	config        *Config
 }
 
 func New(opts ...Option) *Bundler {
@@ -65,42 +364,156 @@ func New(opts ...Option) *Bundler {
 		opt(config)
 	}
 
-	fileLoader := loader.NewFileLoaderWithTimeout(config.HTTPTimeout)
+	fileLoader := newFileLoader(config, config.Schemes)
 	fileWriter := writer.NewFileWriter()
-	p := parser.NewParser()
-	referenceResolver := resolver.NewReferenceResolver(fileLoader, p)
 	v := validator.NewValidator()
 
 	useCase := usecase.NewBundleUseCase(
 		fileLoader,
 		fileWriter,
-		p,
-		referenceResolver,
 		v,
 	)
 
 	return &Bundler{
-		useCase: useCase,
-		config:  config,
+		useCase:       useCase,
+		splitUseCase:  usecase.NewSplitUseCase(fileLoader, fileWriter),
+		mergeUseCase:  usecase.NewMergeUseCase(fileLoader, fileWriter, v),
+		vendorUseCase: usecase.NewVendorUseCase(fileLoader),
+		config:        config,
 	}
 }
 
+// newFileLoader creates the loader config describes, serving URIs through schemes
+func newFileLoader(config *Config, schemes map[string]SchemeHandler) domain.FileLoader {
+	options := loader.Options{
+		Timeout:       config.HTTPTimeout,
+		MaxConcurrent: config.Concurrency,
+		Cache:         newHTTPCache(config),
+		Schemes:       schemes,
+	}
+	if config.OfflineDir != "" {
+		options.Offline = vendored.NewStore(config.OfflineDir)
+	}
+	if len(config.Auth.Hosts) > 0 || config.Auth.Netrc {
+		options.Auth = httpauth.New(config.Auth)
+	}
+	return loader.NewFileLoaderWithOptions(options)
+}
+
+// newHTTPCache returns the cache WithHTTPCache selected, nil when it is off or the user
+// cache directory cannot be found
+func newHTTPCache(config *Config) *httpcache.Cache {
+	if !config.HTTPCache {
+		return nil
+	}
+	dir := config.HTTPCacheDir
+	if dir == "" {
+		var err error
+		if dir, err = httpcache.DefaultDir(); err != nil {
+			return nil
+		}
+	}
+	return httpcache.New(dir, config.HTTPCacheTTL)
+}
+
+// CleanHTTPCache removes the files WithHTTPCache stored in dir, the user cache
+// directory when dir is empty
+func CleanHTTPCache(dir string) error {
+	if dir == "" {
+		var err error
+		if dir, err = httpcache.DefaultDir(); err != nil {
+			return err
+		}
+	}
+	return httpcache.New(dir, 0).Clean()
+}
+
 func (b *Bundler) Bundle(ctx context.Context, inputPath, outputPath string) error {
-	return b.useCase.Execute(ctx, inputPath, outputPath, usecase.Config{
-		Validate:    b.config.Validate,
-		MaxFileSize: b.config.MaxFileSize,
-		MaxDepth:    b.config.MaxDepth,
-	})
+	return b.useCase.Execute(ctx, inputPath, outputPath, b.useCaseConfig(b.config.Validate))
 }
 
 func (b *Bundler) BundleWithValidation(ctx context.Context, inputPath, outputPath string) error {
-	return b.useCase.Execute(ctx, inputPath, outputPath, usecase.Config{
-		Validate:    true,
+	return b.useCase.Execute(ctx, inputPath, outputPath, b.useCaseConfig(true))
+}
+
+// BundleWithReport bundles like Bundle and reports the changes made to the document,
+// such as renamed components
+func (b *Bundler) BundleWithReport(ctx context.Context, inputPath, outputPath string) (*Report, error) {
+	return b.useCase.ExecuteWithReport(ctx, inputPath, outputPath, b.useCaseConfig(b.config.Validate))
+}
+
+// BundleFS bundles the document at root within fsys, such as an embed.FS, and returns
+// it in the format of root's extension. Relative refs resolve within fsys; remote and
+// other URI refs load as usual. Nothing is written: large examples WithEmbedExamples
+// would copy are only listed in the report.
+func (b *Bundler) BundleFS(ctx context.Context, fsys fs.FS, root string) ([]byte, *Report, error) {
+	schemes := make(map[string]SchemeHandler, len(b.config.Schemes)+1)
+	for scheme, handler := range b.config.Schemes {
+		schemes[scheme] = handler
+	}
+	schemes[fsScheme] = loader.NewFSHandler(fsys)
+
+	useCase := usecase.NewBundleUseCase(newFileLoader(b.config, schemes), writer.NewFileWriter(), validator.NewValidator())
+	name := path.Clean(strings.TrimPrefix(filepath.ToSlash(root), "/"))
+	input := fsScheme + ":" + (&url.URL{Path: name}).EscapedPath()
+	return useCase.ExecuteToBytes(ctx, input, domain.DetectFormat(name), b.useCaseConfig(b.config.Validate))
+}
+
+// BundleFiles bundles the document root of files, which maps slash-separated file
+// names like "schemas/pet.yaml" to their content, like BundleFS
+func (b *Bundler) BundleFiles(ctx context.Context, files map[string][]byte, root string) ([]byte, *Report, error) {
+	return b.BundleFS(ctx, newMemFS(files), root)
+}
+
+// Split explodes a single document into a tree that bundles back into it: the root file
+// is written to outputPath, path items to paths/ and components to components/<type>/
+// next to it. Internal refs become relative file refs. It returns the written files.
+func (b *Bundler) Split(ctx context.Context, inputPath, outputPath string) ([]string, error) {
+	return b.splitUseCase.Execute(ctx, inputPath, outputPath, usecase.SplitConfig{
 		MaxFileSize: b.config.MaxFileSize,
-		MaxDepth:    b.config.MaxDepth,
+		Naming:      b.config.SplitNaming,
+	})
+}
+
+// Merge bundles every input and combines their paths, webhooks, components, tags,
+// servers and security requirements into one document written to outputPath. The first
+// input provides info. Components defined differently by several inputs are prefixed
+// with the service name and reported; an operation defined by several inputs fails
+// with ErrPathConflict unless WithMergeOverride is set.
+func (b *Bundler) Merge(ctx context.Context, inputs []MergeInput, outputPath string) (*Report, error) {
+	return b.mergeUseCase.Execute(ctx, inputs, outputPath, usecase.MergeConfig{
+		Config:        b.useCaseConfig(b.config.Validate),
+		OverridePaths: b.config.MergeOverride,
 	})
 }
 
+// Vendor resolves every input and stores the remote files they refer to under dir,
+// listed in manifest.json, replacing what an earlier Vendor stored there. Bundling
+// with WithOffline(dir) then needs no network. It returns the vendored URLs.
+func (b *Bundler) Vendor(ctx context.Context, inputs []string, dir string) ([]string, error) {
+	return b.vendorUseCase.Execute(ctx, inputs, dir, b.useCaseConfig(false))
+}
+
+func (b *Bundler) useCaseConfig(validate bool) usecase.Config {
+	return usecase.Config{
+		Validate:             validate,
+		MaxFileSize:          b.config.MaxFileSize,
+		MaxDepth:             b.config.MaxDepth,
+		Inline:               b.config.Inline,
+		CircularRefs:         b.config.CircularRefs,
+		NameCollisions:       b.config.NameCollisions,
+		Dedupe:               b.config.Dedupe,
+		RefSiblings:          b.config.RefSiblings,
+		EmbedExamples:        b.config.EmbedExamples,
+		EmbedExamplesMaxSize: b.config.EmbedExamplesMaxSize,
+		RemoveUnused:         b.config.RemoveUnused,
+		KeepComponents:       b.config.KeepComponents,
+		Operations:           b.config.Operations,
+		Overlays:             b.config.Overlays,
+		Concurrency:          b.config.Concurrency,
+	}
+}
+
 func Bundle(ctx context.Context, inputPath, outputPath string) error {
 	b := New()
 	return b.Bundle(ctx, inputPath, outputPath)
@@ -110,4 +523,3 @@ func BundleWithValidation(ctx context.Context, inputPath, outputPath string) err
 	b := New(WithValidation(true))
 	return b.BundleWithValidation(ctx, inputPath, outputPath)
 }
-
@@ -2,9 +2,20 @@ package bundler
 
 import (
 	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"testing/fstest"
+	"time"
+
+	"gopkg.in/yaml.v3"
 )
 
 func TestBundle_Simple(t *testing.T) {
@@ -212,3 +223,2661 @@ info:
 	}
 }
 
+func TestBundle_Inline(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	mainFile := filepath.Join(tmpDir, "main.yaml")
+	mainContent := `openapi: 3.0.0
+info:
+  title: Test API
+  version: 1.0.0
+paths:
+  /users:
+    get:
+      responses:
+        '200':
+          description: Success
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/User'
+  /nodes:
+    get:
+      responses:
+        '200':
+          description: Success
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Node'
+components:
+  schemas:
+    User:
+      $ref: './schemas/user.yaml'
+    Address:
+      type: object
+      properties:
+        city:
+          type: string
+    Node:
+      type: object
+      properties:
+        child:
+          $ref: '#/components/schemas/Node'
+`
+	schemasDir := filepath.Join(tmpDir, "schemas")
+	if err := os.MkdirAll(schemasDir, 0755); err != nil {
+		t.Fatalf("Failed to create schemas directory: %v", err)
+	}
+	userContent := `type: object
+properties:
+  address:
+    $ref: '#/components/schemas/Address'
+`
+	if err := os.WriteFile(mainFile, []byte(mainContent), 0644); err != nil {
+		t.Fatalf("Failed to write main file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(schemasDir, "user.yaml"), []byte(userContent), 0644); err != nil {
+		t.Fatalf("Failed to write user file: %v", err)
+	}
+
+	outputFile := filepath.Join(tmpDir, "output.yaml")
+	b := New(WithInline(true))
+	if err := b.Bundle(context.Background(), mainFile, outputFile); err != nil {
+		t.Fatalf("Bundle() error = %v", err)
+	}
+
+	data, err := os.ReadFile(outputFile)
+	if err != nil {
+		t.Fatalf("Failed to read output file: %v", err)
+	}
+	content := string(data)
+
+	if strings.Contains(content, "#/components/schemas/User") || strings.Contains(content, "#/components/schemas/Address") {
+		t.Errorf("non-recursive refs should be inlined:\n%s", content)
+	}
+	if strings.Contains(content, "\n    User:") || strings.Contains(content, "\n    Address:") {
+		t.Errorf("inlined components should be removed:\n%s", content)
+	}
+	if !strings.Contains(content, "city:") {
+		t.Errorf("nested schema content should be inlined:\n%s", content)
+	}
+	if !strings.Contains(content, "$ref: '#/components/schemas/Node'") || !strings.Contains(content, "\n    Node:") {
+		t.Errorf("recursive schema should stay as an internal ref:\n%s", content)
+	}
+}
+
+// writeFiles writes files, keyed by slash-separated path, under dir
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory for %s: %v", name, err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+}
+
+func writeCircularSpec(t *testing.T, tmpDir string) string {
+	t.Helper()
+
+	files := map[string]string{
+		"main.yaml": `openapi: 3.0.0
+info:
+  title: Test API
+  version: 1.0.0
+paths:
+  /a:
+    get:
+      responses:
+        '200':
+          description: Success
+          content:
+            application/json:
+              schema:
+                $ref: './a.yaml'
+`,
+		"a.yaml": `type: object
+properties:
+  b:
+    $ref: './b.yaml'
+`,
+		"b.yaml": `type: object
+properties:
+  a:
+    $ref: './a.yaml'
+`,
+	}
+	writeFiles(t, tmpDir, files)
+	return filepath.Join(tmpDir, "main.yaml")
+}
+
+func TestBundle_CircularReferenceKeep(t *testing.T) {
+	tmpDir := t.TempDir()
+	mainFile := writeCircularSpec(t, tmpDir)
+	outputFile := filepath.Join(tmpDir, "output.yaml")
+
+	if err := New().Bundle(context.Background(), mainFile, outputFile); err != nil {
+		t.Fatalf("Bundle() error = %v", err)
+	}
+
+	data, err := os.ReadFile(outputFile)
+	if err != nil {
+		t.Fatalf("Failed to read output file: %v", err)
+	}
+	content := string(data)
+	if strings.Count(content, "$ref: '#/components/schemas/a'") != 2 {
+		t.Errorf("cycle should be kept as an internal ref:\n%s", content)
+	}
+	if !strings.Contains(content, "\n    a:\n") {
+		t.Errorf("cycle target should be hoisted into components:\n%s", content)
+	}
+}
+
+func TestBundle_CircularReferenceError(t *testing.T) {
+	tmpDir := t.TempDir()
+	mainFile := writeCircularSpec(t, tmpDir)
+	outputFile := filepath.Join(tmpDir, "output.yaml")
+
+	err := New(WithCircularRefs(CircularRefError)).Bundle(context.Background(), mainFile, outputFile)
+	if err == nil {
+		t.Fatal("Expected circular reference error")
+	}
+
+	var circularErr *ErrCircularReference
+	if !errors.As(err, &circularErr) {
+		t.Fatalf("Expected ErrCircularReference, got %v", err)
+	}
+	want := []string{"a.yaml", "b.yaml", "a.yaml"}
+	if strings.Join(circularErr.Chain, " -> ") != strings.Join(want, " -> ") {
+		t.Errorf("Chain = %v, want %v", circularErr.Chain, want)
+	}
+}
+
+func TestBundle_HoistsExternalComponents(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	files := map[string]string{
+		"main.yaml": `openapi: 3.0.0
+info:
+  title: Test API
+  version: 1.0.0
+paths:
+  /a:
+    get:
+      parameters:
+        - $ref: './common.yaml#/components/parameters/PageSize'
+      responses:
+        '404':
+          $ref: './common.yaml#/components/responses/NotFound'
+  /b:
+    get:
+      parameters:
+        - $ref: './common.yaml#/components/parameters/PageSize'
+      responses:
+        '200':
+          description: Success
+`,
+		"common.yaml": `components:
+  parameters:
+    PageSize:
+      name: size
+      in: query
+      schema:
+        type: integer
+  responses:
+    NotFound:
+      description: Not found
+      headers:
+        X-Request-Id:
+          $ref: '#/components/headers/RequestId'
+  headers:
+    RequestId:
+      schema:
+        type: string
+`,
+	}
+	writeFiles(t, tmpDir, files)
+
+	outputFile := filepath.Join(tmpDir, "output.yaml")
+	if err := New().Bundle(context.Background(), filepath.Join(tmpDir, "main.yaml"), outputFile); err != nil {
+		t.Fatalf("Bundle() error = %v", err)
+	}
+
+	data, err := os.ReadFile(outputFile)
+	if err != nil {
+		t.Fatalf("Failed to read output file: %v", err)
+	}
+	content := string(data)
+
+	if got := strings.Count(content, "$ref: '#/components/parameters/PageSize'"); got != 2 {
+		t.Errorf("parameter usages should become internal refs, got %d:\n%s", got, content)
+	}
+	if got := strings.Count(content, "name: size"); got != 1 {
+		t.Errorf("parameter should be defined once, got %d:\n%s", got, content)
+	}
+	for _, want := range []string{
+		"$ref: '#/components/responses/NotFound'",
+		"$ref: '#/components/headers/RequestId'",
+		"\n  parameters:\n    PageSize:",
+		"\n  responses:\n    NotFound:",
+		"\n  headers:\n    RequestId:",
+	} {
+		if !strings.Contains(content, want) {
+			t.Errorf("output should contain %q:\n%s", want, content)
+		}
+	}
+}
+
+func writeCollisionSpec(t *testing.T, tmpDir string) string {
+	t.Helper()
+
+	files := map[string]string{
+		"main.yaml": `openapi: 3.0.0
+info:
+  title: Test API
+  version: 1.0.0
+paths:
+  /billing:
+    get:
+      responses:
+        '400':
+          description: Billing error
+          content:
+            application/json:
+              schema:
+                $ref: './billing/errors.yaml#/components/schemas/Error'
+  /users:
+    get:
+      responses:
+        '400':
+          description: Users error
+          content:
+            application/json:
+              schema:
+                $ref: './users/errors.yaml#/components/schemas/Error'
+`,
+		"billing/errors.yaml": `components:
+  schemas:
+    Error:
+      type: object
+      properties:
+        code:
+          type: integer
+`,
+		"users/errors.yaml": `components:
+  schemas:
+    Error:
+      type: object
+      properties:
+        message:
+          type: string
+`,
+	}
+	writeFiles(t, tmpDir, files)
+	return filepath.Join(tmpDir, "main.yaml")
+}
+
+func TestBundle_NameCollisions(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy NameCollisionStrategy
+		wantName string
+	}{
+		{name: "suffix", strategy: NameCollisionSuffix, wantName: "Error2"},
+		{name: "prefix", strategy: NameCollisionPrefix, wantName: "UsersError"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			mainFile := writeCollisionSpec(t, tmpDir)
+			outputFile := filepath.Join(tmpDir, "output.yaml")
+
+			report, err := New(WithNameCollisions(tt.strategy)).BundleWithReport(context.Background(), mainFile, outputFile)
+			if err != nil {
+				t.Fatalf("BundleWithReport() error = %v", err)
+			}
+
+			if len(report.Renames) != 1 || report.Renames[0].From != "Error" || report.Renames[0].To != tt.wantName {
+				t.Errorf("Renames = %+v, want Error -> %s", report.Renames, tt.wantName)
+			}
+
+			data, err := os.ReadFile(outputFile)
+			if err != nil {
+				t.Fatalf("Failed to read output file: %v", err)
+			}
+			content := string(data)
+			if !strings.Contains(content, "$ref: '#/components/schemas/"+tt.wantName+"'") {
+				t.Errorf("usage should point to the renamed component:\n%s", content)
+			}
+			if !strings.Contains(content, "code:") || !strings.Contains(content, "message:") {
+				t.Errorf("both components should be kept:\n%s", content)
+			}
+		})
+	}
+}
+
+func TestBundle_NameCollisionFail(t *testing.T) {
+	tmpDir := t.TempDir()
+	mainFile := writeCollisionSpec(t, tmpDir)
+	outputFile := filepath.Join(tmpDir, "output.yaml")
+
+	err := New(WithNameCollisions(NameCollisionFail)).Bundle(context.Background(), mainFile, outputFile)
+	var collisionErr *ErrComponentNameCollision
+	if !errors.As(err, &collisionErr) {
+		t.Fatalf("Expected ErrComponentNameCollision, got %v", err)
+	}
+	if collisionErr.Name != "Error" {
+		t.Errorf("Name = %s, want Error", collisionErr.Name)
+	}
+	want := "component name collision: components.schemas.Error is defined differently in billing/errors.yaml#/components/schemas/Error and users/errors.yaml#/components/schemas/Error"
+	if got := collisionErr.Error(); got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+}
+
+func TestBundle_NameCollisionFailRootComponent(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeFiles(t, tmpDir, map[string]string{
+		"main.yaml": `openapi: 3.0.0
+info:
+  title: Test API
+  version: 1.0.0
+paths:
+  /billing:
+    get:
+      responses:
+        '400':
+          description: Billing error
+          content:
+            application/json:
+              schema:
+                $ref: './billing/errors.yaml#/components/schemas/Error'
+components:
+  schemas:
+    Error:
+      type: object
+      properties:
+        message:
+          type: string
+`,
+		"billing/errors.yaml": `components:
+  schemas:
+    Error:
+      type: object
+      properties:
+        code:
+          type: integer
+`,
+	})
+
+	err := New(WithNameCollisions(NameCollisionFail)).Bundle(context.Background(), filepath.Join(tmpDir, "main.yaml"), filepath.Join(tmpDir, "output.yaml"))
+	var collisionErr *ErrComponentNameCollision
+	if !errors.As(err, &collisionErr) {
+		t.Fatalf("Expected ErrComponentNameCollision, got %v", err)
+	}
+	want := "component name collision: components.schemas.Error is defined differently in main.yaml#/components/schemas/Error and billing/errors.yaml#/components/schemas/Error"
+	if got := collisionErr.Error(); got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+}
+
+func TestBundle_DedupeModes(t *testing.T) {
+	files := map[string]string{
+		"main.yaml": `openapi: 3.0.0
+info:
+  title: Test API
+  version: 1.0.0
+paths:
+  /address:
+    get:
+      responses:
+        '200':
+          description: Success
+          content:
+            application/json:
+              schema:
+                $ref: './address_copy.yaml'
+components:
+  schemas:
+    User:
+      type: object
+      properties:
+        address:
+          $ref: './address.yaml'
+`,
+		"address.yaml": `type: object
+required:
+  - city
+properties:
+  city:
+    type: string
+  zip:
+    type: string
+    default: '1'
+`,
+		"address_copy.yaml": `properties:
+  zip:
+    default: '1'
+    type: string
+  city:
+    type: string
+required:
+  - city
+type: object
+`,
+	}
+
+	tests := []struct {
+		name    string
+		mode    DedupeMode
+		wantRef bool
+	}{
+		{name: "off", mode: DedupeOff, wantRef: false},
+		{name: "exact", mode: DedupeExact, wantRef: false},
+		{name: "canonical", mode: DedupeCanonical, wantRef: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			writeFiles(t, tmpDir, files)
+
+			outputFile := filepath.Join(tmpDir, "output.yaml")
+			if err := New(WithDedupe(tt.mode)).Bundle(context.Background(), filepath.Join(tmpDir, "main.yaml"), outputFile); err != nil {
+				t.Fatalf("Bundle() error = %v", err)
+			}
+
+			data, err := os.ReadFile(outputFile)
+			if err != nil {
+				t.Fatalf("Failed to read output file: %v", err)
+			}
+			gotRef := strings.Contains(string(data), "$ref: '#/components/schemas/User/properties/address'")
+			if gotRef != tt.wantRef {
+				t.Errorf("deduplicated = %v, want %v:\n%s", gotRef, tt.wantRef, data)
+			}
+		})
+	}
+}
+
+func TestBundle_DedupeCanonicalKeepsScalarTypes(t *testing.T) {
+	tests := []struct {
+		name        string
+		value       string
+		other       string
+		deduplicate bool
+	}{
+		{name: "string and int", value: "'1'", other: "1", deduplicate: false},
+		{name: "int and float", value: "1", other: "1.0", deduplicate: true},
+		{name: "floats beyond int64", value: "1e300", other: "2e300", deduplicate: false},
+		{name: "max int64 and 2^63", value: "9223372036854775807", other: "9.223372036854775808e18", deduplicate: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			writeFiles(t, tmpDir, map[string]string{
+				"main.yaml": `openapi: 3.0.0
+info:
+  title: Test API
+  version: 1.0.0
+paths:
+  /code:
+    get:
+      responses:
+        '200':
+          description: Success
+          content:
+            application/json:
+              schema:
+                $ref: './code_other.yaml'
+components:
+  schemas:
+    Code:
+      type: object
+      properties:
+        value:
+          $ref: './code_value.yaml'
+`,
+				"code_value.yaml": "enum:\n  - " + tt.value + "\n",
+				"code_other.yaml": "enum:\n  - " + tt.other + "\n",
+			})
+
+			outputFile := filepath.Join(tmpDir, "output.yaml")
+			if err := New(WithDedupe(DedupeCanonical)).Bundle(context.Background(), filepath.Join(tmpDir, "main.yaml"), outputFile); err != nil {
+				t.Fatalf("Bundle() error = %v", err)
+			}
+
+			data, err := os.ReadFile(outputFile)
+			if err != nil {
+				t.Fatalf("Failed to read output file: %v", err)
+			}
+			got := strings.Contains(string(data), "$ref: '#/components/schemas/Code/properties/value'")
+			if got != tt.deduplicate {
+				t.Errorf("%s and %s deduplicated = %v, want %v:\n%s", tt.value, tt.other, got, tt.deduplicate, data)
+			}
+		})
+	}
+}
+
+func TestBundle_ArrayIndexFragment(t *testing.T) {
+	tmpDir := t.TempDir()
+	files := map[string]string{
+		"main.yaml": `openapi: 3.0.0
+info:
+  title: Test API
+  version: 1.0.0
+paths:
+  /users:
+    get:
+      parameters:
+        - $ref: './params.yaml#/parameters/1'
+      responses:
+        '200':
+          description: Success
+`,
+		"params.yaml": `parameters:
+  - name: page
+    in: query
+  - name: size
+    in: query
+`,
+	}
+	writeFiles(t, tmpDir, files)
+
+	outputFile := filepath.Join(tmpDir, "output.yaml")
+	if err := New().Bundle(context.Background(), filepath.Join(tmpDir, "main.yaml"), outputFile); err != nil {
+		t.Fatalf("Bundle() error = %v", err)
+	}
+
+	data, err := os.ReadFile(outputFile)
+	if err != nil {
+		t.Fatalf("Failed to read output file: %v", err)
+	}
+	if !strings.Contains(string(data), "name: size") || strings.Contains(string(data), "name: page") {
+		t.Errorf("array index fragment should resolve to the second parameter:\n%s", data)
+	}
+}
+
+func TestBundle_JSONSchema2020References(t *testing.T) {
+	// $id URIs name schemas of the loaded files, so nothing is fetched from them
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+
+	tmpDir := t.TempDir()
+	files := map[string]string{
+		"main.yaml": `openapi: 3.1.0
+info:
+  title: Test API
+  version: 1.0.0
+paths:
+  /users:
+    get:
+      parameters:
+        - name: nick
+          in: query
+          schema:
+            $ref: '` + server.URL + `/schemas/user#nick'
+            maxLength: 20
+      responses:
+        '200':
+          description: Success
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/User'
+components:
+  schemas:
+    User:
+      $ref: './user.yaml'
+`,
+		"user.yaml": `$id: ` + server.URL + `/schemas/user
+type: object
+properties:
+  address:
+    $ref: '#/$defs/Address'
+  manager:
+    $ref: '` + server.URL + `/schemas/user'
+  nickname:
+    $anchor: nick
+    type: string
+$defs:
+  Address:
+    type: object
+    properties:
+      city:
+        type: string
+`,
+	}
+	writeFiles(t, tmpDir, files)
+
+	outputFile := filepath.Join(tmpDir, "output.yaml")
+	if err := New().Bundle(context.Background(), filepath.Join(tmpDir, "main.yaml"), outputFile); err != nil {
+		t.Fatalf("Bundle() error = %v", err)
+	}
+
+	data, err := os.ReadFile(outputFile)
+	if err != nil {
+		t.Fatalf("Failed to read output file: %v", err)
+	}
+	output := string(data)
+
+	for _, want := range []string{
+		"$ref: '#/components/schemas/Address'",
+		"$ref: '#/components/schemas/User'",
+		"    Address:\n",
+		"maxLength: 20\n",
+		"allOf:\n",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("output should contain %q:\n%s", want, output)
+		}
+	}
+	for _, unwanted := range []string{"$defs", "$id", server.URL} {
+		if strings.Contains(output, unwanted) {
+			t.Errorf("output should not contain %q:\n%s", unwanted, output)
+		}
+	}
+	if n := requests.Load(); n != 0 {
+		t.Errorf("$id URIs were fetched %d times", n)
+	}
+}
+
+func TestBundle_DynamicRefs(t *testing.T) {
+	tmpDir := t.TempDir()
+	files := map[string]string{
+		"main.yaml": `openapi: 3.1.0
+info:
+  title: Test API
+  version: 1.0.0
+paths:
+  /tree:
+    get:
+      responses:
+        '200':
+          description: Success
+          content:
+            application/json:
+              schema:
+                $dynamicRef: './tree.yaml#node'
+  /leaf:
+    get:
+      responses:
+        '200':
+          description: Success
+          content:
+            application/json:
+              schema:
+                properties:
+                  leaf:
+                    $dynamicRef: './leaf.yaml'
+                  self:
+                    $dynamicRef: '#meta'
+components:
+  schemas:
+    Meta:
+      $dynamicAnchor: meta
+      type: object
+`,
+		"tree.yaml": `$dynamicAnchor: node
+type: object
+properties:
+  value:
+    type: string
+  children:
+    type: array
+    items:
+      $dynamicRef: '#node'
+`,
+		"leaf.yaml": `type: string
+`,
+	}
+	writeFiles(t, tmpDir, files)
+
+	outputFile := filepath.Join(tmpDir, "output.yaml")
+	if err := New().Bundle(context.Background(), filepath.Join(tmpDir, "main.yaml"), outputFile); err != nil {
+		t.Fatalf("Bundle() error = %v", err)
+	}
+
+	data, err := os.ReadFile(outputFile)
+	if err != nil {
+		t.Fatalf("Failed to read output file: %v", err)
+	}
+	output := string(data)
+
+	if n := strings.Count(output, "$dynamicRef: '#/components/schemas/tree'"); n != 2 {
+		t.Errorf("both tree refs should point to the hoisted schema, got %d:\n%s", n, output)
+	}
+	for _, want := range []string{
+		"    tree:\n      $dynamicAnchor: node\n",
+		"$dynamicRef: '#/components/schemas/leaf'",
+		"    leaf:\n      type: string\n",
+		"$dynamicRef: '#meta'",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("output should contain %q:\n%s", want, output)
+		}
+	}
+	if strings.Contains(output, ".yaml") {
+		t.Errorf("output should not refer to the source files:\n%s", output)
+	}
+}
+
+func TestBundle_Swagger2(t *testing.T) {
+	tmpDir := t.TempDir()
+	files := map[string]string{
+		"main.yaml": `swagger: "2.0"
+info:
+  title: Test API
+  version: 1.0.0
+paths:
+  /pets:
+    $ref: './paths/pets.yaml'
+definitions:
+  Error:
+    type: object
+    properties:
+      message:
+        type: string
+`,
+		"paths/pets.yaml": `get:
+  parameters:
+    - $ref: '../common.yaml#/parameters/Limit'
+  responses:
+    200:
+      description: Success
+      schema:
+        type: array
+        items:
+          $ref: '../pet.yaml'
+    404:
+      $ref: '../common.yaml#/responses/NotFound'
+`,
+		"pet.yaml": `type: object
+properties:
+  name:
+    type: string
+  owner:
+    $ref: '#/definitions/Owner'
+definitions:
+  Owner:
+    type: object
+`,
+		"common.yaml": `parameters:
+  Limit:
+    name: limit
+    in: query
+    type: integer
+responses:
+  NotFound:
+    description: Not found
+    schema:
+      $ref: '#/definitions/Error'
+definitions:
+  Error:
+    type: object
+    properties:
+      message:
+        type: string
+`,
+	}
+	writeFiles(t, tmpDir, files)
+
+	outputFile := filepath.Join(tmpDir, "output.yaml")
+	b := New(WithValidation(true))
+	if err := b.Bundle(context.Background(), filepath.Join(tmpDir, "main.yaml"), outputFile); err != nil {
+		t.Fatalf("Bundle() error = %v", err)
+	}
+
+	data, err := os.ReadFile(outputFile)
+	if err != nil {
+		t.Fatalf("Failed to read output file: %v", err)
+	}
+	output := string(data)
+
+	for _, want := range []string{
+		"$ref: '#/parameters/Limit'",
+		"$ref: '#/responses/NotFound'",
+		"$ref: '#/definitions/Owner'",
+		"$ref: '#/definitions/Error'",
+		"\nparameters:\n  Limit:\n",
+		"\nresponses:\n  NotFound:\n",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("output should contain %q:\n%s", want, output)
+		}
+	}
+	for _, unwanted := range []string{"components", ".yaml", "Error2"} {
+		if strings.Contains(output, unwanted) {
+			t.Errorf("output should not contain %q:\n%s", unwanted, output)
+		}
+	}
+}
+
+func TestBundle_AsyncAPI(t *testing.T) {
+	tmpDir := t.TempDir()
+	files := map[string]string{
+		"main.yaml": `asyncapi: 3.0.0
+info:
+  title: Events
+  version: 1.0.0
+channels:
+  userSignedUp:
+    $ref: './channels/userSignedUp.yaml'
+operations:
+  onUserSignedUp:
+    action: receive
+    channel:
+      $ref: '#/channels/userSignedUp'
+components:
+  messages:
+    UserDeleted:
+      $ref: './messages/userDeleted.yaml'
+`,
+		"channels/userSignedUp.yaml": `address: user/signedup
+messages:
+  userSignedUp:
+    $ref: '../messages/userSignedUp.yaml'
+  userDeleted:
+    $ref: '../messages/userDeleted.yaml'
+`,
+		"messages/userSignedUp.yaml": `payload:
+  $ref: '../schemas/user.yaml'
+`,
+		"messages/userDeleted.yaml": `payload:
+  type: object
+  properties:
+    user:
+      $ref: '../schemas/user.yaml'
+`,
+		"schemas/user.yaml": `type: object
+properties:
+  email:
+    type: string
+`,
+	}
+	writeFiles(t, tmpDir, files)
+
+	outputFile := filepath.Join(tmpDir, "output.yaml")
+	if err := New(WithValidation(true)).Bundle(context.Background(), filepath.Join(tmpDir, "main.yaml"), outputFile); err != nil {
+		t.Fatalf("Bundle() error = %v", err)
+	}
+
+	data, err := os.ReadFile(outputFile)
+	if err != nil {
+		t.Fatalf("Failed to read output file: %v", err)
+	}
+	output := string(data)
+
+	for _, want := range []string{
+		"address: user/signedup",
+		"$ref: '#/channels/userSignedUp'",
+		"$ref: '#/components/messages/userSignedUp'",
+		"$ref: '#/components/messages/UserDeleted'",
+		"$ref: '#/components/schemas/user'",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("output should contain %q:\n%s", want, output)
+		}
+	}
+	if got := strings.Count(output, "$ref: '#/components/schemas/user'"); got != 2 {
+		t.Errorf("both payloads should share the hoisted schema, got %d refs:\n%s", got, output)
+	}
+	if strings.Contains(output, ".yaml") {
+		t.Errorf("output should not contain file refs:\n%s", output)
+	}
+}
+
+func TestBundle_WebhooksCallbacksAndLinks(t *testing.T) {
+	tmpDir := t.TempDir()
+	files := map[string]string{
+		"main.yaml": `openapi: 3.1.0
+info:
+  title: Test API
+  version: 1.0.0
+paths:
+  /pets:
+    $ref: './paths/pets.yaml'
+  /pets/{id}:
+    $ref: './paths/pet.yaml'
+webhooks:
+  newPet:
+    $ref: './webhooks/newPet.yaml'
+components:
+  pathItems:
+    Ping:
+      $ref: './items/ping.yaml'
+`,
+		"paths/pets.yaml": `post:
+  callbacks:
+    onCreated:
+      '{$request.body#/callbackUrl}':
+        $ref: '../callbacks/created.yaml'
+  responses:
+    '201':
+      description: Created
+      links:
+        GetPet:
+          operationRef: './pet.yaml#/get'
+`,
+		"paths/pet.yaml": `get:
+  responses:
+    '200':
+      description: Success
+`,
+		"callbacks/created.yaml": `post:
+  requestBody:
+    content:
+      application/json:
+        schema:
+          $ref: '../schemas/pet.yaml'
+  responses:
+    '200':
+      description: Received
+`,
+		"webhooks/newPet.yaml": `post:
+  requestBody:
+    content:
+      application/json:
+        schema:
+          $ref: '../schemas/pet.yaml'
+  responses:
+    '200':
+      description: Received
+`,
+		"items/ping.yaml": `get:
+  responses:
+    '200':
+      $ref: '../responses/ok.yaml'
+`,
+		"responses/ok.yaml": `description: OK
+`,
+		"schemas/pet.yaml": `type: object
+properties:
+  name:
+    type: string
+`,
+	}
+	writeFiles(t, tmpDir, files)
+
+	outputFile := filepath.Join(tmpDir, "output.yaml")
+	if err := New().Bundle(context.Background(), filepath.Join(tmpDir, "main.yaml"), outputFile); err != nil {
+		t.Fatalf("Bundle() error = %v", err)
+	}
+
+	data, err := os.ReadFile(outputFile)
+	if err != nil {
+		t.Fatalf("Failed to read output file: %v", err)
+	}
+	output := string(data)
+
+	for _, want := range []string{
+		"$ref: '#/components/pathItems/newPet'",
+		"operationRef: '#/paths/~1pets~1%7Bid%7D/get'",
+		"description: Received",
+		"description: OK",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("output should contain %q:\n%s", want, output)
+		}
+	}
+	if strings.Contains(output, ".yaml") {
+		t.Errorf("output should not contain file refs:\n%s", output)
+	}
+}
+
+func writeSiblingSpec(t *testing.T, tmpDir, version string) string {
+	t.Helper()
+	files := map[string]string{
+		"main.yaml": `openapi: ` + version + `
+info:
+  title: Test API
+  version: 1.0.0
+paths:
+  /orders:
+    get:
+      parameters:
+        - $ref: './limit.yaml'
+          x-internal: true
+      responses:
+        '200':
+          description: Success
+          content:
+            application/json:
+              schema:
+                type: object
+                properties:
+                  status:
+                    $ref: '#/components/schemas/Status'
+                    description: Order status
+        '404':
+          $ref: './notFound.yaml'
+          description: Order not found
+components:
+  schemas:
+    Status:
+      type: string
+      enum: [new, paid]
+`,
+		"notFound.yaml": `description: Not found
+content:
+  application/json:
+    schema:
+      type: object
+`,
+		"limit.yaml": `name: limit
+in: query
+schema:
+  type: integer
+`,
+	}
+	writeFiles(t, tmpDir, files)
+	return filepath.Join(tmpDir, "main.yaml")
+}
+
+func TestBundle_RefSiblings(t *testing.T) {
+	// Parameters have no allOf, so their siblings are merged under every policy but drop
+	mergedLimit := "- name: limit\n          in: query\n          schema:\n            type: integer\n          x-internal: true"
+
+	tests := []struct {
+		name     string
+		version  string
+		policy   RefSiblingPolicy
+		want     []string
+		unwanted []string
+		warnings int
+	}{
+		{
+			name:     "3.0 auto",
+			version:  "3.0.3",
+			policy:   RefSiblingsAuto,
+			want:     []string{"description: Order not found", "description: Order status\n                    allOf:\n                      - $ref: '#/components/schemas/Status'", mergedLimit},
+			unwanted: []string{"description: Not found"},
+		},
+		{
+			name:     "3.1 auto",
+			version:  "3.1.0",
+			policy:   RefSiblingsAuto,
+			want:     []string{"description: Order not found", "$ref: '#/components/schemas/Status'\n                    description: Order status", mergedLimit},
+			unwanted: []string{"allOf", "description: Not found"},
+		},
+		{
+			name:     "3.1 allof",
+			version:  "3.1.0",
+			policy:   RefSiblingsAllOf,
+			want:     []string{"description: Order status\n                    allOf:\n                      - $ref: '#/components/schemas/Status'", mergedLimit},
+			unwanted: []string{"- allOf", "description: Not found"},
+		},
+		{
+			name:     "drop",
+			version:  "3.0.3",
+			policy:   RefSiblingsDrop,
+			want:     []string{"description: Not found", "status:\n                    $ref: '#/components/schemas/Status'\n"},
+			unwanted: []string{"Order status", "Order not found", "x-internal"},
+			warnings: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			inputFile := writeSiblingSpec(t, tmpDir, tt.version)
+			outputFile := filepath.Join(tmpDir, "output.yaml")
+
+			report, err := New(WithRefSiblings(tt.policy)).BundleWithReport(context.Background(), inputFile, outputFile)
+			if err != nil {
+				t.Fatalf("BundleWithReport() error = %v", err)
+			}
+
+			data, err := os.ReadFile(outputFile)
+			if err != nil {
+				t.Fatalf("Failed to read output file: %v", err)
+			}
+			output := string(data)
+
+			for _, want := range tt.want {
+				if !strings.Contains(output, want) {
+					t.Errorf("output should contain %q:\n%s", want, output)
+				}
+			}
+			for _, unwanted := range tt.unwanted {
+				if strings.Contains(output, unwanted) {
+					t.Errorf("output should not contain %q:\n%s", unwanted, output)
+				}
+			}
+			if len(report.Warnings) != tt.warnings {
+				t.Errorf("got %d warnings, want %d: %v", len(report.Warnings), tt.warnings, report.Warnings)
+			}
+		})
+	}
+}
+
+func TestBundler_SplitRoundTrip(t *testing.T) {
+	tmpDir := t.TempDir()
+	inputFile := filepath.Join(tmpDir, "spec.yaml")
+	rootFile := filepath.Join(tmpDir, "split", "openapi.yaml")
+	outputFile := filepath.Join(tmpDir, "bundled.yaml")
+
+	content := `openapi: 3.0.3
+info:
+  title: Pets
+  version: 1.0.0
+paths:
+  /pets:
+    get:
+      operationId: listPets
+      parameters:
+        - $ref: '#/components/parameters/Limit'
+      responses:
+        '200':
+          description: OK
+          content:
+            application/json:
+              schema:
+                type: array
+                items:
+                  $ref: '#/components/schemas/Pet'
+          links:
+            self:
+              operationRef: '#/paths/~1pets/get'
+        default:
+          $ref: '#/components/responses/Error'
+  /pets/{petId}:
+    get:
+      parameters:
+        - name: petId
+          in: path
+          required: true
+          schema:
+            type: string
+      responses:
+        '200':
+          description: OK
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Pet'
+components:
+  schemas:
+    Pet:
+      type: object
+      properties:
+        owner:
+          $ref: '#/components/schemas/PetOwner'
+        parent:
+          $ref: '#/components/schemas/Pet'
+        ownerName:
+          $ref: '#/components/schemas/PetOwner/properties/name'
+    PetOwner:
+      type: object
+      properties:
+        name:
+          type: string
+    ErrorBody:
+      type: object
+      properties:
+        message:
+          type: string
+  parameters:
+    Limit:
+      name: limit
+      in: query
+      schema:
+        type: integer
+  responses:
+    Error:
+      description: Error
+      content:
+        application/json:
+          schema:
+            $ref: '#/components/schemas/ErrorBody'
+`
+	if err := os.WriteFile(inputFile, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write input file: %v", err)
+	}
+
+	b := New(WithSplitNaming(SplitNamingKebab))
+	files, err := b.Split(context.Background(), inputFile, rootFile)
+	if err != nil {
+		t.Fatalf("Split() error = %v", err)
+	}
+	if len(files) != 8 {
+		t.Errorf("Split() wrote %d files, want 8: %v", len(files), files)
+	}
+
+	petData, err := os.ReadFile(filepath.Join(tmpDir, "split", "components", "schemas", "pet.yaml"))
+	if err != nil {
+		t.Fatalf("Failed to read split schema: %v", err)
+	}
+	for _, want := range []string{"$ref: './pet-owner.yaml'", "$ref: './pet.yaml'", "$ref: './pet-owner.yaml#/properties/name'"} {
+		if !strings.Contains(string(petData), want) {
+			t.Errorf("pet.yaml should contain %q:\n%s", want, petData)
+		}
+	}
+
+	if err := b.Bundle(context.Background(), rootFile, outputFile); err != nil {
+		t.Fatalf("Bundle() error = %v", err)
+	}
+	bundled, err := os.ReadFile(outputFile)
+	if err != nil {
+		t.Fatalf("Failed to read output file: %v", err)
+	}
+
+	var want, got interface{}
+	if err := yaml.Unmarshal([]byte(content), &want); err != nil {
+		t.Fatalf("Failed to parse input: %v", err)
+	}
+	if err := yaml.Unmarshal(bundled, &got); err != nil {
+		t.Fatalf("Failed to parse output: %v", err)
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("bundling the split tree should give back the original, got:\n%s", bundled)
+	}
+}
+
+func TestBundle_RemoteRelativeRefs(t *testing.T) {
+	files := map[string]string{
+		"/api/v1/openapi.yaml": `openapi: 3.0.3
+info:
+  title: Remote API
+  version: 1.0.0
+paths:
+  /pets:
+    get:
+      responses:
+        '200':
+          description: OK
+          content:
+            application/json:
+              schema:
+                $ref: 'schemas/My%20Pet.yaml'
+        default:
+          $ref: '../common/errors.yaml#/components/responses/Error'
+`,
+		"/api/v1/schemas/My Pet.yaml": `type: object
+properties:
+  name:
+    type: string
+`,
+		"/api/common/errors.yaml": `components:
+  responses:
+    Error:
+      description: Error
+`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		content, ok := files[r.URL.Path]
+		if !ok || (r.URL.Path == "/api/v1/openapi.yaml" && r.URL.Query().Get("token") != "secret") {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(content))
+	}))
+	defer server.Close()
+
+	outputFile := filepath.Join(t.TempDir(), "output.yaml")
+	if err := Bundle(context.Background(), server.URL+"/api/v1/openapi.yaml?token=secret", outputFile); err != nil {
+		t.Fatalf("Bundle() error = %v", err)
+	}
+
+	data, err := os.ReadFile(outputFile)
+	if err != nil {
+		t.Fatalf("Failed to read output file: %v", err)
+	}
+	output := string(data)
+	for _, want := range []string{"name:\n                    type: string", "$ref: '#/components/responses/Error'", "description: Error"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("output should contain %q:\n%s", want, output)
+		}
+	}
+}
+
+func TestBundle_RemoteCannotReadLocalFiles(t *testing.T) {
+	secret := filepath.Join(t.TempDir(), "secret.yaml")
+	if err := os.WriteFile(secret, []byte("type: string\nexample: local-secret\n"), 0644); err != nil {
+		t.Fatalf("Failed to write secret file: %v", err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`openapi: 3.0.3
+info:
+  title: Remote API
+  version: 1.0.0
+paths:
+  /pets:
+    get:
+      responses:
+        '200':
+          description: OK
+          content:
+            application/json:
+              schema:
+                $ref: '` + "file://" + filepath.ToSlash(secret) + `'
+`))
+	}))
+	defer server.Close()
+
+	outputFile := filepath.Join(t.TempDir(), "output.yaml")
+	err := Bundle(context.Background(), server.URL+"/openapi.yaml", outputFile)
+	if err == nil || !strings.Contains(err.Error(), "cannot refer to local files") {
+		t.Fatalf("Bundle() error = %v, want a refused file ref", err)
+	}
+	if data, err := os.ReadFile(outputFile); err == nil && strings.Contains(string(data), "local-secret") {
+		t.Errorf("output should not contain the local file:\n%s", data)
+	}
+}
+
+func TestBundle_RemoteCannotReadEnvironment(t *testing.T) {
+	t.Setenv("REGISTRY_TOKEN", "top-secret")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`openapi: 3.0.3
+info:
+  title: Remote API
+  version: 1.0.0
+  description:
+    $ref: 'env:REGISTRY_TOKEN'
+paths:
+  /pets:
+    get:
+      responses:
+        '200':
+          description: OK
+          content:
+            application/json:
+              schema:
+                type: string
+                example:
+                  $ref: 'env:REGISTRY_TOKEN'
+`))
+	}))
+	defer server.Close()
+
+	outputFile := filepath.Join(t.TempDir(), "output.yaml")
+	err := New().Bundle(context.Background(), server.URL+"/openapi.yaml", outputFile)
+	if err == nil || !strings.Contains(err.Error(), `no handler for URI scheme "env"`) {
+		t.Fatalf("Bundle() error = %v, want env: refs to be refused", err)
+	}
+	if data, err := os.ReadFile(outputFile); err == nil && strings.Contains(string(data), "top-secret") {
+		t.Errorf("output should not contain the environment variable:\n%s", data)
+	}
+}
+
+func TestBundle_FileURIAndEncodedNames(t *testing.T) {
+	tmpDir := t.TempDir()
+	files := map[string]string{
+		"openapi.yaml": `openapi: 3.0.3
+info:
+  title: Test API
+  version: 1.0.0
+paths:
+  /pets:
+    get:
+      responses:
+        '200':
+          description: OK
+          content:
+            application/json:
+              schema:
+                $ref: './common%20schemas/pet.yaml?v=1'
+`,
+		"common schemas/pet.yaml": `type: object
+properties:
+  name:
+    type: string
+`,
+	}
+	writeFiles(t, tmpDir, files)
+
+	outputFile := filepath.Join(tmpDir, "output.yaml")
+	input := "file://" + filepath.ToSlash(filepath.Join(tmpDir, "openapi.yaml"))
+	if err := Bundle(context.Background(), input, outputFile); err != nil {
+		t.Fatalf("Bundle() error = %v", err)
+	}
+
+	data, err := os.ReadFile(outputFile)
+	if err != nil {
+		t.Fatalf("Failed to read output file: %v", err)
+	}
+	if !strings.Contains(string(data), "name:\n                    type: string") {
+		t.Errorf("output should contain the pet schema:\n%s", data)
+	}
+}
+
+func TestBundle_MarkdownDescriptions(t *testing.T) {
+	tmpDir := t.TempDir()
+	files := map[string]string{
+		"api/openapi.yaml": `openapi: 3.0.3
+info:
+  title: Test API
+  version: 1.0.0
+  description:
+    $ref: ./docs/intro.md
+paths:
+  /pets:
+    get:
+      description:
+        $ref: ./docs/list-pets.txt
+      responses:
+        '200':
+          description: OK
+          content:
+            application/json:
+              schema:
+                $ref: ./schemas/pet.yaml
+`,
+		"api/docs/intro.md":      "# Pets\n\nSee the [flow](./img/flow.png), ![logo](img/logo.svg \"Logo\") and [terms][terms].\nBack to [top](#pets) or [home](https://example.com/docs).\n\n```\n[kept](./raw.md)\n```\n\n[terms]: ../legal/terms.md\n",
+		"api/docs/list-pets.txt": "Lists pets.\n[not a link](./x.md)\n",
+		"api/schemas/pet.yaml": `type: object
+description:
+  $ref: ../docs/pet.md
+`,
+		"api/docs/pet.md": "A pet, see [owners](owners.md#fields).\n",
+	}
+	writeFiles(t, tmpDir, files)
+
+	outputFile := filepath.Join(tmpDir, "dist", "openapi.yaml")
+	if err := Bundle(context.Background(), filepath.Join(tmpDir, "api", "openapi.yaml"), outputFile); err != nil {
+		t.Fatalf("Bundle() error = %v", err)
+	}
+
+	data, err := os.ReadFile(outputFile)
+	if err != nil {
+		t.Fatalf("Failed to read output file: %v", err)
+	}
+	output := string(data)
+
+	for _, want := range []string{
+		"description: |\n    # Pets",
+		"[flow](../api/docs/img/flow.png)",
+		"![logo](../api/docs/img/logo.svg \"Logo\")",
+		"[terms]: ../api/legal/terms.md",
+		"[top](#pets)",
+		"[home](https://example.com/docs)",
+		"[kept](./raw.md)",
+		"[not a link](./x.md)",
+		"[owners](../api/docs/owners.md#fields)",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("output should contain %q:\n%s", want, output)
+		}
+	}
+
+	var doc map[string]interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("Failed to parse output: %v", err)
+	}
+	if _, ok := doc["info"].(map[string]interface{})["description"].(string); !ok {
+		t.Errorf("info.description should be a string, got %#v", doc["info"])
+	}
+}
+
+func TestBundle_LiteralBlocksStayLiteral(t *testing.T) {
+	tmpDir := t.TempDir()
+	inputFile := filepath.Join(tmpDir, "openapi.yaml")
+	content := `openapi: 3.0.3
+info:
+  title: Test API
+  version: 1.0.0
+  description: |
+    2024-01-01: first release
+    +49 support line
+paths: {}
+`
+	if err := os.WriteFile(inputFile, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	outputFile := filepath.Join(tmpDir, "output.yaml")
+	if err := Bundle(context.Background(), inputFile, outputFile); err != nil {
+		t.Fatalf("Bundle() error = %v", err)
+	}
+
+	data, err := os.ReadFile(outputFile)
+	if err != nil {
+		t.Fatalf("Failed to read output file: %v", err)
+	}
+	if !strings.Contains(string(data), "description: |\n    2024-01-01: first release\n    +49 support line\n") {
+		t.Errorf("literal block should stay literal:\n%s", data)
+	}
+}
+
+func TestBundle_EmbedExamples(t *testing.T) {
+	tmpDir := t.TempDir()
+	files := map[string]string{
+		"openapi.yaml": `openapi: 3.0.3
+info:
+  title: Test API
+  version: 1.0.0
+paths:
+  /users:
+    $ref: ./paths/users.yaml
+components:
+  examples:
+    UserList:
+      summary: Users
+      externalValue: ./examples/users.yaml
+`,
+		"paths/users.yaml": `get:
+  responses:
+    '200':
+      description: OK
+      content:
+        application/json:
+          examples:
+            user:
+              summary: A user
+              externalValue: ../examples/user.json
+            list:
+              $ref: '#/components/examples/UserList'
+        text/csv:
+          examples:
+            csv:
+              externalValue: ../examples/users.csv
+        image/png:
+          examples:
+            avatar:
+              externalValue: ../examples/avatar.png
+`,
+		"examples/user.json":  `{"id": 1, "name": "Alice"}`,
+		"examples/users.yaml": "- id: 1\n- id: 2\n",
+		"examples/users.csv":  "id,name\n1,Alice\n",
+		"examples/avatar.png": strings.Repeat("x", 200),
+	}
+	writeFiles(t, tmpDir, files)
+
+	outputFile := filepath.Join(tmpDir, "dist", "openapi.yaml")
+	report, err := New(WithEmbedExamples(100)).BundleWithReport(context.Background(), filepath.Join(tmpDir, "openapi.yaml"), outputFile)
+	if err != nil {
+		t.Fatalf("BundleWithReport() error = %v", err)
+	}
+
+	data, err := os.ReadFile(outputFile)
+	if err != nil {
+		t.Fatalf("Failed to read output file: %v", err)
+	}
+	var doc struct {
+		Paths map[string]struct {
+			Get struct {
+				Responses map[string]struct {
+					Content map[string]struct {
+						Examples map[string]map[string]interface{}
+					}
+				}
+			}
+		}
+		Components struct {
+			Examples map[string]map[string]interface{}
+		}
+	}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("Failed to parse output: %v", err)
+	}
+	content := doc.Paths["/users"].Get.Responses["200"].Content
+
+	if got := content["application/json"].Examples["user"]["value"]; !reflect.DeepEqual(got, map[string]interface{}{"id": 1, "name": "Alice"}) {
+		t.Errorf("JSON example value = %#v\n%s", got, data)
+	}
+	if got := doc.Components.Examples["UserList"]["value"]; !reflect.DeepEqual(got, []interface{}{map[string]interface{}{"id": 1}, map[string]interface{}{"id": 2}}) {
+		t.Errorf("YAML example value = %#v\n%s", got, data)
+	}
+	if got := content["text/csv"].Examples["csv"]["value"]; got != "id,name\n1,Alice\n" {
+		t.Errorf("CSV example value = %#v\n%s", got, data)
+	}
+	if got := content["image/png"].Examples["avatar"]["externalValue"]; got != "examples/avatar.png" {
+		t.Errorf("large example externalValue = %#v\n%s", got, data)
+	}
+	if _, ok := content["application/json"].Examples["user"]["externalValue"]; ok {
+		t.Errorf("embedded example should not keep externalValue:\n%s", data)
+	}
+
+	if len(report.Assets) != 1 {
+		t.Fatalf("got %d copied files, want 1: %v", len(report.Assets), report.Assets)
+	}
+	copied, err := os.ReadFile(filepath.Join(tmpDir, "dist", "examples", "avatar.png"))
+	if err != nil || string(copied) != files["examples/avatar.png"] {
+		t.Errorf("large example should be copied next to the output: %v", err)
+	}
+}
+
+func TestBundle_RemoveUnused(t *testing.T) {
+	tmpDir := t.TempDir()
+	inputFile := filepath.Join(tmpDir, "openapi.yaml")
+	content := `openapi: 3.0.3
+info:
+  title: Test API
+  version: 1.0.0
+security:
+  - apiKey: []
+paths:
+  /pets:
+    get:
+      security:
+        - oauth: [read]
+      responses:
+        '200':
+          description: OK
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Pet'
+components:
+  schemas:
+    Pet:
+      type: object
+      discriminator:
+        propertyName: kind
+        mapping:
+          dog: Dog
+          cat: '#/components/schemas/Cat'
+      properties:
+        owner:
+          $ref: '#/components/schemas/Owner/properties/name'
+    Dog:
+      type: object
+    Cat:
+      type: object
+    Owner:
+      type: object
+      properties:
+        name:
+          type: string
+    Legacy:
+      type: object
+      properties:
+        old:
+          $ref: '#/components/schemas/LegacyPart'
+    LegacyPart:
+      type: string
+    Marked:
+      x-keep: true
+      type: object
+      properties:
+        part:
+          $ref: '#/components/schemas/MarkedPart'
+    MarkedPart:
+      type: string
+    Allowed:
+      type: string
+  parameters:
+    Unused:
+      name: unused
+      in: query
+  securitySchemes:
+    apiKey:
+      type: apiKey
+      name: X-Key
+      in: header
+    oauth:
+      type: oauth2
+      flows: {}
+    basic:
+      type: http
+      scheme: basic
+`
+	if err := os.WriteFile(inputFile, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write input file: %v", err)
+	}
+
+	outputFile := filepath.Join(tmpDir, "output.yaml")
+	report, err := New(WithRemoveUnused("schemas/Allowed")).BundleWithReport(context.Background(), inputFile, outputFile)
+	if err != nil {
+		t.Fatalf("BundleWithReport() error = %v", err)
+	}
+
+	data, err := os.ReadFile(outputFile)
+	if err != nil {
+		t.Fatalf("Failed to read output file: %v", err)
+	}
+	var doc struct {
+		Components map[string]map[string]interface{}
+	}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("Failed to parse output: %v", err)
+	}
+
+	for _, name := range []string{"Pet", "Dog", "Cat", "Owner", "Marked", "MarkedPart", "Allowed"} {
+		if _, ok := doc.Components["schemas"][name]; !ok {
+			t.Errorf("schema %s should be kept:\n%s", name, data)
+		}
+	}
+	for _, name := range []string{"apiKey", "oauth"} {
+		if _, ok := doc.Components["securitySchemes"][name]; !ok {
+			t.Errorf("security scheme %s should be kept:\n%s", name, data)
+		}
+	}
+	if _, ok := doc.Components["parameters"]; ok {
+		t.Errorf("empty parameters section should be removed:\n%s", data)
+	}
+
+	want := []string{"components.schemas.Legacy", "components.schemas.LegacyPart", "components.parameters.Unused", "components.securitySchemes.basic"}
+	if !reflect.DeepEqual(report.Removed, want) {
+		t.Errorf("Removed = %v, want %v", report.Removed, want)
+	}
+}
+
+func TestBundle_OperationFilter(t *testing.T) {
+	tmpDir := t.TempDir()
+	files := map[string]string{
+		"openapi.yaml": `openapi: 3.1.0
+info:
+  title: Test API
+  version: 1.0.0
+tags:
+  - name: pets
+  - name: users
+  - name: admin
+paths:
+  /pets:
+    get:
+      operationId: listPets
+      tags: [pets]
+      responses:
+        '200':
+          description: OK
+          content:
+            application/json:
+              schema:
+                $ref: ./schemas/pet.yaml
+    delete:
+      operationId: deletePets
+      tags: [pets, admin]
+      responses:
+        '204':
+          description: Deleted
+  /pets/{id}:
+    $ref: '#/components/pathItems/PetItem'
+  /users:
+    get:
+      operationId: listUsers
+      tags: [users]
+      responses:
+        '200':
+          description: OK
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/User'
+components:
+  schemas:
+    User:
+      type: object
+  pathItems:
+    PetItem:
+      get:
+        operationId: getPet
+        tags: [pets]
+        responses:
+          '200':
+            description: OK
+      put:
+        operationId: updatePet
+        tags: [pets]
+        responses:
+          '200':
+            description: OK
+`,
+		"schemas/pet.yaml": "type: object\n",
+	}
+	writeFiles(t, tmpDir, files)
+
+	outputFile := filepath.Join(tmpDir, "output.yaml")
+	b := New(WithOperationFilter(OperationFilter{
+		IncludeTags:    []string{"pets"},
+		IncludePaths:   []string{"/pets/**"},
+		ExcludeMethods: []string{"PUT", "delete"},
+	}))
+	report, err := b.BundleWithReport(context.Background(), filepath.Join(tmpDir, "openapi.yaml"), outputFile)
+	if err != nil {
+		t.Fatalf("BundleWithReport() error = %v", err)
+	}
+
+	data, err := os.ReadFile(outputFile)
+	if err != nil {
+		t.Fatalf("Failed to read output file: %v", err)
+	}
+	var doc struct {
+		Tags       []map[string]string
+		Paths      map[string]map[string]interface{}
+		Components map[string]map[string]interface{}
+	}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("Failed to parse output: %v", err)
+	}
+
+	if len(doc.Paths) != 2 || len(doc.Paths["/pets"]) != 1 || doc.Paths["/pets"]["get"] == nil {
+		t.Errorf("only GET /pets and GET /pets/{id} should be kept:\n%s", data)
+	}
+	if item := doc.Paths["/pets/{id}"]; item["get"] == nil || item["put"] != nil {
+		t.Errorf("the shared path item should be copied without PUT:\n%s", data)
+	}
+	if doc.Components != nil {
+		t.Errorf("components of the dropped operations should be removed:\n%s", data)
+	}
+	want := []string{"components.schemas.User", "components.pathItems.PetItem"}
+	if !reflect.DeepEqual(report.Removed, want) {
+		t.Errorf("Removed = %v, want %v", report.Removed, want)
+	}
+	if len(doc.Tags) != 1 || doc.Tags[0]["name"] != "pets" {
+		t.Errorf("Tags = %v, want only pets", doc.Tags)
+	}
+}
+
+func TestBundler_Merge(t *testing.T) {
+	tmpDir := t.TempDir()
+	files := map[string]string{
+		"billing/openapi.yaml": `openapi: 3.0.3
+info:
+  title: Billing
+  version: 1.0.0
+servers:
+  - url: https://api.example.com
+security:
+  - apiKey: []
+tags:
+  - name: invoices
+paths:
+  /invoices:
+    get:
+      tags: [invoices]
+      responses:
+        '200':
+          description: OK
+          content:
+            application/json:
+              schema:
+                $ref: ./schemas/invoice.yaml
+        default:
+          description: Error
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Error'
+      links:
+        self:
+          operationRef: '#/paths/~1invoices/get'
+components:
+  schemas:
+    Error:
+      type: object
+      properties:
+        code:
+          type: integer
+    Money:
+      type: string
+  securitySchemes:
+    apiKey:
+      type: apiKey
+      name: X-Billing-Key
+      in: header
+`,
+		"billing/schemas/invoice.yaml": `type: object
+properties:
+  total:
+    $ref: '../openapi.yaml#/components/schemas/Money'
+`,
+		"users.yaml": `openapi: 3.0.3
+info:
+  title: Users
+  version: 2.0.0
+servers:
+  - url: https://api.example.com
+  - url: https://users.example.com
+security:
+  - apiKey: []
+tags:
+  - name: users
+  - name: invoices
+paths:
+  /users:
+    get:
+      tags: [users]
+      responses:
+        default:
+          description: Error
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Error'
+components:
+  schemas:
+    Error:
+      type: object
+      properties:
+        message:
+          type: string
+    Money:
+      type: string
+  securitySchemes:
+    apiKey:
+      type: apiKey
+      name: X-Users-Key
+      in: header
+`,
+		"invoices.yaml": `openapi: 3.0.3
+info:
+  title: Invoices
+  version: 1.0.0
+paths:
+  /billing/invoices:
+    get:
+      responses:
+        '200':
+          description: OK
+`,
+	}
+	writeFiles(t, tmpDir, files)
+
+	billing := MergeInput{Path: filepath.Join(tmpDir, "billing", "openapi.yaml"), PathPrefix: "/billing"}
+	users := MergeInput{Path: filepath.Join(tmpDir, "users.yaml")}
+	outputFile := filepath.Join(tmpDir, "gateway.yaml")
+	report, err := New(WithValidation(true)).Merge(context.Background(), []MergeInput{billing, users}, outputFile)
+	if err != nil {
+		t.Fatalf("Merge() error = %v", err)
+	}
+
+	data, err := os.ReadFile(outputFile)
+	if err != nil {
+		t.Fatalf("Failed to read output file: %v", err)
+	}
+	output := string(data)
+	for _, want := range []string{
+		"title: Billing",
+		"/billing/invoices:",
+		"/users:",
+		"operationRef: '#/paths/~1billing~1invoices/get'",
+		"$ref: '#/components/schemas/UsersError'",
+		"- UsersapiKey: []",
+		"url: 'https://users.example.com'",
+		"name: X-Users-Key",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("output should contain %q:\n%s", want, output)
+		}
+	}
+	if strings.Contains(output, "UsersMoney") || strings.Count(output, "- name: invoices") != 1 || strings.Count(output, "url: 'https://api.example.com'") != 1 {
+		t.Errorf("identical components, tags and servers should be shared:\n%s", output)
+	}
+
+	want := []ComponentRename{
+		{Type: "schemas", From: "Error", To: "UsersError", Source: users.Path},
+		{Type: "securitySchemes", From: "apiKey", To: "UsersapiKey", Source: users.Path},
+	}
+	if !reflect.DeepEqual(report.Renames, want) {
+		t.Errorf("Renames = %+v, want %+v", report.Renames, want)
+	}
+
+	conflicting := MergeInput{Path: filepath.Join(tmpDir, "invoices.yaml")}
+	_, err = New().Merge(context.Background(), []MergeInput{billing, conflicting}, outputFile)
+	var conflict *ErrPathConflict
+	if !errors.As(err, &conflict) || conflict.Path != "/billing/invoices" || conflict.Method != "get" {
+		t.Fatalf("Merge() error = %v, want ErrPathConflict for GET /billing/invoices", err)
+	}
+
+	if _, err := New(WithMergeOverride(true)).Merge(context.Background(), []MergeInput{billing, conflicting}, outputFile); err != nil {
+		t.Fatalf("Merge() with override error = %v", err)
+	}
+	data, _ = os.ReadFile(outputFile)
+	if strings.Contains(string(data), "operationRef") {
+		t.Errorf("the last input should override the operation:\n%s", data)
+	}
+}
+
+func TestBundler_MergeSharedPathParameters(t *testing.T) {
+	tmpDir := t.TempDir()
+	files := map[string]string{
+		"pets.yaml": `openapi: 3.0.3
+info:
+  title: Pets
+  version: 1.0.0
+paths:
+  /pets/{id}:
+    parameters:
+      - name: id
+        in: path
+        required: true
+        schema:
+          type: string
+    get:
+      responses:
+        '200':
+          description: OK
+`,
+		"admin.yaml": `openapi: 3.0.3
+info:
+  title: Admin
+  version: 1.0.0
+paths:
+  /pets/{id}:
+    parameters:
+      - $ref: '#/components/parameters/Id'
+      - name: X-Admin-Token
+        in: header
+        required: true
+        schema:
+          type: string
+    delete:
+      parameters:
+        - name: id
+          in: path
+          required: true
+          schema:
+            type: integer
+      responses:
+        '204':
+          description: Deleted
+components:
+  parameters:
+    Id:
+      name: id
+      in: path
+      required: true
+      schema:
+        type: integer
+`,
+	}
+	writeFiles(t, tmpDir, files)
+
+	outputFile := filepath.Join(tmpDir, "gateway.yaml")
+	inputs := []MergeInput{{Path: filepath.Join(tmpDir, "pets.yaml")}, {Path: filepath.Join(tmpDir, "admin.yaml")}}
+	if _, err := New(WithValidation(true)).Merge(context.Background(), inputs, outputFile); err != nil {
+		t.Fatalf("Merge() error = %v", err)
+	}
+
+	data, err := os.ReadFile(outputFile)
+	if err != nil {
+		t.Fatalf("Failed to read output file: %v", err)
+	}
+	var doc struct {
+		Paths map[string]map[string]struct {
+			Parameters []struct {
+				Name string `yaml:"name"`
+			} `yaml:"parameters"`
+		} `yaml:"paths"`
+	}
+	if err := yaml.Unmarshal(data, &doc); err != nil || strings.Contains(string(data), "\n    parameters:") {
+		t.Fatalf("different path parameters should move to the operations (%v):\n%s", err, data)
+	}
+	item := doc.Paths["/pets/{id}"]
+	names := func(method string) []string {
+		var names []string
+		for _, param := range item[method].Parameters {
+			names = append(names, param.Name)
+		}
+		return names
+	}
+	if got := names("get"); !reflect.DeepEqual(got, []string{"id"}) {
+		t.Errorf("get parameters = %v, want [id]:\n%s", got, data)
+	}
+	// The operation's own id overrides the path one, the header is inherited
+	if got := names("delete"); !reflect.DeepEqual(got, []string{"X-Admin-Token", "id"}) {
+		t.Errorf("delete parameters = %v, want [X-Admin-Token id]:\n%s", got, data)
+	}
+}
+
+func TestBundle_Overlays(t *testing.T) {
+	tmpDir := t.TempDir()
+	files := map[string]string{
+		"openapi.yaml": `openapi: 3.0.3
+info:
+  title: Test API
+  version: 1.0.0
+tags:
+  - name: pets
+paths:
+  /pets:
+    get:
+      summary: List pets
+      x-internal: false
+      responses:
+        '200':
+          description: OK
+          content:
+            application/json:
+              schema:
+                $ref: ./schemas/pet.yaml
+    delete:
+      x-internal: true
+      responses:
+        '204':
+          description: Deleted
+`,
+		"schemas/pet.yaml": "type: object\nproperties:\n  id:\n    type: integer\n",
+		"public.yaml": `overlay: 1.0.0
+info:
+  title: Public API
+  version: 1.0.0
+actions:
+  - target: $.info
+    update:
+      title: Public API
+      x-audience: public
+  - target: $.paths.*[?@['x-internal'] == true]
+    remove: true
+  - target: $.tags
+    update:
+      name: store
+`,
+		"docs.yaml": `overlay: 1.0.0
+info:
+  title: Docs
+  version: 1.0.0
+actions:
+  - target: $.paths['/pets'].get.responses['200'].content['application/json'].schema.properties.id
+    update:
+      description: Pet identifier
+  - target: $.paths['/orders']
+    description: Orders are not published yet
+    remove: true
+`,
+	}
+	writeFiles(t, tmpDir, files)
+
+	outputFile := filepath.Join(tmpDir, "output.yaml")
+	b := New(WithOverlays(filepath.Join(tmpDir, "public.yaml"), filepath.Join(tmpDir, "docs.yaml")))
+	report, err := b.BundleWithReport(context.Background(), filepath.Join(tmpDir, "openapi.yaml"), outputFile)
+	if err != nil {
+		t.Fatalf("BundleWithReport() error = %v", err)
+	}
+
+	data, err := os.ReadFile(outputFile)
+	if err != nil {
+		t.Fatalf("Failed to read output file: %v", err)
+	}
+	output := string(data)
+	want := `openapi: 3.0.3
+info:
+  title: Public API
+  version: 1.0.0
+  x-audience: public
+tags:
+  - name: pets
+  - name: store
+paths:
+  /pets:
+    get:
+      summary: List pets
+      x-internal: false
+      responses:
+        '200':
+          description: OK
+          content:
+            application/json:
+              schema:
+                type: object
+                properties:
+                  id:
+                    type: integer
+                    description: Pet identifier
+`
+	if output != want {
+		t.Errorf("output =\n%s\nwant\n%s", output, want)
+	}
+
+	if len(report.Warnings) != 1 || !strings.Contains(report.Warnings[0], "action 2: target $.paths['/orders'] matched nothing") {
+		t.Errorf("Warnings = %v, want one for the unmatched /orders target", report.Warnings)
+	}
+
+	if err := New(WithOverlays(filepath.Join(tmpDir, "openapi.yaml"))).Bundle(context.Background(), filepath.Join(tmpDir, "openapi.yaml"), outputFile); err == nil {
+		t.Error("Bundle() with a document that is not an overlay should fail")
+	}
+}
+
+func TestBundle_ConcurrentPrefetch(t *testing.T) {
+	files := map[string]string{
+		"/openapi.yaml": `openapi: 3.0.3
+info:
+  title: Remote API
+  version: 1.0.0
+paths:
+  /a:
+    $ref: 'paths/a.yaml'
+  /b:
+    $ref: 'paths/b.yaml'
+  /c:
+    $ref: 'paths/c.yaml'
+  /d:
+    $ref: 'paths/d.yaml'
+`,
+	}
+	for _, name := range []string{"a", "b", "c", "d"} {
+		files["/paths/"+name+".yaml"] = `get:
+  responses:
+    '200':
+      description: OK
+      content:
+        application/json:
+          schema:
+            $ref: '../schemas/` + name + `.yaml'
+`
+		files["/schemas/"+name+".yaml"] = `type: object
+properties:
+  ` + name + `:
+    type: string
+`
+	}
+
+	var mu sync.Mutex
+	inFlight, maxInFlight := 0, 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inFlight++
+		maxInFlight = max(maxInFlight, inFlight)
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+
+		content, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(content))
+	}))
+	defer server.Close()
+
+	bundle := func(concurrency int) string {
+		outputFile := filepath.Join(t.TempDir(), "output.yaml")
+		b := New(WithConcurrency(concurrency))
+		if err := b.Bundle(context.Background(), server.URL+"/openapi.yaml", outputFile); err != nil {
+			t.Fatalf("Bundle() error = %v", err)
+		}
+		data, err := os.ReadFile(outputFile)
+		if err != nil {
+			t.Fatalf("Failed to read output file: %v", err)
+		}
+		return string(data)
+	}
+
+	sequential := bundle(1)
+	mu.Lock()
+	maxInFlight = 0
+	mu.Unlock()
+	concurrent := bundle(3)
+
+	if maxInFlight < 2 || maxInFlight > 3 {
+		t.Errorf("max concurrent requests = %d, want 2..3", maxInFlight)
+	}
+	if sequential != concurrent {
+		t.Errorf("output depends on concurrency:\n%s\nvs\n%s", sequential, concurrent)
+	}
+}
+
+func TestBundle_ParallelResolution(t *testing.T) {
+	files := map[string][]byte{
+		"openapi.yaml": []byte(`openapi: 3.0.3
+info:
+  title: Pet API
+  version: 1.0.0
+paths:
+  /a:
+    get:
+      parameters:
+        - $ref: 'common/params.yaml#/components/parameters/limit'
+      responses:
+        '200':
+          description: OK
+          content:
+            application/json:
+              schema:
+                $ref: 'a/errors.yaml#/components/schemas/Error'
+  /b:
+    get:
+      parameters:
+        - $ref: 'common/params.yaml#/components/parameters/limit'
+      responses:
+        '200':
+          description: OK
+          content:
+            application/json:
+              schema:
+                $ref: 'b/errors.yaml#/components/schemas/Error'
+  /c:
+    $ref: 'paths/c.yaml'
+  /d:
+    get:
+      responses:
+        '200':
+          description: OK
+          content:
+            application/json:
+              schema:
+                $ref: 'a/errors.yaml#/components/schemas/Error'
+  /e:
+    $ref: 'paths/c.yaml'
+`),
+		"common/params.yaml": []byte("components:\n  parameters:\n    limit:\n      name: limit\n      in: query\n      schema:\n        type: integer\n"),
+		"a/errors.yaml":      []byte("components:\n  schemas:\n    Error:\n      type: object\n      properties:\n        code:\n          type: integer\n"),
+		"b/errors.yaml":      []byte("components:\n  schemas:\n    Error:\n      type: object\n      properties:\n        message:\n          type: string\n"),
+		"paths/c.yaml": []byte(`get:
+  responses:
+    '200':
+      description: OK
+      content:
+        application/json:
+          schema:
+            $ref: '../tree/Node.yaml'
+`),
+		"tree/Node.yaml": []byte("type: object\nproperties:\n  children:\n    type: array\n    items:\n      $ref: './Node.yaml'\n"),
+	}
+
+	bundle := func(concurrency int) (string, *Report) {
+		data, report, err := New(WithConcurrency(concurrency)).BundleFiles(context.Background(), files, "openapi.yaml")
+		if err != nil {
+			t.Fatalf("BundleFiles() error = %v", err)
+		}
+		return string(data), report
+	}
+
+	sequential, sequentialReport := bundle(1)
+	for _, want := range []string{"#/components/schemas/Error'", "#/components/schemas/Error2'", "#/components/parameters/limit'", "#/components/schemas/Node'"} {
+		if !strings.Contains(sequential, want) {
+			t.Errorf("output should contain %s:\n%s", want, sequential)
+		}
+	}
+
+	// Paths sharing files, colliding names and cycles give the same bundle in every run
+	for i := 0; i < 10; i++ {
+		concurrent, report := bundle(4)
+		if concurrent != sequential {
+			t.Fatalf("output depends on concurrency:\n%s\nvs\n%s", sequential, concurrent)
+		}
+		if !reflect.DeepEqual(report, sequentialReport) {
+			t.Fatalf("report depends on concurrency: %+v vs %+v", sequentialReport, report)
+		}
+	}
+}
+
+func TestBundler_VendorOffline(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/common/pet.yaml":
+			_, _ = w.Write([]byte("type: object\nproperties:\n  owner:\n    $ref: 'owner.yaml'\n"))
+		case "/common/owner.yaml":
+			_, _ = w.Write([]byte("type: object\nproperties:\n  name:\n    type: string\n"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+
+	tmpDir := t.TempDir()
+	inputFile := filepath.Join(tmpDir, "openapi.yaml")
+	content := `openapi: 3.0.3
+info:
+  title: Test API
+  version: 1.0.0
+paths:
+  /pets:
+    get:
+      responses:
+        '200':
+          description: OK
+          content:
+            application/json:
+              schema:
+                $ref: '` + server.URL + `/common/pet.yaml'
+`
+	if err := os.WriteFile(inputFile, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to create input file: %v", err)
+	}
+
+	vendorDir := filepath.Join(tmpDir, "vendor")
+	urls, err := New().Vendor(context.Background(), []string{inputFile}, vendorDir)
+	if err != nil {
+		t.Fatalf("Vendor() error = %v", err)
+	}
+	want := []string{server.URL + "/common/owner.yaml", server.URL + "/common/pet.yaml"}
+	if !reflect.DeepEqual(urls, want) {
+		t.Errorf("Vendor() = %v, want %v", urls, want)
+	}
+
+	online := filepath.Join(tmpDir, "online.yaml")
+	if err := New().Bundle(context.Background(), inputFile, online); err != nil {
+		t.Fatalf("Bundle() error = %v", err)
+	}
+	server.Close()
+
+	offline := filepath.Join(tmpDir, "offline.yaml")
+	if err := New(WithOffline(vendorDir)).Bundle(context.Background(), inputFile, offline); err != nil {
+		t.Fatalf("offline Bundle() error = %v", err)
+	}
+	onlineData, _ := os.ReadFile(online)
+	offlineData, _ := os.ReadFile(offline)
+	if string(onlineData) != string(offlineData) {
+		t.Errorf("offline bundle differs:\n%s\nvs\n%s", offlineData, onlineData)
+	}
+
+	missing := strings.Replace(content, "/common/pet.yaml", "/common/missing.yaml", 1)
+	if err := os.WriteFile(inputFile, []byte(missing), 0644); err != nil {
+		t.Fatalf("Failed to update input file: %v", err)
+	}
+	err = New(WithOffline(vendorDir)).Bundle(context.Background(), inputFile, offline)
+	var notVendored *ErrNotVendored
+	if !errors.As(err, &notVendored) || notVendored.URL != server.URL+"/common/missing.yaml" {
+		t.Errorf("offline Bundle() error = %v, want ErrNotVendored", err)
+	}
+}
+
+func TestBundle_SchemeHandlers(t *testing.T) {
+	t.Setenv("ERROR_SCHEMA", "type: object\nproperties:\n  message:\n    type: string\n")
+
+	specs := fstest.MapFS{
+		"specs/openapi.yaml": {Data: []byte(`openapi: 3.0.3
+info:
+  title: Embedded API
+  version: 1.0.0
+paths:
+  /pets:
+    get:
+      responses:
+        '200':
+          description: OK
+          content:
+            application/json:
+              schema:
+                $ref: 'schemas/pet.yaml'
+        default:
+          description: Error
+          content:
+            application/json:
+              schema:
+                $ref: 'env:ERROR_SCHEMA'
+`)},
+		"specs/schemas/pet.yaml": {Data: []byte(`type: object
+properties:
+  owner:
+    $ref: 'registry:owner'
+`)},
+	}
+	registry := SchemeHandlerFunc(func(ctx context.Context, location string) ([]byte, error) {
+		if location != "registry:owner" {
+			return nil, os.ErrNotExist
+		}
+		return []byte("type: object\nproperties:\n  name:\n    type: string\n"), nil
+	})
+
+	outputFile := filepath.Join(t.TempDir(), "output.yaml")
+	b := New(WithFS("embed", specs), WithSchemeHandler("registry", registry), WithSchemeHandler("env", EnvSchemeHandler()))
+	if err := b.Bundle(context.Background(), "embed:specs/openapi.yaml", outputFile); err != nil {
+		t.Fatalf("Bundle() error = %v", err)
+	}
+
+	data, err := os.ReadFile(outputFile)
+	if err != nil {
+		t.Fatalf("Failed to read output file: %v", err)
+	}
+	output := string(data)
+	for _, want := range []string{"owner:", "name:", "message:"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("output should contain %q:\n%s", want, output)
+		}
+	}
+	if strings.Contains(output, "embed:") || strings.Contains(output, "registry:") || strings.Contains(output, "env:") {
+		t.Errorf("output should not keep scheme refs:\n%s", output)
+	}
+}
+
+func TestBundler_BundleFS(t *testing.T) {
+	files := map[string][]byte{
+		"api/openapi.yaml": []byte(`openapi: 3.0.3
+info:
+  title: Pet API
+  version: 1.0.0
+paths:
+  /pets:
+    get:
+      responses:
+        '200':
+          description: OK
+          content:
+            application/json:
+              schema:
+                $ref: './schemas/Pet.yaml'
+  /tags:
+    get:
+      responses:
+        '200':
+          description: OK
+          content:
+            application/json:
+              schema:
+                $ref: './schemas/Tag.yaml'
+components:
+  schemas:
+    $ref: './schemas/index.yaml'
+`),
+		"api/schemas/index.yaml": []byte(`Pet:
+  $ref: './Pet.yaml'
+Tag:
+  type: object
+  description: Pet tag
+  properties:
+    name:
+      type: string
+`),
+		"api/schemas/Pet.yaml": []byte(`type: object
+properties:
+  name:
+    type: string
+`),
+		// Tag.yaml is the file of the Tag component, found by its name
+		"api/schemas/Tag.yaml": []byte("type: object\nproperties:\n  name:\n    type: string\n"),
+	}
+
+	// The same tree on disk gives the expected bundle
+	dir := t.TempDir()
+	specs := fstest.MapFS{}
+	disk := make(map[string]string, len(files))
+	for name, data := range files {
+		specs[name] = &fstest.MapFile{Data: data}
+		disk[name] = string(data)
+	}
+	writeFiles(t, dir, disk)
+	outputFile := filepath.Join(dir, "output.yaml")
+	if err := New().Bundle(context.Background(), filepath.Join(dir, "api", "openapi.yaml"), outputFile); err != nil {
+		t.Fatalf("Bundle() error = %v", err)
+	}
+	want, err := os.ReadFile(outputFile)
+	if err != nil {
+		t.Fatalf("Failed to read output file: %v", err)
+	}
+
+	b := New()
+	got, _, err := b.BundleFS(context.Background(), specs, "api/openapi.yaml")
+	if err != nil {
+		t.Fatalf("BundleFS() error = %v", err)
+	}
+	if string(got) != string(want) {
+		t.Errorf("BundleFS() differs from Bundle():\n%s\nwant:\n%s", got, want)
+	}
+	if !strings.Contains(string(got), "#/components/schemas/Tag") || strings.Contains(string(got), "Tag2") {
+		t.Errorf("Tag.yaml should map to the Tag component:\n%s", got)
+	}
+	if strings.Contains(string(got), "bundle-fs:") {
+		t.Errorf("output should not keep FS refs:\n%s", got)
+	}
+
+	// Validation checks the bundle in memory
+	got, _, err = New(WithValidation(true)).BundleFiles(context.Background(), files, "/api/openapi.yaml")
+	if err != nil {
+		t.Fatalf("BundleFiles() error = %v", err)
+	}
+	if string(got) != string(want) {
+		t.Errorf("BundleFiles() differs from Bundle():\n%s\nwant:\n%s", got, want)
+	}
+
+	got, _, err = b.BundleFiles(context.Background(), map[string][]byte{"openapi.json": files["api/openapi.yaml"]}, "openapi.json")
+	if err == nil {
+		t.Fatalf("BundleFiles() should fail for a missing ref, got:\n%s", got)
+	}
+}
+
+func TestBundler_BundleFilesMarkdown(t *testing.T) {
+	files := map[string][]byte{
+		"api/openapi.yaml": []byte(`openapi: 3.0.3
+info:
+  title: Pet API
+  version: 1.0.0
+  description:
+    $ref: ./docs/intro.md
+paths: {}
+`),
+		"api/docs/intro.md": []byte("See the [flow](./img/flow.png), the [terms](../../legal/terms.md) and [home](https://example.com/docs).\n"),
+	}
+
+	got, _, err := New().BundleFiles(context.Background(), files, "api/openapi.yaml")
+	if err != nil {
+		t.Fatalf("BundleFiles() error = %v", err)
+	}
+	for _, want := range []string{"[flow](docs/img/flow.png)", "[terms](../legal/terms.md)", "[home](https://example.com/docs)"} {
+		if !strings.Contains(string(got), want) {
+			t.Errorf("output should contain %q:\n%s", want, got)
+		}
+	}
+	if strings.Contains(string(got), "bundle-fs:") {
+		t.Errorf("links should not keep FS URIs:\n%s", got)
+	}
+}
+
+func TestBundler_BundleFilesCircularError(t *testing.T) {
+	files := map[string][]byte{
+		"api/openapi.yaml": []byte(`openapi: 3.0.3
+info:
+  title: Pet API
+  version: 1.0.0
+paths:
+  /a:
+    get:
+      responses:
+        '200':
+          description: OK
+          content:
+            application/json:
+              schema:
+                $ref: '../common/a.yaml'
+`),
+		"common/a.yaml": []byte("type: object\nproperties:\n  b:\n    $ref: './b.yaml'\n"),
+		"common/b.yaml": []byte("type: object\nproperties:\n  a:\n    $ref: './a.yaml'\n"),
+	}
+
+	_, _, err := New(WithCircularRefs(CircularRefError)).BundleFiles(context.Background(), files, "api/openapi.yaml")
+	var circularErr *ErrCircularReference
+	if !errors.As(err, &circularErr) {
+		t.Fatalf("Expected ErrCircularReference, got %v", err)
+	}
+	want := "../common/a.yaml -> ../common/b.yaml -> ../common/a.yaml"
+	if got := strings.Join(circularErr.Chain, " -> "); got != want {
+		t.Errorf("Chain = %s, want %s", got, want)
+	}
+	if strings.Contains(err.Error(), "bundle-fs:") {
+		t.Errorf("error should not name FS URIs: %v", err)
+	}
+}
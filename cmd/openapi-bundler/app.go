@@ -1,14 +1,153 @@
 package main
 
 import (
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/miorlan/openapi-bundler/internal/domain"
+	"github.com/miorlan/openapi-bundler/internal/infrastructure/httpauth"
+	"github.com/miorlan/openapi-bundler/internal/infrastructure/httpcache"
 	"github.com/miorlan/openapi-bundler/internal/infrastructure/loader"
 	"github.com/miorlan/openapi-bundler/internal/infrastructure/validator"
+	"github.com/miorlan/openapi-bundler/internal/infrastructure/vendored"
 	"github.com/miorlan/openapi-bundler/internal/infrastructure/writer"
 	"github.com/miorlan/openapi-bundler/internal/usecase"
 )
 
-func newBundler() *usecase.BundleUseCase {
-	fileLoader := loader.NewFileLoader()
+// defaultVendorDir - каталог, в который vendor сохраняет удалённые файлы
+const defaultVendorDir = "openapi-vendor"
+
+// loaderFlags - настройки загрузки внешних файлов, общие для bundle и merge
+type loaderFlags struct {
+	concurrency int
+	cache       bool
+	cacheDir    string
+	cacheTTL    time.Duration
+	offline     bool
+	vendorDir   string
+	authConfig  string
+	authBearer  stringList
+	authBasic   stringList
+	authHeaders stringList
+	netrc       bool
+	netrcFile   string
+	envRefs     bool
+
+	// auth собирается из флагов и файла --auth-config в parseAuth
+	auth domain.AuthConfig
+}
+
+func (f *loaderFlags) register(fs *flag.FlagSet) {
+	fs.IntVar(&f.concurrency, "concurrency", 10, "Сколько внешних файлов загружать и сколько путей разрешать одновременно")
+	fs.BoolVar(&f.cache, "cache", false, "Хранить удалённые файлы в HTTP-кэше на диске между запусками")
+	fs.StringVar(&f.cacheDir, "cache-dir", "", "Каталог HTTP-кэша, включает кэш (по умолчанию в пользовательском каталоге кэша)")
+	fs.DurationVar(&f.cacheTTL, "cache-ttl", 0, "Сколько использовать закэшированный файл без запроса к серверу, например 10m; 0 - всегда проверять ETag/Last-Modified")
+	fs.StringVar(&f.authConfig, "auth-config", "", "YAML/JSON файл с учётными данными по хостам (hosts: host, headers, tokenEnv, username, passwordEnv)")
+	fs.Var(&f.authBearer, "auth-bearer", "Bearer-токен для хоста из переменной окружения: host=ENV_VAR; флаг можно повторять")
+	fs.Var(&f.authBasic, "auth-basic", "Basic-авторизация для хоста, пароль из переменной окружения: host=user:ENV_VAR; флаг можно повторять")
+	fs.Var(&f.authHeaders, "auth-header", "Заголовок для хоста: 'host=Name: value', ${ENV_VAR} в значении заменяется; флаг можно повторять")
+	fs.BoolVar(&f.netrc, "netrc", false, "Брать логин и пароль из .netrc для хостов без других учётных данных")
+	fs.StringVar(&f.netrcFile, "netrc-file", "", "Путь к .netrc (по умолчанию $NETRC или ~/.netrc)")
+	fs.BoolVar(&f.envRefs, "env-refs", false, "Разрешить ссылки env:NAME на переменные окружения; их сможет прочитать любая, в том числе удалённая, спецификация")
+}
+
+// parseAuth собирает учётные данные из --auth-config и флагов; флаги дополняют
+// запись хоста из файла или создают новую
+func (f *loaderFlags) parseAuth() error {
+	if f.authConfig != "" {
+		config, err := httpauth.LoadConfig(f.authConfig)
+		if err != nil {
+			return err
+		}
+		f.auth = config
+	}
+	f.auth.Netrc = f.auth.Netrc || f.netrc || f.netrcFile != ""
+	if f.netrcFile != "" {
+		f.auth.NetrcFile = f.netrcFile
+	}
+
+	for _, value := range f.authBearer {
+		host, env, ok := strings.Cut(value, "=")
+		if !ok || host == "" || env == "" {
+			return fmt.Errorf("неверное значение --auth-bearer: %s (host=ENV_VAR)", value)
+		}
+		f.hostAuth(host).TokenEnv = env
+	}
+	for _, value := range f.authBasic {
+		host, credentials, _ := strings.Cut(value, "=")
+		username, env, ok := strings.Cut(credentials, ":")
+		if !ok || host == "" || username == "" {
+			return fmt.Errorf("неверное значение --auth-basic: %s (host=user:ENV_VAR)", value)
+		}
+		entry := f.hostAuth(host)
+		entry.Username, entry.PasswordEnv = username, env
+	}
+	for _, value := range f.authHeaders {
+		host, header, _ := strings.Cut(value, "=")
+		name, headerValue, ok := strings.Cut(header, ":")
+		if !ok || host == "" || strings.TrimSpace(name) == "" {
+			return fmt.Errorf("неверное значение --auth-header: %s (host=Name: value)", value)
+		}
+		entry := f.hostAuth(host)
+		if entry.Headers == nil {
+			entry.Headers = make(map[string]string)
+		}
+		entry.Headers[strings.TrimSpace(name)] = strings.TrimSpace(headerValue)
+	}
+	return nil
+}
+
+// hostAuth возвращает запись хоста, добавляя её при необходимости
+func (f *loaderFlags) hostAuth(host string) *domain.HostAuth {
+	for i := range f.auth.Hosts {
+		if strings.EqualFold(f.auth.Hosts[i].Host, host) {
+			return &f.auth.Hosts[i]
+		}
+	}
+	f.auth.Hosts = append(f.auth.Hosts, domain.HostAuth{Host: host})
+	return &f.auth.Hosts[len(f.auth.Hosts)-1]
+}
+
+// registerOffline добавляет флаги offline-режима; у команды vendor их нет
+func (f *loaderFlags) registerOffline(fs *flag.FlagSet) {
+	fs.BoolVar(&f.offline, "offline", false, "Не обращаться к сети: удалённые файлы берутся только из каталога --vendor-dir")
+	fs.StringVar(&f.vendorDir, "vendor-dir", defaultVendorDir, "Каталог, созданный командой vendor")
+}
+
+func newLoader(f loaderFlags) domain.FileLoader {
+	opts := loader.Options{Timeout: 30 * time.Second, MaxConcurrent: f.concurrency}
+	if f.offline {
+		opts.Offline = vendored.NewStore(f.vendorDir)
+	} else if f.cache || f.cacheDir != "" {
+		// Без каталога кэша файлы просто загружаются заново
+		if cache, err := newCache(f.cacheDir, f.cacheTTL); err == nil {
+			opts.Cache = cache
+		}
+	}
+	if len(f.auth.Hosts) > 0 || f.auth.Netrc {
+		opts.Auth = httpauth.New(f.auth)
+	}
+	if f.envRefs {
+		opts.Schemes = map[string]domain.SchemeHandler{"env": loader.NewEnvHandler()}
+	}
+	return loader.NewFileLoaderWithOptions(opts)
+}
+
+// newCache открывает HTTP-кэш в dir или в каталоге по умолчанию
+func newCache(dir string, ttl time.Duration) (*httpcache.Cache, error) {
+	if dir == "" {
+		var err error
+		if dir, err = httpcache.DefaultDir(); err != nil {
+			return nil, err
+		}
+	}
+	return httpcache.New(dir, ttl), nil
+}
+
+func newBundler(f loaderFlags) *usecase.BundleUseCase {
+	fileLoader := newLoader(f)
 	fileWriter := writer.NewFileWriter()
 	v := validator.NewValidator()
 
@@ -18,3 +157,22 @@ func newBundler() *usecase.BundleUseCase {
 		v,
 	)
 }
+
+func newSplitter() *usecase.SplitUseCase {
+	return usecase.NewSplitUseCase(
+		loader.NewFileLoader(),
+		writer.NewFileWriter(),
+	)
+}
+
+func newVendorer(f loaderFlags) *usecase.VendorUseCase {
+	return usecase.NewVendorUseCase(newLoader(f))
+}
+
+func newMerger(f loaderFlags) *usecase.MergeUseCase {
+	return usecase.NewMergeUseCase(
+		newLoader(f),
+		writer.NewFileWriter(),
+		validator.NewValidator(),
+	)
+}
@@ -8,6 +8,7 @@ import (
 	"os"
 	"strings"
 
+	"github.com/miorlan/openapi-bundler/internal/domain"
 	"github.com/miorlan/openapi-bundler/internal/usecase"
 )
 
@@ -43,12 +44,30 @@ func main() {
 	// Обработка команды bundle
 	if command == "bundle" {
 		var (
-			inputPath  string
-			outputPath string
-			validate   bool
-			verbose    bool
-			inline     bool
-			fileType   string // для совместимости со swagger-cli (--type)
+			inputPath      string
+			outputPath     string
+			validate       bool
+			verbose        bool
+			inline         bool
+			circular       string
+			collisions     string
+			dedupe         string
+			siblings       string
+			embed          bool
+			embedMax       int64
+			prune          bool
+			keep           string
+			includeTags    string
+			excludeTags    string
+			includeOps     string
+			excludeOps     string
+			includePaths   string
+			excludePaths   string
+			includeMethods string
+			excludeMethods string
+			overlays       stringList
+			loading        loaderFlags
+			fileType       string // для совместимости со swagger-cli (--type)
 		)
 
 		bundleCmd := flag.NewFlagSet("bundle", flag.ExitOnError)
@@ -58,7 +77,26 @@ func main() {
 		bundleCmd.StringVar(&outputPath, "output", "", "Путь к выходному файлу")
 		bundleCmd.StringVar(&fileType, "type", "", "Тип файла (yaml/json) - для совместимости со swagger-cli, определяется автоматически")
 		bundleCmd.BoolVar(&validate, "validate", false, "Валидировать OpenAPI спецификацию после объединения")
-		bundleCmd.BoolVar(&inline, "inline", false, "Инлайнить все ссылки (как swagger-cli) вместо сохранения структуры")
+		bundleCmd.BoolVar(&inline, "inline", false, "Разыменовать все $ref (как swagger-cli --dereference); рекурсивные схемы остаются внутренними ссылками")
+		bundleCmd.StringVar(&circular, "circular", string(domain.CircularRefKeep), "Обработка циклических ссылок: keep (оставить внутреннюю ссылку) или error (завершиться ошибкой)")
+		bundleCmd.StringVar(&collisions, "name-collisions", string(domain.NameCollisionSuffix), "Конфликты имён компонентов: suffix (Error2), prefix (имя файла или каталога) или fail")
+		bundleCmd.StringVar(&dedupe, "dedupe", string(domain.DedupeExact), "Дедупликация одинаковых схем: off, exact (с учётом порядка ключей) или canonical (без учёта порядка ключей)")
+		bundleCmd.StringVar(&siblings, "ref-siblings", string(domain.RefSiblingsAuto), "Ключи рядом с $ref: auto (по версии OpenAPI), merge (поверх цели), allof (обернуть схемы в allOf) или drop (удалить с предупреждением)")
+		bundleCmd.BoolVar(&embed, "embed-examples", false, "Встроить файлы externalValue в примеры: JSON и YAML как value, остальные как строку")
+		bundleCmd.Int64Var(&embedMax, "embed-examples-max-size", 0, "Файлы примеров больше этого размера (в байтах) копируются в examples/ рядом с выходным файлом; 0 - встраивать все")
+		bundleCmd.BoolVar(&prune, "remove-unused", false, "Удалить компоненты, на которые не ссылаются paths, webhooks, security и discriminator")
+		bundleCmd.StringVar(&keep, "keep", "", "Компоненты, которые --remove-unused оставляет, через запятую: Pet или schemas/Pet (также x-keep: true)")
+		bundleCmd.StringVar(&includeTags, "include-tags", "", "Оставить только операции с этими тегами, через запятую")
+		bundleCmd.StringVar(&excludeTags, "exclude-tags", "", "Удалить операции с этими тегами, через запятую")
+		bundleCmd.StringVar(&includeOps, "include-operations", "", "Оставить только операции с этими operationId, через запятую")
+		bundleCmd.StringVar(&excludeOps, "exclude-operations", "", "Удалить операции с этими operationId, через запятую")
+		bundleCmd.StringVar(&includePaths, "include-paths", "", "Оставить только пути, подходящие под шаблоны, через запятую: /users/** (* - внутри сегмента, ** - любые сегменты)")
+		bundleCmd.StringVar(&excludePaths, "exclude-paths", "", "Удалить пути, подходящие под шаблоны, через запятую")
+		bundleCmd.StringVar(&includeMethods, "include-methods", "", "Оставить только операции с этими HTTP-методами, через запятую: get,post")
+		bundleCmd.StringVar(&excludeMethods, "exclude-methods", "", "Удалить операции с этими HTTP-методами, через запятую")
+		bundleCmd.Var(&overlays, "overlay", "Overlay 1.0 документ, применяемый к результату; флаг можно повторять")
+		loading.register(bundleCmd)
+		loading.registerOffline(bundleCmd)
 		bundleCmd.BoolVar(&verbose, "verbose", false, "Подробный вывод")
 		bundleCmd.BoolVar(&verbose, "v", false, "Подробный вывод (краткая форма)")
 
@@ -66,6 +104,10 @@ func main() {
 			fmt.Fprintf(os.Stderr, "❌ Ошибка парсинга флагов: %v\n", err)
 			os.Exit(1)
 		}
+		if err := loading.parseAuth(); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ Ошибка: %v\n", err)
+			os.Exit(1)
+		}
 
 		// Поддержка swagger-cli формата: позиционный аргумент для input
 		// swagger-cli bundle -o output.yaml input.yaml --type yaml
@@ -81,6 +123,47 @@ func main() {
 			os.Exit(1)
 		}
 
+		circularPolicy := domain.CircularRefPolicy(circular)
+		if circularPolicy != domain.CircularRefKeep && circularPolicy != domain.CircularRefError {
+			fmt.Fprintf(os.Stderr, "❌ Ошибка: неизвестное значение --circular: %s (keep или error)\n", circular)
+			os.Exit(1)
+		}
+
+		collisionStrategy := domain.NameCollisionStrategy(collisions)
+		switch collisionStrategy {
+		case domain.NameCollisionSuffix, domain.NameCollisionPrefix, domain.NameCollisionFail:
+		default:
+			fmt.Fprintf(os.Stderr, "❌ Ошибка: неизвестное значение --name-collisions: %s (suffix, prefix или fail)\n", collisions)
+			os.Exit(1)
+		}
+
+		dedupeMode := domain.DedupeMode(dedupe)
+		switch dedupeMode {
+		case domain.DedupeOff, domain.DedupeExact, domain.DedupeCanonical:
+		default:
+			fmt.Fprintf(os.Stderr, "❌ Ошибка: неизвестное значение --dedupe: %s (off, exact или canonical)\n", dedupe)
+			os.Exit(1)
+		}
+
+		siblingPolicy := domain.RefSiblingPolicy(siblings)
+		switch siblingPolicy {
+		case domain.RefSiblingsAuto, domain.RefSiblingsMerge, domain.RefSiblingsAllOf, domain.RefSiblingsDrop:
+		default:
+			fmt.Fprintf(os.Stderr, "❌ Ошибка: неизвестное значение --ref-siblings: %s (auto, merge, allof или drop)\n", siblings)
+			os.Exit(1)
+		}
+
+		operations := domain.OperationFilter{
+			IncludeTags:         splitList(includeTags),
+			ExcludeTags:         splitList(excludeTags),
+			IncludeOperationIDs: splitList(includeOps),
+			ExcludeOperationIDs: splitList(excludeOps),
+			IncludePaths:        splitList(includePaths),
+			ExcludePaths:        splitList(excludePaths),
+			IncludeMethods:      splitList(includeMethods),
+			ExcludeMethods:      splitList(excludeMethods),
+		}
+
 		// Проверяем, что входной и выходной файлы не одинаковые
 		if inputPath == outputPath {
 			fmt.Fprintf(os.Stderr, "❌ Ошибка: входной и выходной файлы не могут быть одинаковыми\n")
@@ -99,19 +182,31 @@ func main() {
 			fmt.Fprintf(os.Stderr, "📦 Загрузка входного файла: %s\n", inputPath)
 		}
 
-		bundler := newBundler()
+		bundler := newBundler(loading)
 		ctx := context.Background()
 		config := usecase.Config{
-			Validate: validate,
-			Inline:   inline,
+			Validate:             validate,
+			Inline:               inline,
+			CircularRefs:         circularPolicy,
+			NameCollisions:       collisionStrategy,
+			Dedupe:               dedupeMode,
+			RefSiblings:          siblingPolicy,
+			EmbedExamples:        embed,
+			EmbedExamplesMaxSize: embedMax,
+			RemoveUnused:         prune,
+			KeepComponents:       splitList(keep),
+			Operations:           operations,
+			Overlays:             overlays,
+			Concurrency:          loading.concurrency,
 		}
-		
+
 		if showProgress && !verbose {
 			progress := NewSimpleProgress(true)
 			progress.Update("📦 Загрузка входного файла...")
 		}
-		
-		if err := bundler.Execute(ctx, inputPath, outputPath, config); err != nil {
+
+		report, err := bundler.ExecuteWithReport(ctx, inputPath, outputPath, config)
+		if err != nil {
 			if verbose {
 				fmt.Fprintf(os.Stderr, "❌ Ошибка при объединении: %v\n", err)
 			} else {
@@ -138,6 +233,24 @@ func main() {
 			fmt.Fprintf(os.Stderr, "💾 Сохранение результата: %s\n", outputPath)
 		}
 
+		for _, rename := range report.Renames {
+			fmt.Fprintf(os.Stderr, "⚠️  Компонент переименован из-за конфликта имён: components.%s.%s -> %s (%s)\n", rename.Type, rename.From, rename.To, rename.Source)
+		}
+		for _, warning := range report.Warnings {
+			fmt.Fprintf(os.Stderr, "⚠️  %s\n", warning)
+		}
+		if len(report.Removed) > 0 {
+			fmt.Fprintf(os.Stderr, "🧹 Удалено неиспользуемых компонентов: %d\n", len(report.Removed))
+		}
+		if verbose {
+			for _, removed := range report.Removed {
+				fmt.Fprintf(os.Stderr, "   - %s\n", removed)
+			}
+			for _, asset := range report.Assets {
+				fmt.Fprintf(os.Stderr, "📎 Пример скопирован: %s -> %s\n", asset.Source, asset.Path)
+			}
+		}
+
 		validateMsg := ""
 		if validate {
 			validateMsg = " и валидирована"
@@ -146,12 +259,261 @@ func main() {
 		return
 	}
 
+	// Обработка команды split
+	if command == "split" || command == "unbundle" {
+		var (
+			inputPath  string
+			outputPath string
+			naming     string
+			verbose    bool
+		)
+
+		splitCmd := flag.NewFlagSet(command, flag.ExitOnError)
+		splitCmd.StringVar(&inputPath, "i", "", "Путь к входному OpenAPI файлу")
+		splitCmd.StringVar(&inputPath, "input", "", "Путь к входному OpenAPI файлу")
+		splitCmd.StringVar(&outputPath, "o", "", "Путь к корневому файлу; paths/ и components/ создаются рядом с ним")
+		splitCmd.StringVar(&outputPath, "output", "", "Путь к корневому файлу; paths/ и components/ создаются рядом с ним")
+		splitCmd.StringVar(&naming, "naming", string(domain.SplitNamingOriginal), "Имена файлов: original (UserProfile.yaml), kebab (user-profile.yaml) или snake (user_profile.yaml)")
+		splitCmd.BoolVar(&verbose, "verbose", false, "Подробный вывод")
+		splitCmd.BoolVar(&verbose, "v", false, "Подробный вывод (краткая форма)")
+
+		if err := splitCmd.Parse(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ Ошибка парсинга флагов: %v\n", err)
+			os.Exit(1)
+		}
+
+		if inputPath == "" && len(splitCmd.Args()) > 0 {
+			inputPath = splitCmd.Args()[0]
+		}
+
+		if inputPath == "" || outputPath == "" {
+			fmt.Fprintf(os.Stderr, "❌ Ошибка: необходимо указать входной файл и корневой выходной файл\n")
+			fmt.Fprintf(os.Stderr, "Использование:\n")
+			fmt.Fprintf(os.Stderr, "  openapi-bundler split -i <input> -o <dir>/openapi.yaml\n")
+			os.Exit(1)
+		}
+
+		splitNaming := domain.SplitNaming(naming)
+		switch splitNaming {
+		case domain.SplitNamingOriginal, domain.SplitNamingKebab, domain.SplitNamingSnake:
+		default:
+			fmt.Fprintf(os.Stderr, "❌ Ошибка: неизвестное значение --naming: %s (original, kebab или snake)\n", naming)
+			os.Exit(1)
+		}
+
+		if inputPath == outputPath {
+			fmt.Fprintf(os.Stderr, "❌ Ошибка: входной и выходной файлы не могут быть одинаковыми\n")
+			os.Exit(1)
+		}
+
+		files, err := newSplitter().Execute(context.Background(), inputPath, outputPath, usecase.SplitConfig{Naming: splitNaming})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ Ошибка: %v\n", err)
+			os.Exit(1)
+		}
+
+		if verbose {
+			for _, file := range files {
+				fmt.Fprintf(os.Stderr, "💾 %s\n", file)
+			}
+		}
+		fmt.Printf("✅ OpenAPI спецификация разбита на %d файлов: %s\n", len(files), outputPath)
+		return
+	}
+
+	// Обработка команды merge
+	if command == "merge" {
+		var (
+			outputPath string
+			validate   bool
+			override   bool
+			overlays   stringList
+			loading    loaderFlags
+			verbose    bool
+		)
+
+		mergeCmd := flag.NewFlagSet("merge", flag.ExitOnError)
+		mergeCmd.StringVar(&outputPath, "o", "", "Путь к выходному файлу")
+		mergeCmd.StringVar(&outputPath, "output", "", "Путь к выходному файлу")
+		mergeCmd.BoolVar(&validate, "validate", false, "Валидировать OpenAPI спецификацию после объединения")
+		mergeCmd.BoolVar(&override, "override", false, "Одинаковые операции берутся из последней спецификации вместо ошибки")
+		mergeCmd.Var(&overlays, "overlay", "Overlay 1.0 документ, применяемый к результату; флаг можно повторять")
+		loading.register(mergeCmd)
+		loading.registerOffline(mergeCmd)
+		mergeCmd.BoolVar(&verbose, "verbose", false, "Подробный вывод")
+		mergeCmd.BoolVar(&verbose, "v", false, "Подробный вывод (краткая форма)")
+
+		if err := mergeCmd.Parse(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ Ошибка парсинга флагов: %v\n", err)
+			os.Exit(1)
+		}
+		if err := loading.parseAuth(); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ Ошибка: %v\n", err)
+			os.Exit(1)
+		}
+
+		if outputPath == "" || len(mergeCmd.Args()) == 0 {
+			fmt.Fprintf(os.Stderr, "❌ Ошибка: необходимо указать выходной файл и входные спецификации\n")
+			fmt.Fprintf(os.Stderr, "Использование:\n")
+			fmt.Fprintf(os.Stderr, "  openapi-bundler merge -o <output> [имя[:/префикс]=]<input> ...\n")
+			os.Exit(1)
+		}
+
+		var inputs []domain.MergeInput
+		for _, arg := range mergeCmd.Args() {
+			input := parseMergeInput(arg)
+			if input.Path == outputPath {
+				fmt.Fprintf(os.Stderr, "❌ Ошибка: входной и выходной файлы не могут быть одинаковыми\n")
+				os.Exit(1)
+			}
+			inputs = append(inputs, input)
+		}
+
+		config := usecase.MergeConfig{
+			Config:        usecase.Config{Validate: validate, Overlays: overlays, Concurrency: loading.concurrency},
+			OverridePaths: override,
+		}
+		report, err := newMerger(loading).Execute(context.Background(), inputs, outputPath, config)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ Ошибка: %v\n", err)
+			os.Exit(1)
+		}
+
+		for _, rename := range report.Renames {
+			fmt.Fprintf(os.Stderr, "⚠️  Компонент переименован из-за конфликта имён: components.%s.%s -> %s (%s)\n", rename.Type, rename.From, rename.To, rename.Source)
+		}
+		for _, warning := range report.Warnings {
+			fmt.Fprintf(os.Stderr, "⚠️  %s\n", warning)
+		}
+		if verbose {
+			for _, input := range inputs {
+				fmt.Fprintf(os.Stderr, "📦 %s\n", input.Path)
+			}
+		}
+		fmt.Printf("✅ Объединено спецификаций: %d: %s\n", len(inputs), outputPath)
+		return
+	}
+
+	// Обработка команды vendor
+	if command == "vendor" {
+		var (
+			outputDir string
+			overlays  stringList
+			loading   loaderFlags
+			verbose   bool
+		)
+
+		vendorCmd := flag.NewFlagSet("vendor", flag.ExitOnError)
+		vendorCmd.StringVar(&outputDir, "o", defaultVendorDir, "Каталог для удалённых файлов и manifest.json")
+		vendorCmd.StringVar(&outputDir, "output", defaultVendorDir, "Каталог для удалённых файлов и manifest.json")
+		vendorCmd.Var(&overlays, "overlay", "Overlay 1.0 документ, удалённые файлы которого тоже нужно сохранить; флаг можно повторять")
+		loading.register(vendorCmd)
+		vendorCmd.BoolVar(&verbose, "verbose", false, "Подробный вывод")
+		vendorCmd.BoolVar(&verbose, "v", false, "Подробный вывод (краткая форма)")
+
+		if err := vendorCmd.Parse(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ Ошибка парсинга флагов: %v\n", err)
+			os.Exit(1)
+		}
+		if err := loading.parseAuth(); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ Ошибка: %v\n", err)
+			os.Exit(1)
+		}
+
+		if len(vendorCmd.Args()) == 0 {
+			fmt.Fprintf(os.Stderr, "❌ Ошибка: необходимо указать входные спецификации\n")
+			fmt.Fprintf(os.Stderr, "Использование:\n")
+			fmt.Fprintf(os.Stderr, "  openapi-bundler vendor [-o <каталог>] <input> ...\n")
+			os.Exit(1)
+		}
+
+		urls, err := newVendorer(loading).Execute(context.Background(), vendorCmd.Args(), outputDir, usecase.Config{Overlays: overlays, Concurrency: loading.concurrency})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ Ошибка: %v\n", err)
+			os.Exit(1)
+		}
+
+		if verbose {
+			for _, url := range urls {
+				fmt.Fprintf(os.Stderr, "🌐 %s\n", url)
+			}
+		}
+		fmt.Printf("✅ Сохранено удалённых файлов: %d: %s\n", len(urls), outputDir)
+		return
+	}
+
+	// Обработка команды cache
+	if command == "cache" {
+		if len(os.Args) < 3 || os.Args[2] != "clean" {
+			fmt.Fprintf(os.Stderr, "❌ Ошибка: неизвестная подкоманда cache\n")
+			fmt.Fprintf(os.Stderr, "Использование:\n")
+			fmt.Fprintf(os.Stderr, "  openapi-bundler cache clean [--cache-dir <каталог>]\n")
+			os.Exit(1)
+		}
+
+		var cacheDir string
+		cleanCmd := flag.NewFlagSet("cache clean", flag.ExitOnError)
+		cleanCmd.StringVar(&cacheDir, "cache-dir", "", "Каталог HTTP-кэша (по умолчанию в пользовательском каталоге кэша)")
+		if err := cleanCmd.Parse(os.Args[3:]); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ Ошибка парсинга флагов: %v\n", err)
+			os.Exit(1)
+		}
+
+		cache, err := newCache(cacheDir, 0)
+		if err == nil {
+			err = cache.Clean()
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ Ошибка: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("✅ HTTP-кэш очищен: %s\n", cache.Dir())
+		return
+	}
+
 	// Неизвестная команда
 	fmt.Fprintf(os.Stderr, "❌ Неизвестная команда: %s\n\n", command)
 	printUsage()
 	os.Exit(1)
 }
 
+// stringList - значение флага, который можно указать несколько раз
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// parseMergeInput разбирает аргумент merge: путь к спецификации, при необходимости
+// с именем сервиса и префиксом путей: billing:/billing=services/billing/openapi.yaml.
+// Знак = в URL вида https://example.com/openapi.yaml?v=1 не отделяет имя: часть до
+// него содержит :// или ?
+func parseMergeInput(arg string) domain.MergeInput {
+	spec, path, ok := strings.Cut(arg, "=")
+	if !ok || strings.Contains(spec, "://") || strings.Contains(spec, "?") {
+		return domain.MergeInput{Path: arg}
+	}
+	input := domain.MergeInput{Path: path}
+	input.Name, input.PathPrefix, _ = strings.Cut(spec, ":")
+	return input
+}
+
+// splitList разбивает значение флага по запятым, пропуская пустые элементы
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
 func printUsage() {
 	fmt.Fprintf(os.Stderr, `openapi-bundler - утилита для объединения разбитых OpenAPI спецификаций
 
@@ -161,16 +523,24 @@ func printUsage() {
 Команды:
   bundle    Объединить разбитую OpenAPI спецификацию в один файл
             Используйте 'openapi-bundler bundle --help' для справки по флагам
+  split     Разбить OpenAPI спецификацию на файлы paths/ и components/ (синоним: unbundle)
+  merge     Объединить несколько независимых спецификаций в одну
+  vendor    Сохранить удалённые файлы спецификаций для сборки с --offline
+  cache     Управление HTTP-кэшем внешних файлов: cache clean
   version   Показать версию
   help      Показать эту справку
 
 Примеры:
   openapi-bundler bundle -i input.yaml -o output.yaml
   openapi-bundler bundle -o output.yaml input.yaml  # формат swagger-cli
+  openapi-bundler split -i openapi.yaml -o api/openapi/index.yaml
+  openapi-bundler merge -o gateway.yaml billing:/billing=billing.yaml users.yaml
+  openapi-bundler vendor -o openapi-vendor api/openapi/index.yaml
+  openapi-bundler bundle --offline -i api/openapi/index.yaml -o output.yaml
+  openapi-bundler cache clean
   openapi-bundler version
 
 Подробная документация: https://github.com/miorlan/openapi-bundler
 
 `)
 }
-
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/miorlan/openapi-bundler/internal/domain"
+)
+
+func TestParseMergeInput(t *testing.T) {
+	tests := map[string]domain.MergeInput{
+		"users.yaml":                                 {Path: "users.yaml"},
+		"users=services/users/openapi.yaml":          {Name: "users", Path: "services/users/openapi.yaml"},
+		"billing:/billing=billing.yaml":              {Name: "billing", PathPrefix: "/billing", Path: "billing.yaml"},
+		"https://example.com/openapi.yaml?version=2": {Path: "https://example.com/openapi.yaml?version=2"},
+		"billing:/billing=https://example.com/openapi.yaml?version=2": {
+			Name: "billing", PathPrefix: "/billing", Path: "https://example.com/openapi.yaml?version=2",
+		},
+	}
+	for arg, want := range tests {
+		if got := parseMergeInput(arg); got != want {
+			t.Errorf("parseMergeInput(%q) = %+v, want %+v", arg, got, want)
+		}
+	}
+}
@@ -1,13 +1,21 @@
 package domain
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
 
 // ErrCircularReference - бизнес-ошибка: циклические ссылки нарушают бизнес-правила OpenAPI
 type ErrCircularReference struct {
 	Path string
+	// Chain - полная цепочка ссылок, замыкающая цикл (первый и последний элементы совпадают)
+	Chain []string
 }
 
 func (e *ErrCircularReference) Error() string {
+	if len(e.Chain) > 0 {
+		return fmt.Sprintf("circular reference detected: %s", strings.Join(e.Chain, " -> "))
+	}
 	return fmt.Sprintf("circular reference detected: %s", e.Path)
 }
 
@@ -20,3 +28,34 @@ func (e *ErrInvalidReference) Error() string {
 	return fmt.Sprintf("invalid reference: %s", e.Ref)
 }
 
+// ErrComponentNameCollision - бизнес-ошибка: разные компоненты из разных файлов претендуют на одно имя
+type ErrComponentNameCollision struct {
+	Type    string
+	Name    string
+	Sources []string
+}
+
+func (e *ErrComponentNameCollision) Error() string {
+	return fmt.Sprintf("component name collision: components.%s.%s is defined differently in %s", e.Type, e.Name, strings.Join(e.Sources, " and "))
+}
+
+// ErrPathConflict - бизнес-ошибка: одна и та же операция определена в нескольких объединяемых спецификациях
+type ErrPathConflict struct {
+	Path    string
+	Method  string
+	Sources []string
+}
+
+func (e *ErrPathConflict) Error() string {
+	return fmt.Sprintf("path conflict: %s %s is defined in %s", strings.ToUpper(e.Method), e.Path, strings.Join(e.Sources, " and "))
+}
+
+// ErrNotVendored - в offline-режиме удалённый файл отсутствует в vendor-каталоге
+type ErrNotVendored struct {
+	URL string
+	Dir string
+}
+
+func (e *ErrNotVendored) Error() string {
+	return fmt.Sprintf("offline: %s is not vendored in %s, run the vendor command", e.URL, e.Dir)
+}
@@ -10,6 +10,17 @@ func TestErrCircularReference_Error(t *testing.T) {
 	}
 }
 
+func TestErrCircularReference_ErrorWithChain(t *testing.T) {
+	err := &ErrCircularReference{
+		Path:  "a.yaml#/X",
+		Chain: []string{"a.yaml#/X", "b.yaml#/Y", "a.yaml#/X"},
+	}
+	want := "circular reference detected: a.yaml#/X -> b.yaml#/Y -> a.yaml#/X"
+	if got := err.Error(); got != want {
+		t.Errorf("ErrCircularReference.Error() = %v, want %v", got, want)
+	}
+}
+
 func TestErrInvalidReference_Error(t *testing.T) {
 	err := &ErrInvalidReference{Ref: "./invalid.yaml"}
 	want := "invalid reference: ./invalid.yaml"
@@ -18,3 +29,34 @@ func TestErrInvalidReference_Error(t *testing.T) {
 	}
 }
 
+func TestErrComponentNameCollision_Error(t *testing.T) {
+	err := &ErrComponentNameCollision{
+		Type:    "schemas",
+		Name:    "Error",
+		Sources: []string{"billing.yaml#/components/schemas/Error", "users.yaml#/components/schemas/Error"},
+	}
+	want := "component name collision: components.schemas.Error is defined differently in billing.yaml#/components/schemas/Error and users.yaml#/components/schemas/Error"
+	if got := err.Error(); got != want {
+		t.Errorf("ErrComponentNameCollision.Error() = %v, want %v", got, want)
+	}
+}
+
+func TestErrPathConflict_Error(t *testing.T) {
+	err := &ErrPathConflict{
+		Path:    "/pets",
+		Method:  "get",
+		Sources: []string{"pets.yaml", "store.yaml"},
+	}
+	want := "path conflict: GET /pets is defined in pets.yaml and store.yaml"
+	if got := err.Error(); got != want {
+		t.Errorf("ErrPathConflict.Error() = %v, want %v", got, want)
+	}
+}
+
+func TestErrNotVendored_Error(t *testing.T) {
+	err := &ErrNotVendored{URL: "https://example.com/pet.yaml", Dir: "third_party/specs"}
+	want := "offline: https://example.com/pet.yaml is not vendored in third_party/specs, run the vendor command"
+	if got := err.Error(); got != want {
+		t.Errorf("ErrNotVendored.Error() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,29 @@
+package domain
+
+// ComponentRename describes a component renamed to resolve a name collision
+type ComponentRename struct {
+	Type   string
+	From   string
+	To     string
+	Source string
+}
+
+// Asset is a file the bundle refers to that is written next to it
+type Asset struct {
+	// Source is the file the asset was loaded from
+	Source string
+	// Path is slash-separated and relative to the directory of the bundle
+	Path string
+	Data []byte
+}
+
+// Report describes changes made to the document while bundling
+type Report struct {
+	Renames []ComponentRename
+	// Warnings describe content that was dropped, such as $ref siblings
+	Warnings []string
+	// Assets are files copied next to the bundle, like large externalValue examples
+	Assets []Asset
+	// Removed lists the unused components dropped from the bundle, like components.schemas.Pet
+	Removed []string
+}
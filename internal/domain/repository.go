@@ -2,11 +2,156 @@ package domain
 
 import "context"
 
+// CircularRefPolicy defines how the resolver handles circular references
+type CircularRefPolicy string
+
+const (
+	// CircularRefKeep keeps the cycle as an internal #/components/... ref
+	CircularRefKeep CircularRefPolicy = "keep"
+	// CircularRefError fails with ErrCircularReference
+	CircularRefError CircularRefPolicy = "error"
+)
+
+// NameCollisionStrategy defines how components with the same name but different content are renamed
+type NameCollisionStrategy string
+
+const (
+	// NameCollisionSuffix adds a numeric suffix: Error, Error2, Error3
+	NameCollisionSuffix NameCollisionStrategy = "suffix"
+	// NameCollisionPrefix prefixes the name with the source file or directory name: BillingError
+	NameCollisionPrefix NameCollisionStrategy = "prefix"
+	// NameCollisionFail fails with ErrComponentNameCollision
+	NameCollisionFail NameCollisionStrategy = "fail"
+)
+
+// DedupeMode defines how structurally equal schemas are detected for deduplication
+type DedupeMode string
+
+const (
+	// DedupeOff disables deduplication
+	DedupeOff DedupeMode = "off"
+	// DedupeExact deduplicates schemas written identically, in the same key order
+	DedupeExact DedupeMode = "exact"
+	// DedupeCanonical ignores mapping key order and compares scalars by their JSON value
+	DedupeCanonical DedupeMode = "canonical"
+)
+
+// RefSiblingPolicy defines what happens to keywords written next to a $ref
+type RefSiblingPolicy string
+
+const (
+	// RefSiblingsAuto follows the document version: in OpenAPI 3.1 summary and description
+	// override the target and schema keywords apply next to schemas; in 3.0 and Swagger 2.0
+	// siblings are merged over the target, or wrapped with allOf for schema refs
+	RefSiblingsAuto RefSiblingPolicy = "auto"
+	// RefSiblingsMerge merges the siblings over the target
+	RefSiblingsMerge RefSiblingPolicy = "merge"
+	// RefSiblingsAllOf wraps schema targets in allOf next to the siblings. Other objects
+	// have no allOf, so the siblings are merged over them.
+	RefSiblingsAllOf RefSiblingPolicy = "allof"
+	// RefSiblingsDrop removes the siblings and reports a warning
+	RefSiblingsDrop RefSiblingPolicy = "drop"
+)
+
+// SplitNaming defines how files of a split document are named after its path items and components
+type SplitNaming string
+
+const (
+	// SplitNamingOriginal keeps the component name: UserProfile.yaml
+	SplitNamingOriginal SplitNaming = "original"
+	// SplitNamingKebab uses kebab-case: user-profile.yaml
+	SplitNamingKebab SplitNaming = "kebab"
+	// SplitNamingSnake uses snake_case: user_profile.yaml
+	SplitNamingSnake SplitNaming = "snake"
+)
+
+// OperationFilter selects the operations of paths and webhooks kept in the bundle. An
+// operation is kept when it matches every include rule that is set and no exclude rule.
+// Paths are globs where * matches within a segment and ** across segments: /users/**.
+type OperationFilter struct {
+	IncludeTags         []string
+	ExcludeTags         []string
+	IncludeOperationIDs []string
+	ExcludeOperationIDs []string
+	IncludePaths        []string
+	ExcludePaths        []string
+	IncludeMethods      []string
+	ExcludeMethods      []string
+}
+
+// IsEmpty reports whether the filter keeps every operation
+func (f OperationFilter) IsEmpty() bool {
+	return len(f.IncludeTags)+len(f.ExcludeTags)+len(f.IncludeOperationIDs)+len(f.ExcludeOperationIDs)+
+		len(f.IncludePaths)+len(f.ExcludePaths)+len(f.IncludeMethods)+len(f.ExcludeMethods) == 0
+}
+
+// MergeInput is one of the specs combined by a merge
+type MergeInput struct {
+	// Path is the file or URL of the spec
+	Path string
+	// Name identifies the service; clashing component names are prefixed with it.
+	// It defaults to the file name, or the directory name for index.yaml and openapi.yaml.
+	Name string
+	// PathPrefix is prepended to every path of the spec, like /billing
+	PathPrefix string
+}
+
+// HostAuth holds the credentials sent to one host. Secrets are read from environment
+// variables when a request is made, so they never appear in configuration.
+type HostAuth struct {
+	// Host is matched against the URL host, with its port when the URL has one.
+	// *.example.com matches the subdomains of example.com.
+	Host string
+	// Headers are sent as is; ${NAME} in a value is replaced with the environment variable
+	Headers map[string]string
+	// TokenEnv names the environment variable holding a bearer token
+	TokenEnv string
+	// Username and the password in PasswordEnv are sent with basic auth
+	Username    string
+	PasswordEnv string
+}
+
+// AuthConfig configures the credentials of remote refs. Credentials are only sent to
+// the host they are configured for, redirects included.
+type AuthConfig struct {
+	Hosts []HostAuth
+	// Netrc uses the machines of .netrc for hosts that Hosts does not list
+	Netrc bool
+	// NetrcFile is the .netrc to read, $NETRC or ~/.netrc when empty
+	NetrcFile string
+}
+
 // Config contains resolver configuration
 type Config struct {
-	MaxFileSize int64
-	MaxDepth    int
-	Inline      bool
+	MaxFileSize  int64
+	MaxDepth     int
+	Inline       bool
+	CircularRefs CircularRefPolicy
+	// NameCollisions selects how conflicting component names are resolved (suffix by default)
+	NameCollisions NameCollisionStrategy
+	// Dedupe selects how duplicate schemas are detected (exact by default)
+	Dedupe DedupeMode
+	// RefSiblings selects what happens to keywords next to a $ref (auto by default)
+	RefSiblings RefSiblingPolicy
+	// RootPath is the root document, named as the source of its own components in errors
+	RootPath string
+	// BundleDir is the directory the bundle is written to. Relative links in included
+	// Markdown files are rewritten against it (the root document's directory when empty).
+	BundleDir string
+	// EmbedExamples loads externalValue example files into the bundle
+	EmbedExamples bool
+	// EmbedExamplesMaxSize is the size above which example files are copied next to
+	// the bundle instead of embedded. 0 embeds all of them.
+	EmbedExamplesMaxSize int64
+	// RemoveUnused drops the components nothing in the document refers to
+	RemoveUnused bool
+	// KeepComponents are kept by RemoveUnused, as "Pet" or "schemas/Pet"
+	KeepComponents []string
+	// Operations keeps only the matching operations, along with the components and tags they use
+	Operations OperationFilter
+	// Concurrency is how many path items are resolved at the same time; 0 and 1
+	// resolve them one after another. The bundle is the same either way.
+	Concurrency int
 }
 
 // FileLoader loads files from filesystem or URL
@@ -14,6 +159,35 @@ type FileLoader interface {
 	Load(ctx context.Context, path string) ([]byte, error)
 }
 
+// BatchFileLoader loads several files concurrently. The resolver uses it, when the
+// loader supports it, to prefetch the files of the ref graph.
+type BatchFileLoader interface {
+	FileLoader
+	// LoadMany returns the files that could be loaded, keyed by path, and the first error
+	LoadMany(ctx context.Context, paths []string) (map[string][]byte, error)
+}
+
+// FileChecker reports whether a file exists without loading it. The resolver uses it,
+// when the loader or a scheme handler supports it, to find the files named after
+// components. Remote files are not checked.
+type FileChecker interface {
+	Exists(path string) bool
+}
+
+// SchemeHandler loads the documents of a URI scheme, such as embed:specs/pet.yaml.
+// The FileLoader passes it the whole URI without fragment.
+type SchemeHandler interface {
+	Load(ctx context.Context, uri string) ([]byte, error)
+}
+
+// SchemeHandlerFunc adapts a function to a SchemeHandler
+type SchemeHandlerFunc func(ctx context.Context, uri string) ([]byte, error)
+
+// Load calls f(ctx, uri)
+func (f SchemeHandlerFunc) Load(ctx context.Context, uri string) ([]byte, error) {
+	return f(ctx, uri)
+}
+
 // FileWriter writes files to filesystem
 type FileWriter interface {
 	Write(path string, data []byte) error
@@ -22,4 +196,6 @@ type FileWriter interface {
 // Validator validates OpenAPI specifications
 type Validator interface {
 	Validate(filePath string) error
+	// ValidateData validates a specification held in memory
+	ValidateData(data []byte) error
 }
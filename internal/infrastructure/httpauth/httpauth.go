@@ -0,0 +1,300 @@
+// Package httpauth adds per-host credentials to the requests for remote refs
+package httpauth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/miorlan/openapi-bundler/internal/domain"
+	"gopkg.in/yaml.v3"
+)
+
+// maxRedirects matches the limit of the default http.Client
+const maxRedirects = 10
+
+// Credentials applies an AuthConfig to requests
+type Credentials struct {
+	config domain.AuthConfig
+
+	netrcOnce sync.Once
+	netrc     map[string]netrcEntry
+	netrcErr  error
+}
+
+// New creates Credentials for config. Environment variables and .netrc are read when
+// a request needs them.
+func New(config domain.AuthConfig) *Credentials {
+	return &Credentials{config: config}
+}
+
+// Apply sets the credentials configured for the host of req
+func (c *Credentials) Apply(req *http.Request) error {
+	header, err := c.header(req.URL)
+	if err != nil {
+		return err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	return nil
+}
+
+// CheckRedirect is an http.Client CheckRedirect that removes the credentials of the
+// original host from a redirected request and applies those of the new host, so
+// credentials never reach a host they were not configured for
+func (c *Credentials) CheckRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxRedirects)
+	}
+
+	// The client copies the headers of the first request to every redirect
+	original, err := c.header(via[0].URL)
+	if err != nil {
+		return err
+	}
+	for name := range original {
+		req.Header.Del(name)
+	}
+	return c.Apply(req)
+}
+
+// header returns the headers to send to the host of u
+func (c *Credentials) header(u *url.URL) (http.Header, error) {
+	header := make(http.Header)
+	host := c.lookup(u)
+	if host == nil {
+		if !c.config.Netrc {
+			return header, nil
+		}
+		entry, ok, err := c.netrcEntry(u.Hostname())
+		if err != nil || !ok {
+			return header, err
+		}
+		header.Set("Authorization", basicAuth(entry.login, entry.password))
+		return header, nil
+	}
+
+	for name, value := range host.Headers {
+		expanded, err := expand(value)
+		if err != nil {
+			return nil, fmt.Errorf("credentials for %s: header %s: %w", host.Host, name, err)
+		}
+		header.Set(name, expanded)
+	}
+	if host.TokenEnv != "" {
+		token, err := env(host.TokenEnv)
+		if err != nil {
+			return nil, fmt.Errorf("credentials for %s: %w", host.Host, err)
+		}
+		header.Set("Authorization", "Bearer "+token)
+	}
+	if host.Username != "" {
+		var password string
+		if host.PasswordEnv != "" {
+			var err error
+			if password, err = env(host.PasswordEnv); err != nil {
+				return nil, fmt.Errorf("credentials for %s: %w", host.Host, err)
+			}
+		}
+		header.Set("Authorization", basicAuth(host.Username, password))
+	}
+	return header, nil
+}
+
+// lookup returns the first host entry matching u: its host with port, its host name,
+// or a *. wildcard for one of its parent domains
+func (c *Credentials) lookup(u *url.URL) *domain.HostAuth {
+	hostPort := strings.ToLower(u.Host)
+	hostname := strings.ToLower(u.Hostname())
+	for i := range c.config.Hosts {
+		pattern := strings.ToLower(c.config.Hosts[i].Host)
+		switch {
+		case pattern == hostPort, pattern == hostname:
+			return &c.config.Hosts[i]
+		case strings.HasPrefix(pattern, "*.") && strings.HasSuffix(hostname, pattern[1:]):
+			return &c.config.Hosts[i]
+		}
+	}
+	return nil
+}
+
+func basicAuth(username, password string) string {
+	req := &http.Request{Header: make(http.Header)}
+	req.SetBasicAuth(username, password)
+	return req.Header.Get("Authorization")
+}
+
+// env returns a variable that must be set
+func env(name string) (string, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok || value == "" {
+		return "", fmt.Errorf("environment variable %s is not set", name)
+	}
+	return value, nil
+}
+
+// expand replaces ${NAME} and $NAME with environment variables that must be set
+func expand(value string) (string, error) {
+	var missing []string
+	expanded := os.Expand(value, func(name string) string {
+		v, err := env(name)
+		if err != nil {
+			missing = append(missing, name)
+		}
+		return v
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("environment variable %s is not set", strings.Join(missing, ", "))
+	}
+	return expanded, nil
+}
+
+// authFile is the layout of an auth config file
+type authFile struct {
+	Hosts []struct {
+		Host        string            `yaml:"host"`
+		Headers     map[string]string `yaml:"headers"`
+		TokenEnv    string            `yaml:"tokenEnv"`
+		Username    string            `yaml:"username"`
+		PasswordEnv string            `yaml:"passwordEnv"`
+	} `yaml:"hosts"`
+	Netrc     bool   `yaml:"netrc"`
+	NetrcFile string `yaml:"netrcFile"`
+}
+
+// LoadConfig reads an auth config file in YAML or JSON:
+//
+//	hosts:
+//	  - host: registry.example.com
+//	    tokenEnv: REGISTRY_TOKEN
+//	  - host: git.example.com
+//	    headers:
+//	      PRIVATE-TOKEN: ${GIT_TOKEN}
+//	netrc: true
+func LoadConfig(path string) (domain.AuthConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return domain.AuthConfig{}, fmt.Errorf("failed to read auth config: %w", err)
+	}
+
+	var file authFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return domain.AuthConfig{}, fmt.Errorf("failed to parse auth config %s: %w", path, err)
+	}
+
+	config := domain.AuthConfig{Netrc: file.Netrc || file.NetrcFile != "", NetrcFile: file.NetrcFile}
+	for i, host := range file.Hosts {
+		if host.Host == "" {
+			return domain.AuthConfig{}, fmt.Errorf("auth config %s: hosts[%d] has no host", path, i)
+		}
+		config.Hosts = append(config.Hosts, domain.HostAuth{
+			Host:        host.Host,
+			Headers:     host.Headers,
+			TokenEnv:    host.TokenEnv,
+			Username:    host.Username,
+			PasswordEnv: host.PasswordEnv,
+		})
+	}
+	return config, nil
+}
+
+type netrcEntry struct {
+	login    string
+	password string
+}
+
+// netrcEntry returns the .netrc machine named host. The default entry is not used,
+// as it would send the credentials to any host.
+func (c *Credentials) netrcEntry(host string) (netrcEntry, bool, error) {
+	c.netrcOnce.Do(func() {
+		path := c.config.NetrcFile
+		explicit := path != ""
+		if !explicit {
+			path = defaultNetrcPath()
+		}
+		data, err := os.ReadFile(path)
+		switch {
+		case err == nil:
+			c.netrc = parseNetrc(string(data))
+		case explicit || !errors.Is(err, os.ErrNotExist):
+			c.netrcErr = fmt.Errorf("failed to read netrc: %w", err)
+		}
+	})
+	if c.netrcErr != nil {
+		return netrcEntry{}, false, c.netrcErr
+	}
+	entry, ok := c.netrc[strings.ToLower(host)]
+	return entry, ok, nil
+}
+
+func defaultNetrcPath() string {
+	if path := os.Getenv("NETRC"); path != "" {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	if runtime.GOOS == "windows" {
+		return filepath.Join(home, "_netrc")
+	}
+	return filepath.Join(home, ".netrc")
+}
+
+// parseNetrc reads the machine entries of a .netrc file, skipping macro definitions
+func parseNetrc(data string) map[string]netrcEntry {
+	entries := make(map[string]netrcEntry)
+	machine := ""
+	inMacro := false
+	for _, line := range strings.Split(data, "\n") {
+		if inMacro {
+			// A macro ends at an empty line
+			inMacro = strings.TrimSpace(line) != ""
+			continue
+		}
+
+		fields := strings.Fields(line)
+		for i := 0; i < len(fields); i++ {
+			token := fields[i]
+			if strings.HasPrefix(token, "#") {
+				break
+			}
+
+			var value string
+			if i+1 < len(fields) {
+				value = fields[i+1]
+			}
+			switch token {
+			case "machine":
+				machine = strings.ToLower(value)
+				i++
+			case "default":
+				machine = ""
+			case "login", "password", "account":
+				i++
+				if machine == "" {
+					continue
+				}
+				entry := entries[machine]
+				switch token {
+				case "login":
+					entry.login = value
+				case "password":
+					entry.password = value
+				}
+				entries[machine] = entry
+			case "macdef":
+				inMacro = true
+				i = len(fields)
+			}
+		}
+	}
+	return entries
+}
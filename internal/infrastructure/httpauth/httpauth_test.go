@@ -0,0 +1,115 @@
+package httpauth
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/miorlan/openapi-bundler/internal/domain"
+)
+
+func TestCredentials_Apply(t *testing.T) {
+	t.Setenv("REGISTRY_TOKEN", "secret")
+	t.Setenv("GIT_TOKEN", "git-secret")
+	t.Setenv("CORP_PASSWORD", "pass")
+
+	credentials := New(domain.AuthConfig{Hosts: []domain.HostAuth{
+		{Host: "registry.example.com", TokenEnv: "REGISTRY_TOKEN"},
+		{Host: "git.example.com:8443", Headers: map[string]string{"PRIVATE-TOKEN": "${GIT_TOKEN}"}},
+		{Host: "*.corp.example.com", Username: "ci", PasswordEnv: "CORP_PASSWORD"},
+	}})
+
+	tests := []struct {
+		url    string
+		header string
+		want   string
+	}{
+		{url: "https://registry.example.com/pet.yaml", header: "Authorization", want: "Bearer secret"},
+		{url: "https://REGISTRY.example.com/pet.yaml", header: "Authorization", want: "Bearer secret"},
+		{url: "https://git.example.com:8443/raw/pet.yaml", header: "Private-Token", want: "git-secret"},
+		{url: "https://git.example.com/raw/pet.yaml", header: "Private-Token", want: ""},
+		{url: "https://specs.corp.example.com/pet.yaml", header: "Authorization", want: "Basic Y2k6cGFzcw=="},
+		{url: "https://corp.example.com/pet.yaml", header: "Authorization", want: ""},
+		{url: "https://evil.com/registry.example.com", header: "Authorization", want: ""},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(http.MethodGet, tt.url, nil)
+		if err := credentials.Apply(req); err != nil {
+			t.Fatalf("Apply(%s) error = %v", tt.url, err)
+		}
+		if got := req.Header.Get(tt.header); got != tt.want {
+			t.Errorf("Apply(%s) %s = %q, want %q", tt.url, tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestCredentials_MissingEnv(t *testing.T) {
+	credentials := New(domain.AuthConfig{Hosts: []domain.HostAuth{
+		{Host: "registry.example.com", TokenEnv: "OPENAPI_BUNDLER_UNSET_TOKEN"},
+	}})
+	req, _ := http.NewRequest(http.MethodGet, "https://registry.example.com/pet.yaml", nil)
+	err := credentials.Apply(req)
+	if err == nil || !strings.Contains(err.Error(), "OPENAPI_BUNDLER_UNSET_TOKEN") {
+		t.Errorf("Apply() error = %v, want the missing variable named", err)
+	}
+}
+
+func TestCredentials_Netrc(t *testing.T) {
+	netrc := filepath.Join(t.TempDir(), ".netrc")
+	content := `# shared registry
+machine registry.example.com
+  login ci
+  password pass
+
+macdef init
+machine ignored.example.com login x password y
+
+default login anyone password anything
+`
+	if err := os.WriteFile(netrc, []byte(content), 0600); err != nil {
+		t.Fatalf("Failed to write netrc: %v", err)
+	}
+
+	credentials := New(domain.AuthConfig{Netrc: true, NetrcFile: netrc})
+	for url, want := range map[string]string{
+		"https://registry.example.com:8443/pet.yaml": "Basic Y2k6cGFzcw==",
+		"https://ignored.example.com/pet.yaml":       "",
+		"https://other.example.com/pet.yaml":         "",
+	} {
+		req, _ := http.NewRequest(http.MethodGet, url, nil)
+		if err := credentials.Apply(req); err != nil {
+			t.Fatalf("Apply(%s) error = %v", url, err)
+		}
+		if got := req.Header.Get("Authorization"); got != want {
+			t.Errorf("Apply(%s) Authorization = %q, want %q", url, got, want)
+		}
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "auth.yaml")
+	content := `hosts:
+  - host: registry.example.com
+    tokenEnv: REGISTRY_TOKEN
+  - host: git.example.com
+    headers:
+      PRIVATE-TOKEN: ${GIT_TOKEN}
+netrcFile: /etc/netrc
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	if len(config.Hosts) != 2 || config.Hosts[0].TokenEnv != "REGISTRY_TOKEN" || config.Hosts[1].Headers["PRIVATE-TOKEN"] != "${GIT_TOKEN}" {
+		t.Errorf("LoadConfig() hosts = %+v", config.Hosts)
+	}
+	if !config.Netrc || config.NetrcFile != "/etc/netrc" {
+		t.Errorf("LoadConfig() netrc = %v %q, want true /etc/netrc", config.Netrc, config.NetrcFile)
+	}
+}
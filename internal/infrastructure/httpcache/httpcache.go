@@ -0,0 +1,123 @@
+// Package httpcache stores remote files on disk between runs. Entries are keyed by URL
+// and keep the ETag and Last-Modified validators the server sent, so a stale entry can
+// be revalidated with a conditional request instead of downloaded again.
+package httpcache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Entry is a cached response
+type Entry struct {
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"lastModified,omitempty"`
+	FetchedAt    time.Time `json:"fetchedAt"`
+	Body         []byte    `json:"body"`
+}
+
+// Cache is an on-disk cache of remote files
+type Cache struct {
+	dir string
+	ttl time.Duration
+	now func() time.Time
+}
+
+// New creates a cache in dir. Entries younger than ttl are used without asking the
+// server; older ones are revalidated. A ttl of 0 revalidates every entry.
+func New(dir string, ttl time.Duration) *Cache {
+	return &Cache{dir: dir, ttl: ttl, now: time.Now}
+}
+
+// DefaultDir returns the cache directory under the user's cache directory
+func DefaultDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate the user cache directory: %w", err)
+	}
+	return filepath.Join(dir, "openapi-bundler", "http"), nil
+}
+
+// Dir returns the directory the cache is stored in
+func (c *Cache) Dir() string {
+	return c.dir
+}
+
+// Get returns the entry cached for url
+func (c *Cache) Get(url string) (*Entry, bool) {
+	data, err := os.ReadFile(c.path(url))
+	if err != nil {
+		return nil, false
+	}
+	var entry Entry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		// A corrupt entry is a miss; the next Put replaces it
+		return nil, false
+	}
+	return &entry, true
+}
+
+// Fresh reports whether entry can be used without revalidation
+func (c *Cache) Fresh(entry *Entry) bool {
+	return c.ttl > 0 && c.now().Sub(entry.FetchedAt) < c.ttl
+}
+
+// Put stores entry for url, fetched now. The entry is written to a temporary file and
+// renamed, so concurrent runs never read a partial entry.
+func (c *Cache) Put(url string, entry *Entry) error {
+	entry.FetchedAt = c.now()
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode cache entry: %w", err)
+	}
+
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(c.dir, "*.entry.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), c.path(url)); err != nil {
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	return nil
+}
+
+// Clean removes every entry. Only entry files are removed, so a cache directory that
+// holds other files keeps them.
+func (c *Cache) Clean() error {
+	for _, pattern := range []string{"*.entry", "*.entry.tmp"} {
+		files, err := filepath.Glob(filepath.Join(c.dir, pattern))
+		if err != nil {
+			return fmt.Errorf("failed to clean cache: %w", err)
+		}
+		for _, file := range files {
+			if err := os.Remove(file); err != nil {
+				return fmt.Errorf("failed to clean cache: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// path names the entry file after a hash of the URL, which keeps credentials in query
+// strings out of file names
+func (c *Cache) path(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:])+".entry")
+}
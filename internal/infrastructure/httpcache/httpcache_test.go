@@ -0,0 +1,66 @@
+package httpcache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCache_PutGetFresh(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	cache := New(t.TempDir(), 10*time.Minute)
+	cache.now = func() time.Time { return now }
+
+	if _, ok := cache.Get("https://example.com/pet.yaml"); ok {
+		t.Fatal("Get() on an empty cache should miss")
+	}
+	if err := cache.Put("https://example.com/pet.yaml", &Entry{ETag: `"v1"`, Body: []byte("type: object")}); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+
+	entry, ok := cache.Get("https://example.com/pet.yaml")
+	if !ok || entry.ETag != `"v1"` || string(entry.Body) != "type: object" {
+		t.Fatalf("Get() = %+v, %v", entry, ok)
+	}
+	if _, ok := cache.Get("https://example.com/pet.yaml?v=2"); ok {
+		t.Error("Get() should key entries by the full URL")
+	}
+
+	if !cache.Fresh(entry) {
+		t.Error("Fresh() = false for an entry within the TTL")
+	}
+	now = now.Add(10 * time.Minute)
+	if cache.Fresh(entry) {
+		t.Error("Fresh() = true for an entry older than the TTL")
+	}
+	if New(cache.dir, 0).Fresh(entry) {
+		t.Error("Fresh() = true with a TTL of 0")
+	}
+}
+
+func TestCache_Clean(t *testing.T) {
+	dir := t.TempDir()
+	other := filepath.Join(dir, "notes.txt")
+	if err := os.WriteFile(other, []byte("keep"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	cache := New(dir, 0)
+	if err := cache.Put("https://example.com/pet.yaml", &Entry{Body: []byte("a")}); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	if err := cache.Clean(); err != nil {
+		t.Fatalf("Clean() error = %v", err)
+	}
+
+	if _, ok := cache.Get("https://example.com/pet.yaml"); ok {
+		t.Error("Clean() should remove entries")
+	}
+	if _, err := os.Stat(other); err != nil {
+		t.Errorf("Clean() should keep other files: %v", err)
+	}
+	if err := New(filepath.Join(dir, "missing"), 0).Clean(); err != nil {
+		t.Errorf("Clean() of a missing directory error = %v", err)
+	}
+}
@@ -12,11 +12,36 @@ import (
 	"time"
 
 	"github.com/miorlan/openapi-bundler/internal/domain"
+	"github.com/miorlan/openapi-bundler/internal/infrastructure/httpauth"
+	"github.com/miorlan/openapi-bundler/internal/infrastructure/httpcache"
+	"github.com/miorlan/openapi-bundler/internal/infrastructure/uri"
+	"github.com/miorlan/openapi-bundler/internal/infrastructure/vendored"
 )
 
 type FileLoader struct {
-	client *http.Client
-	sem    chan struct{}
+	client  *http.Client
+	sem     chan struct{}
+	cache   *httpcache.Cache
+	offline *vendored.Store
+	auth    *httpauth.Credentials
+	schemes map[string]domain.SchemeHandler
+}
+
+// Options configures a FileLoader
+type Options struct {
+	// Timeout limits each HTTP request
+	Timeout time.Duration
+	// MaxConcurrent limits the files LoadMany loads at the same time
+	MaxConcurrent int
+	// Cache keeps remote files between runs; nil disables it
+	Cache *httpcache.Cache
+	// Offline serves remote files from a vendor directory instead of the network
+	Offline *vendored.Store
+	// Auth adds per-host credentials to HTTP requests and their redirects
+	Auth *httpauth.Credentials
+	// Schemes handle URIs by scheme name, next to the built-in http, https and data
+	// schemes, which they may replace
+	Schemes map[string]domain.SchemeHandler
 }
 
 const defaultMaxConcurrent = 10
@@ -30,45 +55,113 @@ func NewFileLoaderWithTimeout(timeout time.Duration) domain.FileLoader {
 }
 
 func NewFileLoaderWithTimeoutAndConcurrency(timeout time.Duration, maxConcurrent int) domain.FileLoader {
-	if maxConcurrent <= 0 {
-		maxConcurrent = defaultMaxConcurrent
+	return NewFileLoaderWithOptions(Options{Timeout: timeout, MaxConcurrent: maxConcurrent})
+}
+
+func NewFileLoaderWithOptions(opts Options) domain.FileLoader {
+	if opts.MaxConcurrent <= 0 {
+		opts.MaxConcurrent = defaultMaxConcurrent
+	}
+	client := &http.Client{
+		Timeout: opts.Timeout,
+	}
+	if opts.Auth != nil {
+		client.CheckRedirect = opts.Auth.CheckRedirect
+	}
+	fl := &FileLoader{
+		client:  client,
+		sem:     make(chan struct{}, opts.MaxConcurrent),
+		cache:   opts.Cache,
+		offline: opts.Offline,
+		auth:    opts.Auth,
+	}
+	fl.schemes = map[string]domain.SchemeHandler{
+		"http":  domain.SchemeHandlerFunc(fl.loadRemote),
+		"https": domain.SchemeHandlerFunc(fl.loadRemote),
+		"data":  domain.SchemeHandlerFunc(loadData),
 	}
-	return &FileLoader{
-		client: &http.Client{
-			Timeout: timeout,
-		},
-		sem: make(chan struct{}, maxConcurrent),
+	for scheme, handler := range opts.Schemes {
+		fl.schemes[strings.ToLower(scheme)] = handler
 	}
+	return fl
 }
 
+// Load reads a local file, or a URI through the handler of its scheme
 func (fl *FileLoader) Load(ctx context.Context, path string) ([]byte, error) {
 	if ctx.Err() != nil {
 		return nil, ctx.Err()
 	}
 
-	if !strings.HasPrefix(path, "http://") && !strings.HasPrefix(path, "https://") {
-		cleanPath := filepath.Clean(path)
-		if !filepath.IsAbs(cleanPath) {
-			absPath, err := filepath.Abs(cleanPath)
-			if err != nil {
-				return nil, fmt.Errorf("invalid path: %w", err)
-			}
-			cleanPath = absPath
+	if uri.IsURI(path) {
+		scheme := uri.Scheme(path)
+		handler, ok := fl.schemes[scheme]
+		if !ok {
+			return nil, fmt.Errorf("no handler for URI scheme %q: %s", scheme, path)
 		}
-		path = cleanPath
+		return handler.Load(ctx, path)
 	}
 
-	if strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://") {
-		return fl.loadHTTP(ctx, path)
+	cleanPath := filepath.Clean(uri.LocalPath(path))
+	if !filepath.IsAbs(cleanPath) {
+		absPath, err := filepath.Abs(cleanPath)
+		if err != nil {
+			return nil, fmt.Errorf("invalid path: %w", err)
+		}
+		cleanPath = absPath
 	}
-	return os.ReadFile(path)
+	return os.ReadFile(cleanPath)
 }
 
+// Exists reports whether a local file exists, or a URI whose scheme handler can check
+// it. Remote files are not checked.
+func (fl *FileLoader) Exists(path string) bool {
+	if uri.IsURI(path) {
+		checker, ok := fl.schemes[uri.Scheme(path)].(domain.FileChecker)
+		return ok && checker.Exists(path)
+	}
+	info, err := os.Stat(uri.LocalPath(path))
+	return err == nil && !info.IsDir()
+}
+
+// loadRemote serves http and https URLs from the vendor directory in offline mode,
+// from the network otherwise
+func (fl *FileLoader) loadRemote(ctx context.Context, url string) ([]byte, error) {
+	if fl.offline != nil {
+		return fl.offline.Load(url)
+	}
+	return fl.loadHTTP(ctx, url)
+}
+
+// loadHTTP fetches url. With a cache, a fresh entry is returned as is and a stale one
+// is revalidated with If-None-Match/If-Modified-Since; a 304 keeps the cached body.
 func (fl *FileLoader) loadHTTP(ctx context.Context, url string) ([]byte, error) {
+	var cached *httpcache.Entry
+	if fl.cache != nil {
+		if entry, ok := fl.cache.Get(url); ok {
+			if fl.cache.Fresh(entry) {
+				return entry.Body, nil
+			}
+			cached = entry
+		}
+	}
+
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
+	if fl.auth != nil {
+		if err := fl.auth.Apply(req); err != nil {
+			return nil, err
+		}
+	}
+	if cached != nil {
+		if cached.ETag != "" {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
 
 	resp, err := fl.client.Do(req)
 	if err != nil {
@@ -76,6 +169,11 @@ func (fl *FileLoader) loadHTTP(ctx context.Context, url string) ([]byte, error)
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		// The cache only saves work, so failing to refresh the entry is not an error
+		_ = fl.cache.Put(url, cached)
+		return cached.Body, nil
+	}
 	if resp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("HTTP error: %d %s", resp.StatusCode, resp.Status)
 	}
@@ -85,9 +183,19 @@ func (fl *FileLoader) loadHTTP(ctx context.Context, url string) ([]byte, error)
 		return nil, fmt.Errorf("failed to read HTTP response: %w", err)
 	}
 
+	if fl.cache != nil {
+		_ = fl.cache.Put(url, &httpcache.Entry{
+			ETag:         resp.Header.Get("ETag"),
+			LastModified: resp.Header.Get("Last-Modified"),
+			Body:         data,
+		})
+	}
+
 	return data, nil
 }
 
+// LoadMany loads files concurrently, at most maxConcurrent at a time. It returns the
+// files that loaded, keyed by path, along with the first error.
 func (fl *FileLoader) LoadMany(ctx context.Context, paths []string) (map[string][]byte, error) {
 	if len(paths) == 0 {
 		return make(map[string][]byte), nil
@@ -132,7 +240,7 @@ func (fl *FileLoader) LoadMany(ctx context.Context, paths []string) (map[string]
 	close(errCh)
 
 	if len(errCh) > 0 {
-		return nil, <-errCh
+		return results, <-errCh
 	}
 
 	return results, nil
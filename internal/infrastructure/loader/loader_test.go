@@ -2,9 +2,18 @@ package loader
 
 import (
 	"context"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/miorlan/openapi-bundler/internal/domain"
+	"github.com/miorlan/openapi-bundler/internal/infrastructure/httpauth"
+	"github.com/miorlan/openapi-bundler/internal/infrastructure/httpcache"
 )
 
 func TestFileLoader_Load_LocalFile(t *testing.T) {
@@ -29,6 +38,28 @@ func TestFileLoader_Load_LocalFile(t *testing.T) {
 	}
 }
 
+func TestFileLoader_Load_FileURI(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "test file.yaml")
+	content := []byte("test content")
+
+	if err := os.WriteFile(testFile, content, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	loader := NewFileLoader()
+	ctx := context.Background()
+
+	data, err := loader.Load(ctx, "file://"+filepath.ToSlash(testFile))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	if string(data) != string(content) {
+		t.Errorf("Load() = %v, want %v", string(data), string(content))
+	}
+}
+
 func TestFileLoader_Load_FileNotFound(t *testing.T) {
 	loader := NewFileLoader()
 	ctx := context.Background()
@@ -85,3 +116,171 @@ func TestFileLoader_Load_PathTraversal(t *testing.T) {
 		t.Error("Load() should protect against path traversal")
 	}
 }
+
+func TestFileLoader_LoadMany_PartialResults(t *testing.T) {
+	tmpDir := t.TempDir()
+	existing := filepath.Join(tmpDir, "a.yaml")
+	if err := os.WriteFile(existing, []byte("a"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	missing := filepath.Join(tmpDir, "missing.yaml")
+
+	loader := NewFileLoaderWithTimeoutAndConcurrency(time.Second, 2).(domain.BatchFileLoader)
+	files, err := loader.LoadMany(context.Background(), []string{existing, missing})
+	if err == nil {
+		t.Error("LoadMany() expected error for the missing file")
+	}
+	if string(files[existing]) != "a" || len(files) != 1 {
+		t.Errorf("LoadMany() = %v, want only %s", files, existing)
+	}
+}
+
+func TestFileLoader_HTTPCacheRevalidation(t *testing.T) {
+	var fetches, notModified int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		fetches++
+		_, _ = w.Write([]byte("type: object"))
+	}))
+	defer server.Close()
+
+	cacheDir := t.TempDir()
+	load := func(ttl time.Duration) {
+		t.Helper()
+		loader := NewFileLoaderWithOptions(Options{Timeout: time.Second, Cache: httpcache.New(cacheDir, ttl)})
+		data, err := loader.Load(context.Background(), server.URL+"/pet.yaml")
+		if err != nil {
+			t.Fatalf("Load() error = %v", err)
+		}
+		if string(data) != "type: object" {
+			t.Errorf("Load() = %q, want %q", data, "type: object")
+		}
+	}
+
+	load(0)
+	load(0)
+	if fetches != 1 || notModified != 1 {
+		t.Errorf("fetches = %d, not modified = %d, want 1 and 1", fetches, notModified)
+	}
+
+	load(time.Hour)
+	if fetches != 1 || notModified != 1 {
+		t.Errorf("a fresh entry should be used without a request: fetches = %d, not modified = %d", fetches, notModified)
+	}
+}
+
+func TestFileLoader_AuthNotSentAfterRedirect(t *testing.T) {
+	t.Setenv("SPEC_TOKEN", "secret")
+
+	var leaked string
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		leaked = r.Header.Get("Authorization") + r.Header.Get("X-Api-Key")
+		_, _ = w.Write([]byte("type: object"))
+	}))
+	defer other.Close()
+
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" || r.Header.Get("X-Api-Key") != "key-secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		http.Redirect(w, r, other.URL+"/pet.yaml", http.StatusFound)
+	}))
+	defer registry.Close()
+
+	host := strings.TrimPrefix(registry.URL, "http://")
+	loader := NewFileLoaderWithOptions(Options{
+		Timeout: time.Second,
+		Auth: httpauth.New(domain.AuthConfig{Hosts: []domain.HostAuth{
+			{Host: host, TokenEnv: "SPEC_TOKEN", Headers: map[string]string{"X-Api-Key": "key-${SPEC_TOKEN}"}},
+		}}),
+	})
+
+	data, err := loader.Load(context.Background(), registry.URL+"/pet.yaml")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if string(data) != "type: object" {
+		t.Errorf("Load() = %q", data)
+	}
+	if leaked != "" {
+		t.Errorf("credentials were sent to the redirect target: %q", leaked)
+	}
+}
+
+func TestFileLoader_Schemes(t *testing.T) {
+	t.Setenv("PET_SCHEMA", "type: object")
+
+	loader := NewFileLoaderWithOptions(Options{
+		Schemes: map[string]domain.SchemeHandler{
+			"embed": NewFSHandler(fstest.MapFS{"specs/pet.yaml": {Data: []byte("type: string")}}),
+			"env":   NewEnvHandler(),
+			"mem": domain.SchemeHandlerFunc(func(ctx context.Context, location string) ([]byte, error) {
+				return []byte(location), nil
+			}),
+		},
+	})
+
+	tests := map[string]string{
+		"data:application/yaml;base64,dHlwZTogb2JqZWN0": "type: object",
+		"data:,type:%20object":                          "type: object",
+		"env:PET_SCHEMA":                                "type: object",
+		"embed:specs/pet.yaml":                          "type: string",
+		"embed:///specs/pet.yaml":                       "type: string",
+		"MEM:pets":                                      "MEM:pets",
+	}
+	for location, want := range tests {
+		data, err := loader.Load(context.Background(), location)
+		if err != nil {
+			t.Errorf("Load(%q) error = %v", location, err)
+			continue
+		}
+		if string(data) != want {
+			t.Errorf("Load(%q) = %q, want %q", location, data, want)
+		}
+	}
+
+	for _, location := range []string{"s3://bucket/pet.yaml", "env:OPENAPI_BUNDLER_UNSET", "embed:specs/missing.yaml", "data:no-comma"} {
+		if _, err := loader.Load(context.Background(), location); err == nil {
+			t.Errorf("Load(%q) expected error", location)
+		}
+	}
+	// env: is only served when it is registered
+	if _, err := NewFileLoader().Load(context.Background(), "env:PET_SCHEMA"); err == nil {
+		t.Error("Load(env:PET_SCHEMA) without an env handler expected error")
+	}
+}
+
+func TestFileLoader_Exists(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "pet.yaml")
+	if err := os.WriteFile(testFile, []byte("type: object"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	loader := NewFileLoaderWithOptions(Options{
+		Schemes: map[string]domain.SchemeHandler{
+			"embed": NewFSHandler(fstest.MapFS{"specs/pet.yaml": {Data: []byte("type: string")}}),
+		},
+	}).(*FileLoader)
+
+	tests := map[string]bool{
+		testFile:                        true,
+		tmpDir:                          false,
+		filepath.Join(tmpDir, "x.yaml"): false,
+		"embed:specs/pet.yaml":          true,
+		"embed:specs":                   false,
+		"embed:specs/missing.yaml":      false,
+		"env:PET_SCHEMA":                false,
+	}
+	for path, want := range tests {
+		if got := loader.Exists(path); got != want {
+			t.Errorf("Exists(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
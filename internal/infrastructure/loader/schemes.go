@@ -0,0 +1,100 @@
+package loader
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/miorlan/openapi-bundler/internal/domain"
+)
+
+// NewFSHandler serves a URI scheme from fsys, such as an embed.FS. The path of the URI
+// is the path within fsys: embed:specs/pet.yaml, embed:///specs/pet.yaml and
+// embed://specs/pet.yaml all read specs/pet.yaml.
+func NewFSHandler(fsys fs.FS) domain.SchemeHandler {
+	return &fsHandler{fsys: fsys}
+}
+
+type fsHandler struct {
+	fsys fs.FS
+}
+
+func (h *fsHandler) Load(_ context.Context, location string) ([]byte, error) {
+	name, err := fsPath(location)
+	if err != nil {
+		return nil, err
+	}
+	return fs.ReadFile(h.fsys, name)
+}
+
+func (h *fsHandler) Exists(location string) bool {
+	name, err := fsPath(location)
+	if err != nil {
+		return false
+	}
+	info, err := fs.Stat(h.fsys, name)
+	return err == nil && !info.IsDir()
+}
+
+// fsPath returns the path within the FS a URI names
+func fsPath(location string) (string, error) {
+	u, err := url.Parse(location)
+	if err != nil {
+		return "", fmt.Errorf("invalid URI %s: %w", location, err)
+	}
+	name := u.Opaque
+	if name == "" {
+		name = u.Host + u.EscapedPath()
+	}
+	if name, err = url.PathUnescape(name); err != nil {
+		return "", fmt.Errorf("invalid URI %s: %w", location, err)
+	}
+	return path.Clean(strings.TrimPrefix(name, "/")), nil
+}
+
+// loadData decodes an RFC 2397 data: URI, percent-encoded or base64:
+// data:application/yaml;base64,dHlwZTogb2JqZWN0
+func loadData(_ context.Context, location string) ([]byte, error) {
+	meta, payload, ok := strings.Cut(location[len("data:"):], ",")
+	if !ok {
+		return nil, fmt.Errorf("invalid data URI: missing comma")
+	}
+	if strings.HasSuffix(strings.ToLower(meta), ";base64") {
+		payload, err := url.PathUnescape(payload)
+		if err != nil {
+			return nil, fmt.Errorf("invalid data URI: %w", err)
+		}
+		data, err := base64.StdEncoding.DecodeString(payload)
+		if err != nil {
+			return nil, fmt.Errorf("invalid data URI: %w", err)
+		}
+		return data, nil
+	}
+	data, err := url.PathUnescape(payload)
+	if err != nil {
+		return nil, fmt.Errorf("invalid data URI: %w", err)
+	}
+	return []byte(data), nil
+}
+
+// NewEnvHandler reads env:NAME URIs from environment variables. It is not built in:
+// any document, remote ones included, could copy a secret into the bundle with it.
+func NewEnvHandler() domain.SchemeHandler {
+	return domain.SchemeHandlerFunc(loadEnv)
+}
+
+// loadEnv reads a document from the environment variable an env: URI names:
+// env:PET_SCHEMA
+func loadEnv(_ context.Context, location string) ([]byte, error) {
+	name := location[len("env:"):]
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return nil, fmt.Errorf("environment variable %s is not set", name)
+	}
+	return []byte(value), nil
+}
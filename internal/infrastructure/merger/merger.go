@@ -0,0 +1,480 @@
+// Package merger combines several bundled OpenAPI 3.x documents, one per service,
+// into a single document.
+package merger
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/miorlan/openapi-bundler/internal/domain"
+	"github.com/miorlan/openapi-bundler/internal/infrastructure/pointer"
+	"github.com/miorlan/openapi-bundler/internal/infrastructure/resolver"
+	"gopkg.in/yaml.v3"
+)
+
+// httpMethods are the keys of a path item holding operations
+var httpMethods = map[string]bool{
+	"get": true, "put": true, "post": true, "delete": true,
+	"options": true, "head": true, "patch": true, "trace": true,
+}
+
+// Document is one bundled spec of a merge
+type Document struct {
+	// Root is the bundled document, without external refs
+	Root *yaml.Node
+	// Name identifies the service; clashing component names are prefixed with it
+	Name string
+	// Source is where the document was loaded from, as reported in renames and conflicts
+	Source string
+	// PathPrefix is prepended to every path of the document, like /billing
+	PathPrefix string
+}
+
+// Merger merges documents
+type Merger struct {
+	override bool
+	helper   *resolver.NodeHelper
+
+	root   *yaml.Node
+	report *domain.Report
+	// operations maps "section path method" to the source that defined the operation
+	operations map[string]string
+}
+
+// NewMerger creates a new Merger. With override, an operation defined by several
+// documents is taken from the last one instead of failing with ErrPathConflict.
+func NewMerger(override bool) *Merger {
+	return &Merger{
+		override: override,
+		helper:   &resolver.NodeHelper{},
+	}
+}
+
+// Merge combines paths, webhooks, components, tags, servers and security requirements
+// of the documents. The first document provides openapi, info and the other root keys;
+// root security requirements of the others move to their operations when they differ.
+// Components with the same name and different content are renamed with the document
+// name as prefix, BillingError, and reported. The documents are modified in place.
+func (m *Merger) Merge(docs []Document) (*yaml.Node, *domain.Report, error) {
+	if len(docs) == 0 {
+		return nil, nil, fmt.Errorf("nothing to merge")
+	}
+
+	m.report = &domain.Report{}
+	m.operations = make(map[string]string)
+	m.root = &yaml.Node{Kind: yaml.MappingNode}
+
+	for i, doc := range docs {
+		root := doc.Root
+		if root.Kind == yaml.DocumentNode && len(root.Content) > 0 {
+			root = root.Content[0]
+		}
+		if root.Kind != yaml.MappingNode || !strings.HasPrefix(m.helper.GetStringValue(m.helper.GetMapValue(root, "openapi")), "3.") {
+			return nil, nil, fmt.Errorf("%s: only OpenAPI 3.x documents can be merged", doc.Source)
+		}
+
+		if i == 0 {
+			_ = m.helper.IterateMap(root, func(key string, value *yaml.Node) error {
+				switch key {
+				case "paths", "webhooks", "components", "tags", "servers":
+					// Kept in place, filled by the merge
+					m.helper.SetMapValue(m.root, key, &yaml.Node{Kind: value.Kind})
+				default:
+					m.helper.SetMapValue(m.root, key, value)
+				}
+				return nil
+			})
+		}
+
+		if err := m.mergeDocument(root, doc); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	for _, key := range []string{"paths", "webhooks", "components", "tags", "servers", "security"} {
+		if value := m.helper.GetMapValue(m.root, key); value != nil && len(value.Content) == 0 {
+			m.helper.DeleteMapKey(m.root, key)
+		}
+	}
+	return &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{m.root}}, m.report, nil
+}
+
+// mergeDocument merges one document into the result
+func (m *Merger) mergeDocument(root *yaml.Node, doc Document) error {
+	prefix := strings.TrimSuffix(doc.PathPrefix, "/")
+	if prefix != "" && !strings.HasPrefix(prefix, "/") {
+		prefix = "/" + prefix
+	}
+
+	renames := m.planRenames(root, doc)
+	m.rewrite(root, renames, prefix)
+	m.scopeSecurity(root)
+
+	var merged *yaml.Node
+	_ = m.helper.IterateMap(m.helper.GetMapValue(root, "components"), func(section string, sectionNode *yaml.Node) error {
+		if merged == nil {
+			merged = m.section(m.root, "components", yaml.MappingNode)
+		}
+		if strings.HasPrefix(section, "x-") || sectionNode.Kind != yaml.MappingNode {
+			if m.helper.GetMapValue(merged, section) == nil {
+				m.helper.SetMapValue(merged, section, sectionNode)
+			}
+			return nil
+		}
+		target := m.section(merged, section, yaml.MappingNode)
+		return m.helper.IterateMap(sectionNode, func(name string, content *yaml.Node) error {
+			if newName, ok := renames[section+"/"+name]; ok {
+				name = newName
+			}
+			if m.helper.GetMapValue(target, name) == nil {
+				m.helper.SetMapValue(target, name, content)
+			}
+			return nil
+		})
+	})
+
+	for _, section := range []string{"paths", "webhooks"} {
+		sectionPrefix := ""
+		if section == "paths" {
+			sectionPrefix = prefix
+		}
+		if err := m.mergePathItems(root, section, sectionPrefix, doc.Source); err != nil {
+			return err
+		}
+	}
+
+	m.mergeList(root, "tags", func(node *yaml.Node) interface{} {
+		return m.helper.GetStringValue(m.helper.GetMapValue(node, "name"))
+	})
+	m.mergeList(root, "servers", func(node *yaml.Node) interface{} {
+		return m.helper.GetStringValue(m.helper.GetMapValue(node, "url"))
+	})
+	return nil
+}
+
+// scopeSecurity copies the root security requirements of a document to its operations
+// that have none when they differ from those of the merged document, so that merging
+// does not change which credentials an operation accepts
+func (m *Merger) scopeSecurity(root *yaml.Node) {
+	security := m.helper.GetMapValue(root, "security")
+	if security == nil {
+		security = &yaml.Node{Kind: yaml.SequenceNode}
+	}
+	merged := m.helper.GetMapValue(m.root, "security")
+	if merged == nil {
+		merged = &yaml.Node{Kind: yaml.SequenceNode}
+	}
+	if m.equal(security, merged) {
+		return
+	}
+
+	for _, section := range []string{"paths", "webhooks"} {
+		_ = m.helper.IterateMap(m.helper.GetMapValue(root, section), func(_ string, item *yaml.Node) error {
+			return m.helper.IterateMap(item, func(method string, operation *yaml.Node) error {
+				if httpMethods[method] && m.helper.GetMapValue(operation, "security") == nil {
+					m.helper.SetMapValue(operation, "security", m.helper.CloneNode(security))
+				}
+				return nil
+			})
+		})
+	}
+}
+
+// planRenames picks a new name for every component whose name is taken by a different
+// component of the merged documents. Renames change refs, so the content is compared
+// with the renames made so far applied, until no more names clash.
+func (m *Merger) planRenames(root *yaml.Node, doc Document) map[string]string {
+	renames := make(map[string]string)
+	claimed := make(map[string]bool)
+	merged := m.helper.GetMapValue(m.root, "components")
+
+	for changed := true; changed; {
+		changed = false
+		_ = m.helper.IterateMap(m.helper.GetMapValue(root, "components"), func(section string, sectionNode *yaml.Node) error {
+			if strings.HasPrefix(section, "x-") || sectionNode.Kind != yaml.MappingNode {
+				return nil
+			}
+			mergedSection := m.helper.GetMapValue(merged, section)
+			return m.helper.IterateMap(sectionNode, func(name string, content *yaml.Node) error {
+				if _, ok := renames[section+"/"+name]; ok {
+					return nil
+				}
+				existing := m.helper.GetMapValue(mergedSection, name)
+				if existing == nil || m.equal(existing, m.renamed(content, renames)) {
+					return nil
+				}
+
+				base := resolver.PascalCase(doc.Name) + name
+				candidate := base
+				for i := 2; ; i++ {
+					taken := m.helper.GetMapValue(mergedSection, candidate)
+					if !claimed[section+"/"+candidate] && m.helper.GetMapValue(sectionNode, candidate) == nil &&
+						(taken == nil || m.equal(taken, m.renamed(content, renames))) {
+						break
+					}
+					candidate = base + strconv.Itoa(i)
+				}
+				renames[section+"/"+name] = candidate
+				claimed[section+"/"+candidate] = true
+				changed = true
+				m.report.Renames = append(m.report.Renames, domain.ComponentRename{Type: section, From: name, To: candidate, Source: doc.Source})
+				return nil
+			})
+		})
+	}
+	return renames
+}
+
+// renamed returns a copy of content with refs to renamed components rewritten
+func (m *Merger) renamed(content *yaml.Node, renames map[string]string) *yaml.Node {
+	if len(renames) == 0 {
+		return content
+	}
+	clone := m.helper.CloneNode(content)
+	m.rewrite(clone, renames, "")
+	return clone
+}
+
+// rewrite points refs, security requirements and discriminator mappings at renamed
+// components and link operationRefs at prefixed paths
+func (m *Merger) rewrite(node *yaml.Node, renames map[string]string, prefix string) {
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i].Value, node.Content[i+1]
+			switch {
+			case (key == "$ref" || key == "$dynamicRef" || key == "operationRef") && value.Kind == yaml.ScalarNode:
+				value.Value = rewriteRef(value.Value, renames, prefix)
+				continue
+			case key == "security" && value.Kind == yaml.SequenceNode:
+				for _, requirement := range value.Content {
+					if requirement.Kind != yaml.MappingNode {
+						continue
+					}
+					for j := 0; j < len(requirement.Content); j += 2 {
+						if newName, ok := renames["securitySchemes/"+requirement.Content[j].Value]; ok {
+							requirement.Content[j].Value = newName
+						}
+					}
+				}
+			case key == "discriminator":
+				_ = m.helper.IterateMap(m.helper.GetMapValue(value, "mapping"), func(_ string, target *yaml.Node) error {
+					if newName, ok := renames["schemas/"+target.Value]; ok {
+						target.Value = newName
+					} else {
+						target.Value = rewriteRef(target.Value, renames, prefix)
+					}
+					return nil
+				})
+			}
+			m.rewrite(value, renames, prefix)
+		}
+	case yaml.SequenceNode:
+		for _, child := range node.Content {
+			m.rewrite(child, renames, prefix)
+		}
+	}
+}
+
+// rewriteRef rewrites an internal ref to a renamed component or a prefixed path
+func rewriteRef(ref string, renames map[string]string, prefix string) string {
+	if !strings.HasPrefix(ref, "#/") {
+		return ref
+	}
+	tokens, err := pointer.Parse(ref)
+	if err != nil {
+		return ref
+	}
+	switch {
+	case len(tokens) >= 3 && tokens[0] == "components":
+		newName, ok := renames[tokens[1]+"/"+tokens[2]]
+		if !ok {
+			return ref
+		}
+		tokens[2] = newName
+	case len(tokens) >= 2 && tokens[0] == "paths" && prefix != "":
+		tokens[1] = prefix + tokens[1]
+	default:
+		return ref
+	}
+	return pointer.Format(tokens...)
+}
+
+// mergePathItems adds the path items of a section, merging those defined by several
+// documents operation by operation
+func (m *Merger) mergePathItems(root *yaml.Node, section, prefix, source string) error {
+	items := m.helper.GetMapValue(root, section)
+	if items == nil || items.Kind != yaml.MappingNode {
+		return nil
+	}
+	merged := m.section(m.root, section, yaml.MappingNode)
+
+	for i := 0; i+1 < len(items.Content); i += 2 {
+		key, item := items.Content[i].Value, items.Content[i+1]
+		if !strings.HasPrefix(key, "x-") {
+			key = prefix + key
+		}
+
+		existing := m.helper.GetMapValue(merged, key)
+		if existing == nil {
+			m.helper.SetMapValue(merged, key, item)
+			m.recordOperations(section, key, item, source)
+			continue
+		}
+		if strings.HasPrefix(key, "x-") {
+			continue
+		}
+
+		// Both documents define the path: merge into a copy of the first path item
+		existing = m.pathItem(existing)
+		m.helper.SetMapValue(merged, key, existing)
+		item = m.pathItem(item)
+		m.scopePathFields(existing, item)
+		for j := 0; j+1 < len(item.Content); j += 2 {
+			field, value := item.Content[j].Value, item.Content[j+1]
+			if httpMethods[field] {
+				id := section + " " + key + " " + field
+				if first, ok := m.operations[id]; ok && !m.override {
+					return &domain.ErrPathConflict{Path: key, Method: field, Sources: []string{first, source}}
+				}
+				m.operations[id] = source
+			} else if m.helper.GetMapValue(existing, field) != nil && !m.override {
+				continue
+			}
+			m.helper.SetMapValue(existing, field, value)
+		}
+	}
+	return nil
+}
+
+// pathFields are the path item fields that apply to every operation of the path
+var pathFields = []string{"parameters", "servers"}
+
+// scopePathFields moves the path fields of two path items defined for the same path
+// down to their own operations when they differ, so that merging does not change the
+// parameters and servers of an operation
+func (m *Merger) scopePathFields(existing, item *yaml.Node) {
+	for _, field := range pathFields {
+		a, b := m.helper.GetMapValue(existing, field), m.helper.GetMapValue(item, field)
+		if a == nil && b == nil || a != nil && b != nil && m.equal(a, b) {
+			continue
+		}
+		m.pushDown(existing, field)
+		m.pushDown(item, field)
+	}
+}
+
+// pushDown moves a path field of a path item to its operations. Operation parameters
+// override path parameters with the same name and location; operation servers replace
+// path servers.
+func (m *Merger) pushDown(item *yaml.Node, field string) {
+	value := m.helper.GetMapValue(item, field)
+	if value == nil {
+		return
+	}
+	_ = m.helper.IterateMap(item, func(method string, operation *yaml.Node) error {
+		if !httpMethods[method] || operation.Kind != yaml.MappingNode {
+			return nil
+		}
+		own := m.helper.GetMapValue(operation, field)
+		switch {
+		case own == nil:
+			m.helper.SetMapValue(operation, field, m.helper.CloneNode(value))
+		case field == "parameters" && own.Kind == yaml.SequenceNode:
+			var inherited []*yaml.Node
+			for _, param := range value.Content {
+				if !m.hasParameter(own, param) {
+					inherited = append(inherited, m.helper.CloneNode(param))
+				}
+			}
+			own.Content = append(inherited, own.Content...)
+		}
+		return nil
+	})
+	m.helper.DeleteMapKey(item, field)
+}
+
+// hasParameter reports whether params holds a parameter with the name and location of param
+func (m *Merger) hasParameter(params, param *yaml.Node) bool {
+	key := func(node *yaml.Node) string {
+		node = m.target(node)
+		return m.helper.GetStringValue(m.helper.GetMapValue(node, "in")) + " " + m.helper.GetStringValue(m.helper.GetMapValue(node, "name"))
+	}
+	for _, p := range params.Content {
+		if key(p) == key(param) {
+			return true
+		}
+	}
+	return false
+}
+
+// recordOperations remembers which document defined the operations of a path item
+func (m *Merger) recordOperations(section, key string, item *yaml.Node, source string) {
+	for _, method := range m.helper.GetMapKeys(m.pathItem(item)) {
+		if httpMethods[method] {
+			m.operations[section+" "+key+" "+method] = source
+		}
+	}
+}
+
+// pathItem returns a copy of a path item, with a ref to components.pathItems replaced
+// by the component it points to
+func (m *Merger) pathItem(item *yaml.Node) *yaml.Node {
+	return m.helper.CloneNode(m.target(item))
+}
+
+// target returns the node an internal ref of the merged document points to, or node
+// itself when it is not such a ref
+func (m *Merger) target(node *yaml.Node) *yaml.Node {
+	if ref := m.helper.GetRef(node); strings.HasPrefix(ref, "#/") {
+		if tokens, err := pointer.Parse(ref); err == nil {
+			target := m.root
+			for _, token := range tokens {
+				target = m.helper.GetMapValue(target, token)
+			}
+			if target != nil {
+				return target
+			}
+		}
+	}
+	return node
+}
+
+// mergeList appends the items of a root sequence that are not in the result yet,
+// compared by key
+func (m *Merger) mergeList(root *yaml.Node, section string, key func(node *yaml.Node) interface{}) {
+	items := m.helper.GetMapValue(root, section)
+	if items == nil || items.Kind != yaml.SequenceNode {
+		return
+	}
+	merged := m.section(m.root, section, yaml.SequenceNode)
+	for _, item := range items.Content {
+		found := false
+		for _, existing := range merged.Content {
+			if reflect.DeepEqual(key(existing), key(item)) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			merged.Content = append(merged.Content, item)
+		}
+	}
+}
+
+// section returns the value of a key of node, adding it with the given kind when missing
+func (m *Merger) section(node *yaml.Node, key string, kind yaml.Kind) *yaml.Node {
+	value := m.helper.GetMapValue(node, key)
+	if value == nil {
+		value = &yaml.Node{Kind: kind}
+		m.helper.SetMapValue(node, key, value)
+	}
+	return value
+}
+
+// equal reports whether two nodes hold the same content, regardless of key order
+func (m *Merger) equal(a, b *yaml.Node) bool {
+	return reflect.DeepEqual(m.helper.NodeToInterface(a), m.helper.NodeToInterface(b))
+}
@@ -0,0 +1,26 @@
+package merger
+
+import "testing"
+
+func TestRewriteRef(t *testing.T) {
+	renames := map[string]string{"schemas/Error": "BillingError"}
+	tests := []struct {
+		ref    string
+		prefix string
+		want   string
+	}{
+		{"#/components/schemas/Error", "", "#/components/schemas/BillingError"},
+		{"#/components/schemas/Error/properties/code", "", "#/components/schemas/BillingError/properties/code"},
+		{"#/components/schemas/Pet", "", "#/components/schemas/Pet"},
+		{"#/components/responses/Error", "", "#/components/responses/Error"},
+		{"#/paths/~1pets~1{id}/get", "/billing", "#/paths/~1billing~1pets~1{id}/get"},
+		{"#/paths/~1pets/get", "", "#/paths/~1pets/get"},
+		{"./pet.yaml#/components/schemas/Error", "", "./pet.yaml#/components/schemas/Error"},
+	}
+
+	for _, tt := range tests {
+		if got := rewriteRef(tt.ref, renames, tt.prefix); got != tt.want {
+			t.Errorf("rewriteRef(%q, %q) = %q, want %q", tt.ref, tt.prefix, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,623 @@
+package overlay
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/miorlan/openapi-bundler/internal/infrastructure/resolver"
+	"gopkg.in/yaml.v3"
+)
+
+// query is a compiled JSONPath expression (RFC 9535). Names, wildcards, indices,
+// slices, descendants and filters with comparisons, existence tests, !, && and ||
+// are supported; function extensions are not.
+type query struct {
+	segments []segment
+}
+
+// match is a node selected by a query, along with the node that contains it
+type match struct {
+	node   *yaml.Node
+	parent *yaml.Node
+}
+
+// segment is a child (.name, [...]) or descendant (..name, ..[...]) segment
+type segment struct {
+	descendant bool
+	selectors  []selector
+}
+
+type selectorKind int
+
+const (
+	selectName selectorKind = iota
+	selectWildcard
+	selectIndex
+	selectSlice
+	selectFilter
+)
+
+// selector selects children of a node
+type selector struct {
+	kind   selectorKind
+	name   string
+	index  int
+	slice  [3]*int
+	filter predicate
+}
+
+// predicate is a filter expression evaluated for a child node
+type predicate func(current, root *yaml.Node) bool
+
+// operand is a value of a filter comparison; ok is false when a query selects nothing
+type operand func(current, root *yaml.Node) (value interface{}, ok bool)
+
+var helper = &resolver.NodeHelper{}
+
+// compile parses a JSONPath expression
+func compile(path string) (*query, error) {
+	p := &pathParser{s: path}
+	if !p.consume("$") {
+		return nil, fmt.Errorf("invalid JSONPath %q: must start with $", path)
+	}
+	segments, err := p.segments()
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSONPath %q: %w", path, err)
+	}
+	if p.pos < len(p.s) {
+		return nil, fmt.Errorf("invalid JSONPath %q: unexpected %q at %d", path, p.s[p.pos:], p.pos)
+	}
+	return &query{segments: segments}, nil
+}
+
+// selectNodes returns the nodes the query selects in root, in document order, each once
+func (q *query) selectNodes(root *yaml.Node) []match {
+	if root.Kind == yaml.DocumentNode && len(root.Content) > 0 {
+		root = root.Content[0]
+	}
+	return evaluate(q.segments, []match{{node: root}}, root)
+}
+
+// evaluate applies segments to the nodes selected so far
+func evaluate(segments []segment, current []match, root *yaml.Node) []match {
+	for _, seg := range segments {
+		var next []match
+		seen := make(map[*yaml.Node]bool)
+		add := func(m match) {
+			if !seen[m.node] {
+				seen[m.node] = true
+				next = append(next, m)
+			}
+		}
+
+		for _, m := range current {
+			nodes := []*yaml.Node{m.node}
+			if seg.descendant {
+				nodes = descendants(m.node, nodes)
+			}
+			for _, node := range nodes {
+				for _, sel := range seg.selectors {
+					for _, child := range sel.apply(node, root) {
+						add(child)
+					}
+				}
+			}
+		}
+		current = next
+	}
+	return current
+}
+
+// descendants appends the nodes below node, in document order
+func descendants(node *yaml.Node, nodes []*yaml.Node) []*yaml.Node {
+	for _, child := range children(node) {
+		nodes = descendants(child, append(nodes, child))
+	}
+	return nodes
+}
+
+// children returns the values of a mapping or the items of a sequence
+func children(node *yaml.Node) []*yaml.Node {
+	switch node.Kind {
+	case yaml.MappingNode:
+		values := make([]*yaml.Node, 0, len(node.Content)/2)
+		for i := 1; i < len(node.Content); i += 2 {
+			values = append(values, node.Content[i])
+		}
+		return values
+	case yaml.SequenceNode:
+		return node.Content
+	}
+	return nil
+}
+
+// apply returns the children of node the selector selects
+func (s selector) apply(node *yaml.Node, root *yaml.Node) []match {
+	var matches []match
+	switch s.kind {
+	case selectName:
+		if value := helper.GetMapValue(node, s.name); value != nil {
+			matches = append(matches, match{node: value, parent: node})
+		}
+	case selectWildcard:
+		for _, child := range children(node) {
+			matches = append(matches, match{node: child, parent: node})
+		}
+	case selectIndex:
+		if node.Kind == yaml.SequenceNode {
+			i := s.index
+			if i < 0 {
+				i += len(node.Content)
+			}
+			if i >= 0 && i < len(node.Content) {
+				matches = append(matches, match{node: node.Content[i], parent: node})
+			}
+		}
+	case selectSlice:
+		if node.Kind == yaml.SequenceNode {
+			for _, i := range sliceIndices(s.slice, len(node.Content)) {
+				matches = append(matches, match{node: node.Content[i], parent: node})
+			}
+		}
+	case selectFilter:
+		for _, child := range children(node) {
+			if s.filter(child, root) {
+				matches = append(matches, match{node: child, parent: node})
+			}
+		}
+	}
+	return matches
+}
+
+// sliceIndices returns the indices a start:end:step slice selects from n items
+func sliceIndices(slice [3]*int, n int) []int {
+	step := 1
+	if slice[2] != nil {
+		step = *slice[2]
+	}
+	if step == 0 {
+		return nil
+	}
+	normalize := func(i int) int {
+		if i < 0 {
+			return i + n
+		}
+		return i
+	}
+	clamp := func(i, lower, upper int) int {
+		return min(max(i, lower), upper)
+	}
+
+	var indices []int
+	if step > 0 {
+		start, end := 0, n
+		if slice[0] != nil {
+			start = clamp(normalize(*slice[0]), 0, n)
+		}
+		if slice[1] != nil {
+			end = clamp(normalize(*slice[1]), 0, n)
+		}
+		for i := start; i < end; i += step {
+			indices = append(indices, i)
+		}
+		return indices
+	}
+
+	start, end := n-1, -1
+	if slice[0] != nil {
+		start = clamp(normalize(*slice[0]), -1, n-1)
+	}
+	if slice[1] != nil {
+		end = clamp(normalize(*slice[1]), -1, n-1)
+	}
+	for i := start; i > end; i += step {
+		indices = append(indices, i)
+	}
+	return indices
+}
+
+// pathParser parses JSONPath expressions
+type pathParser struct {
+	s   string
+	pos int
+}
+
+func (p *pathParser) consume(prefix string) bool {
+	if strings.HasPrefix(p.s[p.pos:], prefix) {
+		p.pos += len(prefix)
+		return true
+	}
+	return false
+}
+
+func (p *pathParser) skipSpace() {
+	for p.pos < len(p.s) && strings.IndexByte(" \t\n\r", p.s[p.pos]) >= 0 {
+		p.pos++
+	}
+}
+
+// segments parses segments until something else than . or [ follows
+func (p *pathParser) segments() ([]segment, error) {
+	var segments []segment
+	for p.pos < len(p.s) {
+		var seg segment
+		switch {
+		case p.consume(".."):
+			seg.descendant = true
+			if p.pos < len(p.s) && p.s[p.pos] == '[' {
+				selectors, err := p.bracket()
+				if err != nil {
+					return nil, err
+				}
+				seg.selectors = selectors
+			} else {
+				sel, err := p.member()
+				if err != nil {
+					return nil, err
+				}
+				seg.selectors = []selector{sel}
+			}
+		case p.consume("."):
+			sel, err := p.member()
+			if err != nil {
+				return nil, err
+			}
+			seg.selectors = []selector{sel}
+		case p.s[p.pos] == '[':
+			selectors, err := p.bracket()
+			if err != nil {
+				return nil, err
+			}
+			seg.selectors = selectors
+		default:
+			return segments, nil
+		}
+		segments = append(segments, seg)
+	}
+	return segments, nil
+}
+
+// member parses the name or * after a dot
+func (p *pathParser) member() (selector, error) {
+	if p.consume("*") {
+		return selector{kind: selectWildcard}, nil
+	}
+	start := p.pos
+	for p.pos < len(p.s) {
+		r, size := utf8.DecodeRuneInString(p.s[p.pos:])
+		if !(r == '_' || r == '-' || r == '$' || r >= 0x80 || 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9') {
+			break
+		}
+		p.pos += size
+	}
+	if p.pos == start {
+		return selector{}, fmt.Errorf("expected a name at %d", start)
+	}
+	return selector{kind: selectName, name: p.s[start:p.pos]}, nil
+}
+
+// bracket parses a [...] list of selectors
+func (p *pathParser) bracket() ([]selector, error) {
+	p.pos++ // [
+	var selectors []selector
+	for {
+		p.skipSpace()
+		sel, err := p.selector()
+		if err != nil {
+			return nil, err
+		}
+		selectors = append(selectors, sel)
+		p.skipSpace()
+		switch {
+		case p.consume(","):
+			continue
+		case p.consume("]"):
+			return selectors, nil
+		default:
+			return nil, fmt.Errorf("expected , or ] at %d", p.pos)
+		}
+	}
+}
+
+// selector parses one selector of a bracket
+func (p *pathParser) selector() (selector, error) {
+	if p.pos >= len(p.s) {
+		return selector{}, fmt.Errorf("unexpected end")
+	}
+	switch c := p.s[p.pos]; {
+	case c == '*':
+		p.pos++
+		return selector{kind: selectWildcard}, nil
+	case c == '\'' || c == '"':
+		name, err := p.stringLiteral()
+		return selector{kind: selectName, name: name}, err
+	case c == '?':
+		p.pos++
+		filter, err := p.or()
+		return selector{kind: selectFilter, filter: filter}, err
+	default:
+		return p.indexOrSlice()
+	}
+}
+
+// indexOrSlice parses an index like -1 or a slice like 1:5:2
+func (p *pathParser) indexOrSlice() (selector, error) {
+	var parts [3]*int
+	colons := 0
+	for {
+		p.skipSpace()
+		if n, ok := p.integer(); ok {
+			parts[colons] = &n
+		}
+		p.skipSpace()
+		if colons == 2 || !p.consume(":") {
+			break
+		}
+		colons++
+	}
+	if colons > 0 {
+		return selector{kind: selectSlice, slice: parts}, nil
+	}
+	if parts[0] == nil {
+		return selector{}, fmt.Errorf("invalid selector at %d", p.pos)
+	}
+	return selector{kind: selectIndex, index: *parts[0]}, nil
+}
+
+// integer parses an optionally negative integer
+func (p *pathParser) integer() (int, bool) {
+	start := p.pos
+	p.consume("-")
+	for p.pos < len(p.s) && '0' <= p.s[p.pos] && p.s[p.pos] <= '9' {
+		p.pos++
+	}
+	n, err := strconv.Atoi(p.s[start:p.pos])
+	if err != nil {
+		p.pos = start
+		return 0, false
+	}
+	return n, true
+}
+
+// stringLiteral parses a quoted name or string
+func (p *pathParser) stringLiteral() (string, error) {
+	quote := p.s[p.pos]
+	p.pos++
+	var b strings.Builder
+	for p.pos < len(p.s) {
+		c := p.s[p.pos]
+		p.pos++
+		switch {
+		case c == quote:
+			return b.String(), nil
+		case c == '\\' && p.pos < len(p.s):
+			escaped := p.s[p.pos]
+			p.pos++
+			switch escaped {
+			case 'b':
+				b.WriteByte('\b')
+			case 'f':
+				b.WriteByte('\f')
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			case 'u':
+				if p.pos+4 > len(p.s) {
+					return "", fmt.Errorf("invalid escape at %d", p.pos)
+				}
+				code, err := strconv.ParseUint(p.s[p.pos:p.pos+4], 16, 32)
+				if err != nil {
+					return "", fmt.Errorf("invalid escape at %d", p.pos)
+				}
+				b.WriteRune(rune(code))
+				p.pos += 4
+			default:
+				b.WriteByte(escaped)
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", fmt.Errorf("unterminated string")
+}
+
+// or parses a filter expression: a || b
+func (p *pathParser) or() (predicate, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.skipSpace(); p.consume("||"); p.skipSpace() {
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(current, root *yaml.Node) bool { return l(current, root) || right(current, root) }
+	}
+	return left, nil
+}
+
+// and parses a && b
+func (p *pathParser) and() (predicate, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for p.skipSpace(); p.consume("&&"); p.skipSpace() {
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(current, root *yaml.Node) bool { return l(current, root) && right(current, root) }
+	}
+	return left, nil
+}
+
+// unary parses !a, (a) and comparisons or existence tests
+func (p *pathParser) unary() (predicate, error) {
+	p.skipSpace()
+	if p.consume("!") {
+		inner, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return func(current, root *yaml.Node) bool { return !inner(current, root) }, nil
+	}
+	if p.consume("(") {
+		inner, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		if !p.consume(")") {
+			return nil, fmt.Errorf("expected ) at %d", p.pos)
+		}
+		return inner, nil
+	}
+
+	left, isQuery, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	for _, op := range []string{"==", "!=", "<=", ">=", "<", ">"} {
+		if !p.consume(op) {
+			continue
+		}
+		p.skipSpace()
+		right, _, err := p.operand()
+		if err != nil {
+			return nil, err
+		}
+		return func(current, root *yaml.Node) bool {
+			a, aok := left(current, root)
+			b, bok := right(current, root)
+			return compare(op, a, aok, b, bok)
+		}, nil
+	}
+	if !isQuery {
+		return nil, fmt.Errorf("expected a comparison at %d", p.pos)
+	}
+	return func(current, root *yaml.Node) bool {
+		_, ok := left(current, root)
+		return ok
+	}, nil
+}
+
+// operand parses a literal or a @ or $ query
+func (p *pathParser) operand() (operand, bool, error) {
+	if p.pos >= len(p.s) {
+		return nil, false, fmt.Errorf("unexpected end")
+	}
+	switch c := p.s[p.pos]; {
+	case c == '@' || c == '$':
+		p.pos++
+		segments, err := p.segments()
+		if err != nil {
+			return nil, false, err
+		}
+		relative := c == '@'
+		return func(current, root *yaml.Node) (interface{}, bool) {
+			start := root
+			if relative {
+				start = current
+			}
+			matches := evaluate(segments, []match{{node: start}}, root)
+			if len(matches) == 0 {
+				return nil, false
+			}
+			return helper.NodeToInterface(matches[0].node), true
+		}, true, nil
+	case c == '\'' || c == '"':
+		s, err := p.stringLiteral()
+		return literal(s), false, err
+	case p.consume("true"):
+		return literal(true), false, nil
+	case p.consume("false"):
+		return literal(false), false, nil
+	case p.consume("null"):
+		return literal(nil), false, nil
+	default:
+		start := p.pos
+		for p.pos < len(p.s) && strings.IndexByte("+-.0123456789eE", p.s[p.pos]) >= 0 {
+			p.pos++
+		}
+		n, err := strconv.ParseFloat(p.s[start:p.pos], 64)
+		if err != nil {
+			return nil, false, fmt.Errorf("invalid literal at %d", start)
+		}
+		return literal(n), false, nil
+	}
+}
+
+func literal(value interface{}) operand {
+	return func(_, _ *yaml.Node) (interface{}, bool) { return value, true }
+}
+
+// compare applies a comparison operator; a missing value only equals another missing value
+func compare(op string, a interface{}, aok bool, b interface{}, bok bool) bool {
+	if op == "!=" {
+		return !compare("==", a, aok, b, bok)
+	}
+	if !aok || !bok {
+		return !aok && !bok && (op == "==" || op == "<=" || op == ">=")
+	}
+
+	if x, ok := number(a); ok {
+		if y, ok := number(b); ok {
+			switch op {
+			case "==":
+				return x == y
+			case "<":
+				return x < y
+			case "<=":
+				return x <= y
+			case ">":
+				return x > y
+			case ">=":
+				return x >= y
+			}
+		}
+	}
+	if x, ok := a.(string); ok {
+		if y, ok := b.(string); ok {
+			switch op {
+			case "==":
+				return x == y
+			case "<":
+				return x < y
+			case "<=":
+				return x <= y
+			case ">":
+				return x > y
+			case ">=":
+				return x >= y
+			}
+		}
+	}
+	equal := reflect.DeepEqual(a, b)
+	return equal && (op == "==" || op == "<=" || op == ">=")
+}
+
+// number converts decoded YAML numbers to float64
+func number(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
@@ -0,0 +1,87 @@
+package overlay
+
+import (
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+const document = `
+openapi: 3.1.0
+info:
+  title: Pets
+  x-internal: true
+tags:
+  - name: pets
+  - name: admin
+  - name: store
+paths:
+  /pets:
+    get:
+      operationId: listPets
+      tags: [pets]
+      x-internal: false
+    delete:
+      operationId: deletePets
+      tags: [admin]
+      x-internal: true
+      x-weight: 3
+  /store:
+    get:
+      operationId: getInventory
+      x-weight: 1
+`
+
+func TestQuery_Select(t *testing.T) {
+	var root yaml.Node
+	if err := yaml.Unmarshal([]byte(document), &root); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{`$.info.title`, []string{"Pets"}},
+		{`$['info']["title"]`, []string{"Pets"}},
+		{`$.paths['/pets'].get.operationId`, []string{"listPets"}},
+		{`$.paths.*.*.operationId`, []string{"listPets", "deletePets", "getInventory"}},
+		{`$..operationId`, []string{"listPets", "deletePets", "getInventory"}},
+		{`$.tags[-1].name`, []string{"store"}},
+		{`$.tags[0,2].name`, []string{"pets", "store"}},
+		{`$.tags[1:].name`, []string{"admin", "store"}},
+		{`$.tags[::-1].name`, []string{"store", "admin", "pets"}},
+		{`$.tags[?@.name == 'admin'].name`, []string{"admin"}},
+		{`$.paths.*[?@['x-internal'] == true].operationId`, []string{"deletePets"}},
+		{`$.paths.*[?(@.x-weight > 1 || @.tags[0] == "pets")].operationId`, []string{"listPets", "deletePets"}},
+		{`$.paths.*[?@.x-weight && !@.tags].operationId`, []string{"getInventory"}},
+		{`$.paths.*[?@.tags != $.tags[0].name].operationId`, []string{"listPets", "deletePets", "getInventory"}},
+		{`$..[?@.operationId == 'listPets']['x-internal']`, []string{"false"}},
+		{`$.paths.missing`, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			q, err := compile(tt.path)
+			if err != nil {
+				t.Fatalf("compile() error = %v", err)
+			}
+			var got []string
+			for _, m := range q.selectNodes(&root) {
+				got = append(got, m.node.Value)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("select = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompile_Invalid(t *testing.T) {
+	for _, path := range []string{`info.title`, `$.`, `$[`, `$['title`, `$[?@.a ==]`, `$.a b`} {
+		if _, err := compile(path); err == nil {
+			t.Errorf("compile(%q) should fail", path)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+// Package overlay applies OpenAPI Overlay 1.0 documents to a yaml.Node tree
+package overlay
+
+import (
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Overlay is an Overlay 1.0 document
+type Overlay struct {
+	Overlay string `yaml:"overlay"`
+	Info    struct {
+		Title   string `yaml:"title"`
+		Version string `yaml:"version"`
+	} `yaml:"info"`
+	Extends string   `yaml:"extends"`
+	Actions []Action `yaml:"actions"`
+}
+
+// Action changes the nodes its target selects
+type Action struct {
+	// Target is a JSONPath expression
+	Target      string `yaml:"target"`
+	Description string `yaml:"description"`
+	// Update is merged into the targets; it is empty when the action has none
+	Update yaml.Node `yaml:"update"`
+	// Remove removes the targets; Update is ignored then
+	Remove bool `yaml:"remove"`
+}
+
+// Parse parses an Overlay document from YAML or JSON
+func Parse(data []byte) (*Overlay, error) {
+	var o Overlay
+	if err := yaml.Unmarshal(data, &o); err != nil {
+		return nil, fmt.Errorf("failed to parse overlay: %w", err)
+	}
+	if !strings.HasPrefix(o.Overlay, "1.") {
+		return nil, fmt.Errorf("unsupported overlay version %q, expected 1.x", o.Overlay)
+	}
+	if len(o.Actions) == 0 {
+		return nil, fmt.Errorf("overlay has no actions")
+	}
+	return &o, nil
+}
+
+// Apply applies the actions in order. Update merges mappings recursively, keeping the
+// position of existing keys and appending new ones, appends the value to sequences as
+// one item and replaces scalars. It returns a warning for every action whose target selects nothing.
+func (o *Overlay) Apply(root *yaml.Node) ([]string, error) {
+	var warnings []string
+	for i, action := range o.Actions {
+		q, err := compile(action.Target)
+		if err != nil {
+			return warnings, fmt.Errorf("action %d: %w", i+1, err)
+		}
+
+		matches := q.selectNodes(root)
+		if len(matches) == 0 {
+			warnings = append(warnings, fmt.Sprintf("action %d: target %s matched nothing", i+1, action.Target))
+			continue
+		}
+
+		for _, m := range matches {
+			switch {
+			case action.Remove:
+				if m.parent == nil {
+					return warnings, fmt.Errorf("action %d: the document root cannot be removed", i+1)
+				}
+				remove(m.parent, m.node)
+			case action.Update.Kind != 0:
+				if err := update(m.node, &action.Update); err != nil {
+					return warnings, fmt.Errorf("action %d: target %s: %w", i+1, action.Target, err)
+				}
+			}
+		}
+	}
+	return warnings, nil
+}
+
+// update merges value into target
+func update(target, value *yaml.Node) error {
+	switch target.Kind {
+	case yaml.MappingNode:
+		if value.Kind != yaml.MappingNode {
+			return fmt.Errorf("cannot merge a %s into an object", kindName(value))
+		}
+		for i := 0; i+1 < len(value.Content); i += 2 {
+			key, child := value.Content[i].Value, value.Content[i+1]
+			existing := helper.GetMapValue(target, key)
+			if existing != nil && existing.Kind == yaml.MappingNode && child.Kind == yaml.MappingNode {
+				if err := update(existing, child); err != nil {
+					return err
+				}
+				continue
+			}
+			helper.SetMapValue(target, key, helper.CloneNode(child))
+		}
+	case yaml.SequenceNode:
+		// Overlay 1.0 appends the value as one item, even when it is an array itself
+		target.Content = append(target.Content, helper.CloneNode(value))
+	default:
+		*target = *helper.CloneNode(value)
+	}
+	return nil
+}
+
+// remove removes node from its parent mapping or sequence
+func remove(parent, node *yaml.Node) {
+	switch parent.Kind {
+	case yaml.MappingNode:
+		for i := 1; i < len(parent.Content); i += 2 {
+			if parent.Content[i] == node {
+				parent.Content = append(parent.Content[:i-1], parent.Content[i+1:]...)
+				return
+			}
+		}
+	case yaml.SequenceNode:
+		for i, item := range parent.Content {
+			if item == node {
+				parent.Content = append(parent.Content[:i], parent.Content[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+func kindName(node *yaml.Node) string {
+	switch node.Kind {
+	case yaml.SequenceNode:
+		return "array"
+	case yaml.MappingNode:
+		return "object"
+	}
+	return "scalar"
+}
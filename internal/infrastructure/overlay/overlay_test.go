@@ -0,0 +1,49 @@
+package overlay
+
+import (
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestOverlay_ApplyUpdateSequence(t *testing.T) {
+	o, err := Parse([]byte(`overlay: 1.0.0
+info: {title: Tags, version: 1.0.0}
+actions:
+  - target: $.tags
+    update: {name: billing}
+  - target: $.paths['/pets'].get.tags
+    update: [a, b]
+`))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal([]byte(document), &root); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := o.Apply(&root); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+
+	q, err := compile(`$.paths['/pets'].get.tags`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tags := q.selectNodes(&root)[0].node
+	if len(tags.Content) != 2 {
+		t.Fatalf("an array update should be appended as one item, got %d items", len(tags.Content))
+	}
+	if item := tags.Content[1]; item.Kind != yaml.SequenceNode || len(item.Content) != 2 {
+		t.Errorf("appended item = %v, want the array [a, b]", item.Value)
+	}
+
+	q, err = compile(`$.tags[-1].name`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := q.selectNodes(&root)[0].node.Value; got != "billing" {
+		t.Errorf("last tag = %q, want billing", got)
+	}
+}
@@ -322,8 +322,9 @@ func (p *Parser) formatScalarNode(node *yaml.Node) {
 
 // formatScalarValue formats a scalar value in a mapping
 func (p *Parser) formatScalarValue(node *yaml.Node) {
-	// Convert folded to literal
-	if node.Style == yaml.FoldedStyle {
+	// Block scalars become literal and skip the quoting rules, which would turn a
+	// multi-line text starting like a date into a quoted string
+	if node.Style == yaml.FoldedStyle || node.Style == yaml.LiteralStyle {
 		node.Style = yaml.LiteralStyle
 		return
 	}
@@ -0,0 +1,178 @@
+// Package pointer implements RFC 6901 JSON Pointers over yaml.Node trees,
+// including the URI fragment representation used in $ref values.
+package pointer
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ErrNotFound is returned when a pointer cannot be resolved against a document
+type ErrNotFound struct {
+	Pointer string
+	// Segment is the unescaped reference token that failed
+	Segment string
+	// Reason explains why the segment could not be followed
+	Reason string
+}
+
+func (e *ErrNotFound) Error() string {
+	return fmt.Sprintf("JSON pointer %s: segment %q %s", e.Pointer, e.Segment, e.Reason)
+}
+
+// Parse splits a JSON pointer or URI fragment into unescaped reference tokens.
+// A leading "#" is accepted and the fragment is percent-decoded first.
+// The empty pointer ("" or "#") refers to the whole document and yields no tokens.
+func Parse(fragment string) ([]string, error) {
+	fragment = strings.TrimPrefix(fragment, "#")
+	if decoded, err := url.PathUnescape(fragment); err == nil {
+		fragment = decoded
+	}
+
+	if fragment == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(fragment, "/") {
+		return nil, fmt.Errorf("invalid JSON pointer %q: must start with /", fragment)
+	}
+
+	parts := strings.Split(fragment[1:], "/")
+	tokens := make([]string, len(parts))
+	for i, part := range parts {
+		token, err := unescape(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid JSON pointer %q: %w", fragment, err)
+		}
+		tokens[i] = token
+	}
+	return tokens, nil
+}
+
+// Resolve navigates from node to the value the pointer refers to
+func Resolve(node *yaml.Node, fragment string) (*yaml.Node, error) {
+	tokens, err := Parse(fragment)
+	if err != nil {
+		return nil, err
+	}
+
+	current := node
+	if current != nil && current.Kind == yaml.DocumentNode && len(current.Content) > 0 {
+		current = current.Content[0]
+	}
+
+	for _, token := range tokens {
+		if current != nil && current.Kind == yaml.AliasNode {
+			current = current.Alias
+		}
+		if current == nil {
+			return nil, &ErrNotFound{Pointer: fragment, Segment: token, Reason: "has no parent value"}
+		}
+
+		switch current.Kind {
+		case yaml.MappingNode:
+			next := mapValue(current, token)
+			if next == nil {
+				return nil, &ErrNotFound{Pointer: fragment, Segment: token, Reason: "not found"}
+			}
+			current = next
+
+		case yaml.SequenceNode:
+			index, err := arrayIndex(token)
+			if err != nil {
+				return nil, &ErrNotFound{Pointer: fragment, Segment: token, Reason: err.Error()}
+			}
+			if index >= len(current.Content) {
+				return nil, &ErrNotFound{Pointer: fragment, Segment: token, Reason: fmt.Sprintf("is out of range (length %d)", len(current.Content))}
+			}
+			current = current.Content[index]
+
+		default:
+			return nil, &ErrNotFound{Pointer: fragment, Segment: token, Reason: "cannot be applied to a scalar value"}
+		}
+	}
+
+	return current, nil
+}
+
+// Format builds a "#/..." URI fragment from unescaped reference tokens
+func Format(tokens ...string) string {
+	var b strings.Builder
+	b.WriteString("#")
+	for _, token := range tokens {
+		b.WriteString("/")
+		b.WriteString(Escape(token))
+	}
+	return b.String()
+}
+
+// Escape escapes a reference token: "~" becomes "~0" and "/" becomes "~1"
+func Escape(token string) string {
+	token = strings.ReplaceAll(token, "~", "~0")
+	return strings.ReplaceAll(token, "/", "~1")
+}
+
+// Unescape reverses Escape. Invalid escape sequences are left as they are.
+func Unescape(token string) string {
+	if unescaped, err := unescape(token); err == nil {
+		return unescaped
+	}
+	return token
+}
+
+// unescape decodes ~1 and ~0 in that order, rejecting other ~ sequences
+func unescape(token string) (string, error) {
+	if !strings.Contains(token, "~") {
+		return token, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(token); i++ {
+		if token[i] != '~' {
+			b.WriteByte(token[i])
+			continue
+		}
+		if i+1 >= len(token) || (token[i+1] != '0' && token[i+1] != '1') {
+			return "", fmt.Errorf("invalid escape sequence in %q", token)
+		}
+		if token[i+1] == '0' {
+			b.WriteByte('~')
+		} else {
+			b.WriteByte('/')
+		}
+		i++
+	}
+	return b.String(), nil
+}
+
+// arrayIndex parses a sequence index token: digits without leading zeros
+func arrayIndex(token string) (int, error) {
+	if token == "-" {
+		return 0, fmt.Errorf("refers to the element after the last one")
+	}
+	if token == "" || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("is not a valid array index")
+	}
+	for _, c := range token {
+		if c < '0' || c > '9' {
+			return 0, fmt.Errorf("is not a valid array index")
+		}
+	}
+	index, err := strconv.Atoi(token)
+	if err != nil {
+		return 0, fmt.Errorf("is not a valid array index")
+	}
+	return index, nil
+}
+
+// mapValue gets a value from a mapping node by key
+func mapValue(node *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package pointer
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+const testDocument = `paths:
+  /users/{id}:
+    get:
+      parameters:
+        - name: id
+        - name: verbose
+  a~b:
+    value: tilde
+  "":
+    value: empty
+parameters:
+  - name: first
+`
+
+func parseDocument(t *testing.T) *yaml.Node {
+	t.Helper()
+	var node yaml.Node
+	if err := yaml.Unmarshal([]byte(testDocument), &node); err != nil {
+		t.Fatalf("failed to parse document: %v", err)
+	}
+	return &node
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name     string
+		fragment string
+		want     []string
+		wantErr  bool
+	}{
+		{name: "empty", fragment: "", want: nil},
+		{name: "hash only", fragment: "#", want: nil},
+		{name: "simple", fragment: "#/components/schemas/User", want: []string{"components", "schemas", "User"}},
+		{name: "escapes", fragment: "/paths/~1users~1{id}/a~0b", want: []string{"paths", "/users/{id}", "a~b"}},
+		{name: "percent-encoded", fragment: "#/paths/~1users~1%7Bid%7D", want: []string{"paths", "/users/{id}"}},
+		{name: "empty token", fragment: "/", want: []string{""}},
+		{name: "invalid escape", fragment: "/a~2b", wantErr: true},
+		{name: "missing slash", fragment: "components", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.fragment)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolve(t *testing.T) {
+	doc := parseDocument(t)
+
+	tests := []struct {
+		name     string
+		fragment string
+		want     string
+	}{
+		{name: "sequence index", fragment: "/parameters/0/name", want: "first"},
+		{name: "escaped path", fragment: "#/paths/~1users~1{id}/get/parameters/1/name", want: "verbose"},
+		{name: "percent-encoded path", fragment: "#/paths/~1users~1%7Bid%7D/get/parameters/0/name", want: "id"},
+		{name: "tilde", fragment: "/paths/a~0b/value", want: "tilde"},
+		{name: "empty key", fragment: "/paths//value", want: "empty"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Resolve(doc, tt.fragment)
+			if err != nil {
+				t.Fatalf("Resolve() error = %v", err)
+			}
+			if got.Value != tt.want {
+				t.Errorf("Resolve() = %q, want %q", got.Value, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolve_Errors(t *testing.T) {
+	doc := parseDocument(t)
+
+	tests := []struct {
+		name        string
+		fragment    string
+		wantSegment string
+	}{
+		{name: "missing key", fragment: "/paths/~1orders", wantSegment: "/orders"},
+		{name: "index out of range", fragment: "/parameters/3", wantSegment: "3"},
+		{name: "leading zero", fragment: "/parameters/01", wantSegment: "01"},
+		{name: "dash index", fragment: "/parameters/-", wantSegment: "-"},
+		{name: "not an index", fragment: "/parameters/first", wantSegment: "first"},
+		{name: "scalar", fragment: "/parameters/0/name/x", wantSegment: "x"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Resolve(doc, tt.fragment)
+			var notFound *ErrNotFound
+			if !errors.As(err, &notFound) {
+				t.Fatalf("Resolve() error = %v, want ErrNotFound", err)
+			}
+			if notFound.Segment != tt.wantSegment {
+				t.Errorf("Segment = %q, want %q", notFound.Segment, tt.wantSegment)
+			}
+		})
+	}
+}
+
+func TestFormat(t *testing.T) {
+	got := Format("paths", "/users/{id}", "a~b")
+	want := "#/paths/~1users~1{id}/a~0b"
+	if got != want {
+		t.Errorf("Format() = %q, want %q", got, want)
+	}
+}
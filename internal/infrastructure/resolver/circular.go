@@ -0,0 +1,137 @@
+package resolver
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/miorlan/openapi-bundler/internal/domain"
+	"github.com/miorlan/openapi-bundler/internal/infrastructure/pointer"
+	"github.com/miorlan/openapi-bundler/internal/infrastructure/uri"
+	"gopkg.in/yaml.v3"
+)
+
+// refIdentity builds the identity of a reference target from its file and fragment
+func refIdentity(absPath string, fragment string) string {
+	if fragment == "/" {
+		fragment = ""
+	}
+	// Different spellings of the same pointer (%7B vs {) share one identity
+	if tokens, err := pointer.Parse(fragment); err == nil && len(tokens) > 0 {
+		fragment = strings.TrimPrefix(pointer.Format(tokens...), "#")
+	}
+	return absPath + "#" + fragment
+}
+
+// cycleChain returns the chain of refs closing a cycle at identity, or nil if there is none
+func (r *Resolver) cycleChain(identity string) []string {
+	for i, seen := range r.refStack {
+		if seen == identity {
+			chain := make([]string, 0, len(r.refStack)-i+1)
+			chain = append(chain, r.refStack[i:]...)
+			return append(chain, identity)
+		}
+	}
+	return nil
+}
+
+// pushRef marks identity as being resolved
+func (r *Resolver) pushRef(identity string) {
+	r.refStack = append(r.refStack, identity)
+}
+
+// popRef removes the last identity from the resolution stack
+func (r *Resolver) popRef() {
+	if len(r.refStack) > 0 {
+		r.refStack = r.refStack[:len(r.refStack)-1]
+	}
+}
+
+// handleCircularRef applies the configured policy to a ref that closes a cycle
+func (r *Resolver) handleCircularRef(node *yaml.Node, identity string, chain []string, config domain.Config) error {
+	if config.CircularRefs == domain.CircularRefError {
+		return r.circularError(chain)
+	}
+
+	r.lookup(identityKey, identity)
+	internalRef, ok := r.circularTargets[identity]
+	if !ok {
+		claimed, err := r.circularComponentRef(identity, config)
+		if err != nil {
+			return err
+		}
+		internalRef = claimed
+		r.circularTargets[identity] = internalRef
+	}
+
+	r.replaceNode(node, r.helper.CreateRefNode(internalRef))
+	return nil
+}
+
+// finishCircularTarget stores the resolved content of a cycle target as a component
+// and turns the outermost occurrence into an internal ref as well
+func (r *Resolver) finishCircularTarget(node *yaml.Node, identity string) {
+	r.lookup(identityKey, identity)
+	internalRef, ok := r.circularTargets[identity]
+	if !ok {
+		return
+	}
+
+	r.lookup(nameKey, internalRef)
+	if _, exists := r.collectedComponents[internalRef]; !exists && !r.globalComponents[internalRef] {
+		r.collectedComponents[internalRef] = r.helper.CloneNode(node)
+		r.collectedOrder = append(r.collectedOrder, internalRef)
+	}
+
+	if r.helper.GetRef(node) != internalRef {
+		r.replaceNode(node, r.helper.CreateRefNode(internalRef))
+	}
+}
+
+// circularComponentRef picks the internal ref a cycle target is hoisted to
+func (r *Resolver) circularComponentRef(identity string, config domain.Config) (string, error) {
+	absPath, fragment, _ := strings.Cut(identity, "#")
+
+	// A component fragment of a components file keeps its own type and name
+	if componentType, name, ok := r.parseComponentFragment(fragment); ok {
+		return r.claimComponentName(componentType, name, identity, nil, config)
+	}
+	r.lookup(identityKey, identity)
+	if internalRef, ok := r.identityRefs[identity]; ok {
+		return internalRef, nil
+	}
+
+	// Other targets become schemas named after the fragment or the file
+	name := strings.TrimSuffix(uri.Base(absPath), filepath.Ext(uri.Base(absPath)))
+	if fragment != "" {
+		if tokens, err := pointer.Parse(fragment); err == nil && len(tokens) > 0 {
+			name = tokens[len(tokens)-1]
+		}
+	}
+	internalRef := r.componentRef("schemas", r.freeComponentName("schemas", name))
+	r.registerComponentSource(internalRef, identity)
+	return internalRef, nil
+}
+
+// circularError builds an ErrCircularReference with a readable chain
+func (r *Resolver) circularError(chain []string) error {
+	display := make([]string, len(chain))
+	for i, identity := range chain {
+		display[i] = r.displayIdentity(identity)
+	}
+	return &domain.ErrCircularReference{
+		Path:  display[len(display)-1],
+		Chain: display,
+	}
+}
+
+// displayIdentity shortens a ref identity relative to the root document
+func (r *Resolver) displayIdentity(identity string) string {
+	absPath, fragment, _ := strings.Cut(identity, "#")
+	if rel, ok := uri.Rel(r.rootBaseDir, absPath); ok {
+		absPath = rel
+	}
+	if fragment == "" {
+		return absPath
+	}
+	return absPath + "#" + fragment
+}
@@ -0,0 +1,211 @@
+package resolver
+
+import (
+	"strings"
+
+	"github.com/miorlan/openapi-bundler/internal/domain"
+	"github.com/miorlan/openapi-bundler/internal/infrastructure/pointer"
+
+	"gopkg.in/yaml.v3"
+)
+
+// dereference replaces every internal $ref in the bundled document with its content.
+// Refs that point back into a schema that is already being expanded are kept as
+// internal refs, so recursive schemas stay finite. Components that were inlined and
+// are no longer referenced are removed afterwards.
+func (r *Resolver) dereference(root *yaml.Node, config domain.Config) {
+	original := r.helper.CloneNode(root)
+	inlined := make(map[string]bool)
+
+	componentsNode := r.layout.componentsNode(root)
+
+	for i := 0; i < len(root.Content); i += 2 {
+		if i+1 >= len(root.Content) {
+			break
+		}
+		if !r.layout.holdsComponents(root.Content[i].Value) {
+			r.pushPath(root.Content[i].Value)
+			r.dereferenceNode(root.Content[i+1], original, nil, inlined, config)
+			r.popPath()
+		}
+	}
+
+	// Each component is expanded with its own pointer on the stack,
+	// so a self-referencing schema keeps its ref to itself.
+	r.iterateComponents(componentsNode, func(ref string, component *yaml.Node) {
+		r.currentPath, _ = pointer.Parse(ref)
+		r.dereferenceNode(component, original, []string{ref}, inlined, config)
+	})
+	r.currentPath = nil
+
+	if componentsNode != nil {
+		r.pruneInlinedComponents(root, componentsNode, inlined)
+	}
+}
+
+// iterateComponents calls fn with the internal ref and content of every root component
+func (r *Resolver) iterateComponents(componentsNode *yaml.Node, fn func(pointer string, component *yaml.Node)) {
+	_ = r.helper.IterateMap(componentsNode, func(section string, sectionNode *yaml.Node) error {
+		componentType, ok := r.layout.sectionType(section)
+		if !ok {
+			return nil
+		}
+		return r.helper.IterateMap(sectionNode, func(name string, component *yaml.Node) error {
+			fn(r.componentRef(componentType, name), component)
+			return nil
+		})
+	})
+}
+
+// dereferenceNode expands internal refs in node, tracking the chain of refs being expanded
+func (r *Resolver) dereferenceNode(node *yaml.Node, original *yaml.Node, stack []string, inlined map[string]bool, config domain.Config) {
+	if node == nil {
+		return
+	}
+
+	switch node.Kind {
+	case yaml.DocumentNode, yaml.SequenceNode:
+		for _, child := range node.Content {
+			r.dereferenceNode(child, original, stack, inlined, config)
+		}
+
+	case yaml.MappingNode:
+		ref := r.helper.GetRef(node)
+		if ref == "" {
+			for i := 1; i < len(node.Content); i += 2 {
+				r.pushPath(node.Content[i-1].Value)
+				r.dereferenceNode(node.Content[i], original, stack, inlined, config)
+				r.popPath()
+			}
+			return
+		}
+
+		if !strings.HasPrefix(ref, "#") {
+			return
+		}
+
+		// Keywords next to the ref may hold refs of their own
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value != "$ref" {
+				r.pushPath(node.Content[i].Value)
+				r.dereferenceNode(node.Content[i+1], original, stack, inlined, config)
+				r.popPath()
+			}
+		}
+
+		for _, seen := range stack {
+			if seen == ref {
+				// Recursion point: keep the internal ref
+				return
+			}
+		}
+
+		target := r.navigateToFragment(original, strings.TrimPrefix(ref, "#"))
+		if target == nil {
+			return
+		}
+
+		inlined[ref] = true
+		content := r.helper.CloneNode(target)
+		r.dereferenceNode(content, original, append(stack[:len(stack):len(stack)], ref), inlined, config)
+		r.inlineRef(node, content, config)
+	}
+}
+
+// pruneInlinedComponents drops inlined components that nothing references anymore
+func (r *Resolver) pruneInlinedComponents(root *yaml.Node, componentsNode *yaml.Node, inlined map[string]bool) {
+	// Everything outside components, plus components that were never inlined, stays
+	reachable := make(map[string]bool)
+	var queue []*yaml.Node
+
+	for i := 0; i < len(root.Content); i += 2 {
+		if i+1 >= len(root.Content) {
+			break
+		}
+		if !r.layout.holdsComponents(root.Content[i].Value) {
+			queue = append(queue, root.Content[i+1])
+		}
+	}
+
+	r.iterateComponents(componentsNode, func(pointer string, component *yaml.Node) {
+		if !inlined[pointer] {
+			reachable[pointer] = true
+			queue = append(queue, component)
+		}
+	})
+
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+
+		for _, ref := range r.collectInternalRefs(node) {
+			if reachable[ref] {
+				continue
+			}
+			reachable[ref] = true
+			if target := r.navigateToFragment(root, strings.TrimPrefix(ref, "#")); target != nil {
+				queue = append(queue, target)
+			}
+		}
+	}
+
+	for i := 0; i < len(componentsNode.Content); i += 2 {
+		if i+1 >= len(componentsNode.Content) {
+			break
+		}
+		componentType, ok := r.layout.sectionType(componentsNode.Content[i].Value)
+		sectionNode := componentsNode.Content[i+1]
+		if !ok || sectionNode.Kind != yaml.MappingNode {
+			continue
+		}
+
+		kept := make([]*yaml.Node, 0, len(sectionNode.Content))
+		for j := 0; j+1 < len(sectionNode.Content); j += 2 {
+			pointer := r.componentRef(componentType, sectionNode.Content[j].Value)
+			if inlined[pointer] && !reachable[pointer] {
+				continue
+			}
+			kept = append(kept, sectionNode.Content[j], sectionNode.Content[j+1])
+		}
+		sectionNode.Content = kept
+	}
+
+	// Drop sections left empty by pruning
+	kept := make([]*yaml.Node, 0, len(componentsNode.Content))
+	for i := 0; i+1 < len(componentsNode.Content); i += 2 {
+		sectionNode := componentsNode.Content[i+1]
+		if _, ok := r.layout.sectionType(componentsNode.Content[i].Value); ok && sectionNode.Kind == yaml.MappingNode && len(sectionNode.Content) == 0 {
+			continue
+		}
+		kept = append(kept, componentsNode.Content[i], sectionNode)
+	}
+	componentsNode.Content = kept
+
+	if r.layout.container != "" && len(componentsNode.Content) == 0 {
+		r.helper.DeleteMapKey(root, r.layout.container)
+	}
+}
+
+// collectInternalRefs returns all internal $ref values found in node
+func (r *Resolver) collectInternalRefs(node *yaml.Node) []string {
+	var refs []string
+	var walk func(n *yaml.Node)
+	walk = func(n *yaml.Node) {
+		if n == nil {
+			return
+		}
+		if n.Kind == yaml.MappingNode {
+			if ref := r.helper.GetRef(n); strings.HasPrefix(ref, "#") {
+				refs = append(refs, ref)
+			}
+			if ref := r.helper.GetStringValue(r.helper.GetMapValue(n, "$dynamicRef")); strings.HasPrefix(ref, "#") {
+				refs = append(refs, ref)
+			}
+		}
+		for _, child := range n.Content {
+			walk(child)
+		}
+	}
+	walk(node)
+	return refs
+}
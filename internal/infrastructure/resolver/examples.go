@@ -0,0 +1,94 @@
+package resolver
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/miorlan/openapi-bundler/internal/domain"
+	"github.com/miorlan/openapi-bundler/internal/infrastructure/errors"
+	"github.com/miorlan/openapi-bundler/internal/infrastructure/uri"
+	"gopkg.in/yaml.v3"
+)
+
+// examplesDir is the directory next to the bundle that large example files are copied to
+const examplesDir = "examples"
+
+// embedExternalValue loads the file of an Example Object's externalValue. JSON and YAML
+// become its value, other files a string; files above the size threshold are copied
+// next to the bundle and externalValue points at the copy.
+func (r *Resolver) embedExternalValue(ctx context.Context, example *yaml.Node, baseDir string, config domain.Config) error {
+	valueNode := r.helper.GetMapValue(example, "externalValue")
+	externalValue := r.helper.GetStringValue(valueNode)
+	r.lookup(fileKey, externalValue)
+	if externalValue == "" || r.assetPaths[externalValue] {
+		return nil
+	}
+
+	refPath := r.getRefPath(externalValue, baseDir)
+	if refPath == "" {
+		return nil
+	}
+	source := uri.Abs(refPath)
+
+	data, err := r.load(ctx, refPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &errors.ErrFileNotFound{Path: refPath}
+		}
+		return fmt.Errorf("failed to load example %s: %w", externalValue, err)
+	}
+
+	if config.EmbedExamplesMaxSize > 0 && int64(len(data)) > config.EmbedExamplesMaxSize {
+		valueNode.Value = r.copyAsset(source, data)
+		return nil
+	}
+
+	value := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: string(data)}
+	switch strings.ToLower(filepath.Ext(uri.Base(refPath))) {
+	case ".json", ".yaml", ".yml":
+		var doc yaml.Node
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return fmt.Errorf("failed to parse example %s: %w", externalValue, err)
+		}
+		if len(doc.Content) > 0 {
+			value = doc.Content[0]
+		}
+	}
+
+	// value takes the place of externalValue
+	for i := 0; i+1 < len(example.Content); i += 2 {
+		if example.Content[i].Value == "externalValue" {
+			example.Content[i].Value = "value"
+			example.Content[i+1] = value
+		}
+	}
+	return nil
+}
+
+// copyAsset queues a file to be written next to the bundle and returns its relative path
+func (r *Resolver) copyAsset(source string, data []byte) string {
+	r.lookup(fileKey, source)
+	for _, asset := range r.report.Assets {
+		if asset.Source == source {
+			return asset.Path
+		}
+	}
+
+	base := uri.Base(source)
+	ext := path.Ext(base)
+	target := examplesDir + "/" + base
+	for i := 2; r.assetPaths[target]; i++ {
+		r.lookup(fileKey, target)
+		target = examplesDir + "/" + strings.TrimSuffix(base, ext) + strconv.Itoa(i) + ext
+	}
+	r.lookup(fileKey, target)
+
+	r.assetPaths[target] = true
+	r.report.Assets = append(r.report.Assets, domain.Asset{Source: source, Path: target, Data: data})
+	return target
+}
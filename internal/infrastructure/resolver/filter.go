@@ -0,0 +1,172 @@
+package resolver
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/miorlan/openapi-bundler/internal/domain"
+	"gopkg.in/yaml.v3"
+)
+
+// httpMethods are the keys of a path item holding operations
+var httpMethods = []string{"get", "put", "post", "delete", "options", "head", "patch", "trace"}
+
+// filterOperations drops the operations of paths and webhooks the filter does not select,
+// then the path items left without operations and the root tags no kept operation uses.
+// A path item that is a ref to a shared component is copied before it is filtered.
+func (r *Resolver) filterOperations(root *yaml.Node, filter domain.OperationFilter) {
+	includePaths := compileGlobs(filter.IncludePaths)
+	excludePaths := compileGlobs(filter.ExcludePaths)
+	usedTags := make(map[string]bool)
+
+	for _, section := range r.layout.rootSections {
+		if section != "paths" && section != "webhooks" {
+			continue
+		}
+		sectionNode := r.helper.GetMapValue(root, section)
+		if sectionNode == nil || sectionNode.Kind != yaml.MappingNode {
+			continue
+		}
+
+		for _, key := range r.helper.GetMapKeys(sectionNode) {
+			if strings.HasPrefix(key, "x-") {
+				continue
+			}
+			pathItem := r.helper.GetMapValue(sectionNode, key)
+			target := pathItem
+			if ref := r.helper.GetRef(pathItem); ref != "" {
+				if !strings.HasPrefix(ref, "#") {
+					continue
+				}
+				if target = r.navigateToFragment(root, strings.TrimPrefix(ref, "#")); target == nil {
+					continue
+				}
+			}
+
+			var dropped []string
+			kept := 0
+			for _, method := range httpMethods {
+				operation := r.helper.GetMapValue(target, method)
+				if operation == nil {
+					continue
+				}
+				if !r.matchesOperation(filter, key, method, operation, includePaths, excludePaths) {
+					dropped = append(dropped, method)
+					continue
+				}
+				kept++
+				for _, tag := range r.operationTags(operation) {
+					usedTags[tag] = true
+				}
+			}
+
+			switch {
+			case kept == 0:
+				r.helper.DeleteMapKey(sectionNode, key)
+			case len(dropped) > 0:
+				if target != pathItem {
+					target = r.helper.CloneNode(target)
+					r.helper.SetMapValue(sectionNode, key, target)
+				}
+				for _, method := range dropped {
+					r.helper.DeleteMapKey(target, method)
+				}
+			}
+		}
+
+		if len(sectionNode.Content) == 0 {
+			r.helper.DeleteMapKey(root, section)
+		}
+	}
+
+	if tags := r.helper.GetMapValue(root, "tags"); tags != nil && tags.Kind == yaml.SequenceNode {
+		content := tags.Content[:0]
+		for _, tag := range tags.Content {
+			if usedTags[r.helper.GetStringValue(r.helper.GetMapValue(tag, "name"))] {
+				content = append(content, tag)
+			}
+		}
+		tags.Content = content
+		if len(tags.Content) == 0 {
+			r.helper.DeleteMapKey(root, "tags")
+		}
+	}
+}
+
+// matchesOperation reports whether the filter keeps the operation at path and method
+func (r *Resolver) matchesOperation(filter domain.OperationFilter, path, method string, operation *yaml.Node, includePaths, excludePaths []*regexp.Regexp) bool {
+	tags := r.operationTags(operation)
+	operationID := []string{r.helper.GetStringValue(r.helper.GetMapValue(operation, "operationId"))}
+	methods := []string{method}
+
+	if len(filter.IncludeTags) > 0 && !containsAny(filter.IncludeTags, tags, false) ||
+		len(filter.IncludeOperationIDs) > 0 && !containsAny(filter.IncludeOperationIDs, operationID, false) ||
+		len(filter.IncludeMethods) > 0 && !containsAny(filter.IncludeMethods, methods, true) ||
+		len(includePaths) > 0 && !matchesAnyGlob(includePaths, path) {
+		return false
+	}
+	return !containsAny(filter.ExcludeTags, tags, false) &&
+		!containsAny(filter.ExcludeOperationIDs, operationID, false) &&
+		!containsAny(filter.ExcludeMethods, methods, true) &&
+		!matchesAnyGlob(excludePaths, path)
+}
+
+// operationTags returns the tag names of an operation
+func (r *Resolver) operationTags(operation *yaml.Node) []string {
+	var tags []string
+	if tagsNode := r.helper.GetMapValue(operation, "tags"); tagsNode != nil && tagsNode.Kind == yaml.SequenceNode {
+		for _, tag := range tagsNode.Content {
+			tags = append(tags, tag.Value)
+		}
+	}
+	return tags
+}
+
+// containsAny reports whether any of values is in list
+func containsAny(list, values []string, ignoreCase bool) bool {
+	for _, item := range list {
+		for _, value := range values {
+			if item == value || ignoreCase && strings.EqualFold(item, value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// compileGlobs turns path globs into regular expressions: * matches within a path
+// segment and ** across segments. A trailing /** also matches the path before it.
+func compileGlobs(globs []string) []*regexp.Regexp {
+	var compiled []*regexp.Regexp
+	for _, glob := range globs {
+		var pattern strings.Builder
+		pattern.WriteString("^")
+		for i := 0; i < len(glob); i++ {
+			switch {
+			case glob[i:] == "/**":
+				pattern.WriteString("(/.*)?")
+				i += 2
+			case strings.HasPrefix(glob[i:], "**"):
+				pattern.WriteString(".*")
+				i++
+			case glob[i] == '*':
+				pattern.WriteString("[^/]*")
+			default:
+				pattern.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+			}
+		}
+		pattern.WriteString("$")
+		compiled = append(compiled, regexp.MustCompile(pattern.String()))
+	}
+	return compiled
+}
+
+// matchesAnyGlob reports whether path matches any of the globs
+func matchesAnyGlob(globs []*regexp.Regexp, path string) bool {
+	for _, glob := range globs {
+		if glob.MatchString(path) {
+			return true
+		}
+	}
+	return false
+}
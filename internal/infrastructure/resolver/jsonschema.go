@@ -0,0 +1,246 @@
+package resolver
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/miorlan/openapi-bundler/internal/domain"
+	"github.com/miorlan/openapi-bundler/internal/infrastructure/pointer"
+	"github.com/miorlan/openapi-bundler/internal/infrastructure/uri"
+	"gopkg.in/yaml.v3"
+)
+
+// schemaLocation is where a $id resource or an anchor is defined
+type schemaLocation struct {
+	root    *yaml.Node // root of the document that defines it
+	file    string     // absolute path of that document, empty for the root document
+	pointer string     // JSON pointer within the document
+}
+
+// idScope is a schema with $id enclosing the node being resolved
+type idScope struct {
+	base  string
+	owner *yaml.Node
+}
+
+// usesJSONSchema2020 reports whether the document follows OpenAPI 3.1+, where schemas
+// are JSON Schema 2020-12 and may use $id, $anchor and $ref with sibling keywords
+func (r *Resolver) usesJSONSchema2020() bool {
+	return strings.HasPrefix(r.openAPIVersion, "3.1") || strings.HasPrefix(r.openAPIVersion, "3.2")
+}
+
+// indexSchemaResources registers every $id, $anchor and $dynamicAnchor of a document
+// under its absolute URI, resolved against base
+func (r *Resolver) indexSchemaResources(root *yaml.Node, file, base string) {
+	r.walkSchemaResources(root, base, func(uri string, tokens []string) {
+		r.lookup(resourceKey, uri)
+		if _, exists := r.schemaResources[uri]; !exists {
+			r.schemaResources[uri] = schemaLocation{root: root, file: file, pointer: strings.TrimPrefix(pointer.Format(tokens...), "#")}
+		}
+	})
+}
+
+// walkSchemaResources calls visit with the absolute URI and JSON pointer tokens of every
+// $id, $anchor and $dynamicAnchor of a document, resolved against base
+func (r *Resolver) walkSchemaResources(root *yaml.Node, base string, visit func(uri string, tokens []string)) {
+	var walk func(node *yaml.Node, base string, tokens []string)
+	walk = func(node *yaml.Node, base string, tokens []string) {
+		switch node.Kind {
+		case yaml.MappingNode:
+			if id := r.helper.GetStringValue(r.helper.GetMapValue(node, "$id")); id != "" {
+				base, _, _ = strings.Cut(resolveURI(base, id), "#")
+				visit(base, tokens)
+			}
+			for _, keyword := range []string{"$anchor", "$dynamicAnchor"} {
+				if anchor := r.helper.GetStringValue(r.helper.GetMapValue(node, keyword)); anchor != "" {
+					visit(base+"#"+anchor, tokens)
+				}
+			}
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				walk(node.Content[i+1], base, append(tokens[:len(tokens):len(tokens)], node.Content[i].Value))
+			}
+
+		case yaml.SequenceNode:
+			for i, child := range node.Content {
+				walk(child, base, append(tokens[:len(tokens):len(tokens)], strconv.Itoa(i)))
+			}
+		}
+	}
+	walk(root, resolveURI(base, ""), nil)
+}
+
+// schemaResourceKey returns the key a ref resolved to uri is looked up under in the
+// schema resources: the resource for JSON pointer fragments, the anchor otherwise
+func schemaResourceKey(uri string) string {
+	resource, fragment, _ := strings.Cut(uri, "#")
+	if fragment == "" || strings.HasPrefix(fragment, "/") {
+		return resource
+	}
+	return resource + "#" + fragment
+}
+
+// schemaBase returns the base URI refs of the node being resolved are relative to
+func (r *Resolver) schemaBase(baseDir string, externalRoot *yaml.Node) string {
+	if n := len(r.idScopes); n > 0 {
+		return r.idScopes[n-1].base
+	}
+	if file, ok := r.nodeFiles[externalRoot]; ok && externalRoot != nil {
+		if id := r.helper.GetStringValue(r.helper.GetMapValue(externalRoot, "$id")); id != "" {
+			base, _, _ := strings.Cut(resolveURI(file, id), "#")
+			return base
+		}
+		return resolveURI(file, "")
+	}
+	return strings.TrimSuffix(baseDir, "/") + "/"
+}
+
+// pushIDScope enters a schema with $id, returning false if node does not declare one
+func (r *Resolver) pushIDScope(node *yaml.Node, baseDir string, externalRoot *yaml.Node) bool {
+	id := r.helper.GetStringValue(r.helper.GetMapValue(node, "$id"))
+	if id == "" || !r.usesJSONSchema2020() {
+		return false
+	}
+	base, _, _ := strings.Cut(resolveURI(r.schemaBase(baseDir, externalRoot), id), "#")
+	r.idScopes = append(r.idScopes, idScope{base: base, owner: node})
+	return true
+}
+
+// popIDScope leaves the innermost $id scope. Once a ref inside it was rewritten to point
+// into the bundled document, the $id would change what that ref resolves against, so it is dropped.
+func (r *Resolver) popIDScope() {
+	scope := r.idScopes[len(r.idScopes)-1]
+	r.idScopes = r.idScopes[:len(r.idScopes)-1]
+	if r.staleIDs[scope.owner] {
+		r.helper.DeleteMapKey(scope.owner, "$id")
+	}
+}
+
+// markStaleIDs records that a ref inside the current $id scopes now points into the bundle
+func (r *Resolver) markStaleIDs() {
+	for _, scope := range r.idScopes {
+		r.staleIDs[scope.owner] = true
+	}
+}
+
+// resolveSchemaRef resolves a ref against the $id resources and anchors of the loaded
+// documents. It returns false when the ref does not name one of them, so that it is
+// resolved as a plain file or document ref.
+func (r *Resolver) resolveSchemaRef(ctx context.Context, node *yaml.Node, ref string, baseDir string, config domain.Config, depth int, externalRoot *yaml.Node) (bool, error) {
+	uri := resolveURI(r.schemaBase(baseDir, externalRoot), ref)
+	r.lookup(resourceKey, schemaResourceKey(uri))
+	location, ok := r.schemaResources[schemaResourceKey(uri)]
+	_, fragment, _ := strings.Cut(uri, "#")
+	if !ok && fragment != "" && !strings.HasPrefix(fragment, "/") && !strings.HasPrefix(ref, "#") {
+		// An anchor of a file that was not loaded yet: loading it indexes its anchors
+		if refPath := r.getRefPath(ref, baseDir); refPath != "" && !isTextFile(refPath) {
+			if _, err := r.loadFile(ctx, refPath, config); err == nil {
+				location, ok = r.schemaResources[schemaResourceKey(uri)]
+			}
+		}
+	}
+	if ok && strings.HasPrefix(fragment, "/") {
+		location.pointer += fragment
+	}
+	if ok && location.file == "" {
+		r.lookupRoot()
+	}
+	if !ok || r.navigateToFragment(location.root, location.pointer) == nil {
+		return false, nil
+	}
+
+	if location.file == "" {
+		r.helper.SetRef(node, "#"+location.pointer)
+		return true, nil
+	}
+
+	return true, r.withRefIdentity(node, refIdentity(location.file, location.pointer), config, func() error {
+		return r.resolveRefWithFragment(ctx, node, location.root, location.pointer, location.file, config, depth)
+	})
+}
+
+// resolveDynamicRef points a $dynamicRef of a loaded file at the bundled location of its
+// target, which is hoisted into the root components when it would be inlined. The ref
+// then names its initial target with a JSON pointer; $dynamicRefs of the root document
+// are kept as written.
+func (r *Resolver) resolveDynamicRef(ctx context.Context, value *yaml.Node, baseDir string, config domain.Config, depth int, externalRoot *yaml.Node) error {
+	ref := value.Value
+	if value.Kind != yaml.ScalarNode || ref == "" || (strings.HasPrefix(ref, "#") && externalRoot == nil) {
+		return nil
+	}
+
+	// The target is resolved like the one of a $ref standing in for the keyword
+	target := r.helper.CreateRefNode(ref)
+	if err := r.resolveRef(ctx, target, ref, baseDir, config, depth, externalRoot); err != nil {
+		return err
+	}
+	internalRef := r.helper.GetRef(target)
+	if internalRef == "" {
+		identity := r.dynamicRefIdentity(ref, baseDir, externalRoot)
+		r.lookup(identityKey, identity)
+		var ok bool
+		if internalRef, ok = r.identityRefs[identity]; !ok {
+			claimed, err := r.circularComponentRef(identity, config)
+			if err != nil {
+				return err
+			}
+			internalRef = claimed
+			r.collectedComponents[internalRef] = target
+			r.collectedOrder = append(r.collectedOrder, internalRef)
+		}
+	}
+	if internalRef != ref {
+		value.Value = internalRef
+		r.markStaleIDs()
+	}
+	return nil
+}
+
+// dynamicRefIdentity returns the identity of the target of a $dynamicRef of a loaded file
+func (r *Resolver) dynamicRefIdentity(ref, baseDir string, externalRoot *yaml.Node) string {
+	resolved := resolveURI(r.schemaBase(baseDir, externalRoot), ref)
+	r.lookup(resourceKey, schemaResourceKey(resolved))
+	if location, ok := r.schemaResources[schemaResourceKey(resolved)]; ok {
+		if _, fragment, _ := strings.Cut(resolved, "#"); strings.HasPrefix(fragment, "/") {
+			location.pointer += fragment
+		}
+		return refIdentity(location.file, location.pointer)
+	}
+	if strings.HasPrefix(ref, "#") {
+		return refIdentity(r.nodeFiles[externalRoot], strings.TrimPrefix(ref, "#"))
+	}
+	return refIdentity(uri.Abs(r.getRefPath(ref, baseDir)), refFragment(ref))
+}
+
+// hoistSchemaDefs moves the $defs (or draft-04 definitions) of a schema file into the
+// root components, so refs into them from anywhere share one component
+func (r *Resolver) hoistSchemaDefs(ctx context.Context, content *yaml.Node, fileRoot *yaml.Node, baseDir string, config domain.Config, depth int) error {
+	for _, keyword := range []string{"$defs", "definitions"} {
+		defs := r.helper.GetMapValue(content, keyword)
+		if defs == nil || defs.Kind != yaml.MappingNode {
+			continue
+		}
+		for _, name := range r.helper.GetMapKeys(defs) {
+			fragment := strings.TrimPrefix(pointer.Format(keyword, name), "#")
+			if _, err := r.collectComponent(ctx, &yaml.Node{Kind: yaml.MappingNode}, fragment, fileRoot, baseDir, config, depth); err != nil {
+				return err
+			}
+		}
+		r.helper.DeleteMapKey(content, keyword)
+	}
+	return nil
+}
+
+// resolveURI resolves ref against base. Both may be URLs or absolute file paths.
+func resolveURI(base, ref string) string {
+	baseURL, err := url.Parse(base)
+	if err != nil {
+		return ref
+	}
+	refURL, err := url.Parse(ref)
+	if err != nil {
+		return ref
+	}
+	return baseURL.ResolveReference(refURL).String()
+}
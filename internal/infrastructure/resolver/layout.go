@@ -0,0 +1,216 @@
+package resolver
+
+import (
+	"strings"
+
+	"github.com/miorlan/openapi-bundler/internal/infrastructure/pointer"
+	"gopkg.in/yaml.v3"
+)
+
+// documentLayout describes where a kind of document keeps its reusable components
+type documentLayout struct {
+	// container is the root key holding the component sections, empty when they sit at the root
+	container string
+	// sections maps component types to their section keys, in document order
+	sections []layoutSection
+	// rootSections are the root keys outside components whose refs are resolved
+	rootSections []string
+	// hoistType returns the component type a whole external file referenced at path
+	// is hoisted as, or "" to inline it. Nil inlines all whole-file refs.
+	hoistType func(path []string) string
+}
+
+// layoutSection is one component section of a document layout
+type layoutSection struct {
+	componentType string
+	key           string
+}
+
+// openAPILayout keeps components under #/components/<type>
+var openAPILayout = func() documentLayout {
+	layout := documentLayout{
+		container:    "components",
+		rootSections: []string{"paths", "webhooks"},
+		hoistType:    openAPIHoistType,
+	}
+	for _, ct := range componentTypes {
+		layout.sections = append(layout.sections, layoutSection{componentType: ct, key: ct})
+	}
+	return layout
+}()
+
+// swaggerLayout keeps Swagger 2.0 definitions, parameters and responses at the root
+var swaggerLayout = documentLayout{
+	sections: []layoutSection{
+		{componentType: "schemas", key: "definitions"},
+		{componentType: "parameters", key: "parameters"},
+		{componentType: "responses", key: "responses"},
+		{componentType: "securitySchemes", key: "securityDefinitions"},
+	},
+	rootSections: []string{"paths"},
+}
+
+// openAPIHoistType hoists whole files referenced as webhooks into components.pathItems
+func openAPIHoistType(path []string) string {
+	if len(path) == 2 && path[0] == "webhooks" {
+		return "pathItems"
+	}
+	return ""
+}
+
+// asyncAPIComponentTypes lists the component sections of AsyncAPI 2.x and 3.x documents
+var asyncAPIComponentTypes = []string{
+	"schemas", "servers", "serverVariables", "channels", "operations", "messages", "securitySchemes",
+	"parameters", "correlationIds", "replies", "replyAddresses", "externalDocs", "tags",
+	"operationTraits", "messageTraits", "serverBindings", "channelBindings", "operationBindings", "messageBindings",
+}
+
+// asyncAPILayout keeps components under #/components/<type> and resolves servers,
+// channels and operations. Whole files referenced as messages, schemas, channels or
+// servers are hoisted into components.
+var asyncAPILayout = func() documentLayout {
+	layout := documentLayout{
+		container:    "components",
+		rootSections: []string{"servers", "channels", "operations"},
+		hoistType:    asyncAPIHoistType,
+	}
+	for _, ct := range asyncAPIComponentTypes {
+		layout.sections = append(layout.sections, layoutSection{componentType: ct, key: ct})
+	}
+	return layout
+}()
+
+// asyncAPIHoistType picks the component type of a whole file referenced at path.
+// Definitions directly under a root section or a component section stay where they are.
+func asyncAPIHoistType(path []string) string {
+	n := len(path)
+	if n < 3 || (path[0] == "components" && n < 4) {
+		return ""
+	}
+	last, parent := path[n-1], path[n-2]
+	switch {
+	case last == "message" || parent == "messages" || (parent == "oneOf" && path[n-3] == "message"):
+		return "messages"
+	case last == "channel":
+		return "channels"
+	case parent == "servers":
+		return "servers"
+	}
+	// Payloads and everything inside them are schemas
+	for _, token := range path[2:] {
+		if token == "payload" {
+			return "schemas"
+		}
+	}
+	return ""
+}
+
+// detectLayout picks the layout of a root document from its version field
+func detectLayout(root *yaml.Node) documentLayout {
+	helper := &NodeHelper{}
+	if helper.HasMapKey(root, "asyncapi") {
+		return asyncAPILayout
+	}
+	if version := helper.GetStringValue(helper.GetMapValue(root, "swagger")); strings.HasPrefix(version, "2.") {
+		return swaggerLayout
+	}
+	return openAPILayout
+}
+
+// sectionKey returns the key of the section holding components of a type
+func (l documentLayout) sectionKey(componentType string) (string, bool) {
+	for _, section := range l.sections {
+		if section.componentType == componentType {
+			return section.key, true
+		}
+	}
+	return "", false
+}
+
+// componentType returns the component type kept in the section with the given key
+func (l documentLayout) componentType(key string) (string, bool) {
+	for _, section := range l.sections {
+		if section.key == key {
+			return section.componentType, true
+		}
+	}
+	return "", false
+}
+
+// sectionType returns the component type of a section of the components node.
+// Inside a components object unknown sections keep their key as type; at the root they are not components.
+func (l documentLayout) sectionType(key string) (string, bool) {
+	if componentType, ok := l.componentType(key); ok {
+		return componentType, true
+	}
+	return key, l.container != ""
+}
+
+// holdsComponents reports whether a key of the root document holds components
+func (l documentLayout) holdsComponents(rootKey string) bool {
+	if l.container != "" {
+		return rootKey == l.container
+	}
+	_, ok := l.componentType(rootKey)
+	return ok
+}
+
+// ref builds an internal ref to a component of the root document
+func (l documentLayout) ref(componentType, name string) string {
+	return pointer.Format(l.refTokens(componentType, name)...)
+}
+
+// refTokens returns the path of a component of the root document
+func (l documentLayout) refTokens(componentType, name string) []string {
+	key, ok := l.sectionKey(componentType)
+	if !ok {
+		key = componentType
+	}
+	if l.container == "" {
+		return []string{key, name}
+	}
+	return []string{l.container, key, name}
+}
+
+// sectionPath names the section of a component type for messages, like components.schemas
+func (l documentLayout) sectionPath(componentType string) string {
+	key, ok := l.sectionKey(componentType)
+	if !ok {
+		key = componentType
+	}
+	if l.container == "" {
+		return key
+	}
+	return l.container + "." + key
+}
+
+// parseTokens splits the tokens of a component pointer into type and name
+func (l documentLayout) parseTokens(tokens []string) (string, string, bool) {
+	if l.container != "" {
+		if len(tokens) != 3 || tokens[0] != l.container {
+			return "", "", false
+		}
+		tokens = tokens[1:]
+	}
+	if len(tokens) != 2 || tokens[1] == "" {
+		return "", "", false
+	}
+	componentType, ok := l.componentType(tokens[0])
+	return componentType, tokens[1], ok
+}
+
+// componentsFragment returns the pointer of the node holding the component sections
+func (l documentLayout) componentsFragment() string {
+	if l.container == "" {
+		return ""
+	}
+	return "/" + l.container
+}
+
+// componentsNode returns the node holding the component sections of root, or nil
+func (l documentLayout) componentsNode(root *yaml.Node) *yaml.Node {
+	if l.container == "" {
+		return root
+	}
+	return (&NodeHelper{}).GetMapValue(root, l.container)
+}
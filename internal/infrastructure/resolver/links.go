@@ -0,0 +1,103 @@
+package resolver
+
+import (
+	"strings"
+
+	"github.com/miorlan/openapi-bundler/internal/infrastructure/pointer"
+	"github.com/miorlan/openapi-bundler/internal/infrastructure/uri"
+	"gopkg.in/yaml.v3"
+)
+
+// pendingOperationRef is a link operationRef pointing into another file
+type pendingOperationRef struct {
+	node     *yaml.Node
+	identity string
+}
+
+// recordLocation remembers that the content of identity now lives at the current path
+func (r *Resolver) recordLocation(identity string) {
+	if location := r.getCurrentJSONPointer(); location != "" {
+		r.lookup(identityKey, identity)
+		if _, exists := r.inlinedLocations[identity]; !exists {
+			r.inlinedLocations[identity] = location
+		}
+	}
+}
+
+// forgetLocations drops dedupe targets and locations recorded under an internal ref
+// that ended up unused, e.g. because the component was renamed
+func (r *Resolver) forgetLocations(ref string) {
+	r.lookup(nameKey, ref)
+	for hash, path := range r.schemaHashToPath {
+		if path == ref || strings.HasPrefix(path, ref+"/") {
+			delete(r.schemaHashToPath, hash)
+		}
+	}
+	for identity, location := range r.inlinedLocations {
+		if location == ref || strings.HasPrefix(location, ref+"/") {
+			delete(r.inlinedLocations, identity)
+		}
+	}
+}
+
+// trackOperationRef queues an operationRef into another file for resolveOperationRefs
+func (r *Resolver) trackOperationRef(node *yaml.Node, baseDir string, externalRoot *yaml.Node) {
+	ref := r.helper.GetStringValue(node)
+	if ref == "" {
+		return
+	}
+
+	var absPath string
+	if strings.HasPrefix(ref, "#") {
+		// Internal operationRefs of the root document are already correct
+		if externalRoot == nil {
+			return
+		}
+		absPath = r.nodeFiles[externalRoot]
+	} else {
+		refPath := r.getRefPath(ref, baseDir)
+		if refPath == "" {
+			return
+		}
+		absPath = uri.Abs(refPath)
+	}
+
+	r.operationRefs = append(r.operationRefs, pendingOperationRef{
+		node:     node,
+		identity: refIdentity(absPath, refFragment(ref)),
+	})
+}
+
+// resolveOperationRefs points operationRefs at the place their operation was inlined at.
+// Operations that are not part of the bundle keep their original reference.
+func (r *Resolver) resolveOperationRefs() {
+	for _, pending := range r.operationRefs {
+		if location, ok := r.locate(pending.identity); ok {
+			pending.node.Value = location
+		}
+	}
+}
+
+// locate finds where the content of file#fragment ended up in the bundle, also inside a larger inlined part
+func (r *Resolver) locate(identity string) (string, bool) {
+	absPath, fragment, _ := strings.Cut(identity, "#")
+	tokens, err := pointer.Parse(fragment)
+	if err != nil {
+		return "", false
+	}
+	for i := len(tokens); i >= 0; i-- {
+		prefix := strings.TrimPrefix(pointer.Format(tokens[:i]...), "#")
+		location, ok := r.inlinedLocations[refIdentity(absPath, prefix)]
+		if !ok {
+			// Hoisted content lives in its component
+			if location, ok = r.identityRefs[refIdentity(absPath, prefix)]; !ok {
+				continue
+			}
+		}
+		if i < len(tokens) {
+			location = strings.TrimSuffix(location, "/") + strings.TrimPrefix(pointer.Format(tokens[i:]...), "#")
+		}
+		return location, true
+	}
+	return "", false
+}
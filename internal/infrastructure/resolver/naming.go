@@ -0,0 +1,154 @@
+package resolver
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/miorlan/openapi-bundler/internal/domain"
+	"github.com/miorlan/openapi-bundler/internal/infrastructure/pointer"
+	"github.com/miorlan/openapi-bundler/internal/infrastructure/uri"
+	"gopkg.in/yaml.v3"
+)
+
+// claimComponentName returns the internal ref under which the component at identity is stored.
+// When the name is already used by a component from another source with different content,
+// the configured collision strategy picks a new name. A nil content is always treated as a conflict.
+func (r *Resolver) claimComponentName(componentType, name, identity string, content *yaml.Node, config domain.Config) (string, error) {
+	r.lookup(identityKey, identity)
+	if ref, ok := r.identityRefs[identity]; ok {
+		return ref, nil
+	}
+
+	internalRef := r.componentRef(componentType, name)
+	if !r.componentRefTaken(internalRef) {
+		r.registerComponentSource(internalRef, identity)
+		return internalRef, nil
+	}
+
+	// Same content under the same name is the same component
+	if content != nil {
+		if existing := r.componentContent(internalRef); existing != nil && r.hashNode(existing, domain.DedupeCanonical) == r.hashNode(content, domain.DedupeCanonical) {
+			r.identityRefs[identity] = internalRef
+			return internalRef, nil
+		}
+	}
+
+	newName, err := r.renameComponent(componentType, name, identity, config)
+	if err != nil {
+		return "", err
+	}
+
+	newRef := r.componentRef(componentType, newName)
+	r.registerComponentSource(newRef, identity)
+	r.report.Renames = append(r.report.Renames, domain.ComponentRename{
+		Type:   componentType,
+		From:   name,
+		To:     newName,
+		Source: r.displayIdentity(identity),
+	})
+	return newRef, nil
+}
+
+// renameComponent applies the collision strategy to a conflicting component name
+func (r *Resolver) renameComponent(componentType, name, identity string, config domain.Config) (string, error) {
+	switch config.NameCollisions {
+	case domain.NameCollisionFail:
+		return "", &domain.ErrComponentNameCollision{
+			Type:    componentType,
+			Name:    name,
+			Sources: []string{r.displayIdentity(r.componentSources[r.componentRef(componentType, name)]), r.displayIdentity(identity)},
+		}
+
+	case domain.NameCollisionPrefix:
+		base := sourcePrefix(identity, name) + name
+		return r.freeComponentName(componentType, base), nil
+
+	default:
+		return r.freeComponentName(componentType, name), nil
+	}
+}
+
+// freeComponentName returns base, or base with the first free numeric suffix
+func (r *Resolver) freeComponentName(componentType, base string) string {
+	name := base
+	for i := 2; r.componentRefTaken(r.componentRef(componentType, name)); i++ {
+		name = fmt.Sprintf("%s%d", base, i)
+	}
+	return name
+}
+
+// componentRefTaken reports whether an internal component ref is already in use
+func (r *Resolver) componentRefTaken(ref string) bool {
+	r.lookup(nameKey, ref)
+	if r.globalComponents[ref] {
+		return true
+	}
+	if _, ok := r.collectedComponents[ref]; ok {
+		return true
+	}
+	_, ok := r.componentSources[ref]
+	return ok
+}
+
+// componentContent returns the current content of a root or collected component
+func (r *Resolver) componentContent(ref string) *yaml.Node {
+	r.lookup(nameKey, ref)
+	if content, ok := r.collectedComponents[ref]; ok {
+		return content
+	}
+	if r.rootNode == nil {
+		return nil
+	}
+	return r.navigateToFragment(r.rootNode, strings.TrimPrefix(ref, "#"))
+}
+
+// registerComponentSource records which file#fragment a component comes from
+func (r *Resolver) registerComponentSource(ref, identity string) {
+	if _, ok := r.componentSources[ref]; !ok {
+		r.componentSources[ref] = identity
+	}
+	if identity != "" {
+		r.identityRefs[identity] = ref
+	}
+}
+
+// registerSectionSources records the source of every component of a section loaded from a file
+func (r *Resolver) registerSectionSources(sectionNode *yaml.Node, componentType, absPath, fragment string) {
+	_ = r.helper.IterateMap(sectionNode, func(name string, _ *yaml.Node) error {
+		r.registerComponentSource(r.componentRef(componentType, name), refIdentity(absPath, fragment+"/"+pointer.Escape(name)))
+		return nil
+	})
+}
+
+// sourcePrefix builds a PascalCase prefix from the file a component comes from.
+// Generic file names fall back to the directory name.
+func sourcePrefix(identity, name string) string {
+	absPath, _, _ := strings.Cut(identity, "#")
+	base := strings.TrimSuffix(uri.Base(absPath), filepath.Ext(uri.Base(absPath)))
+	switch strings.ToLower(base) {
+	case strings.ToLower(name), "index", "openapi", "components", "common", "shared", "models", "types", "definitions", "errors",
+		"schemas", "parameters", "responses", "headers", "examples", "requestbodies":
+		base = uri.Base(uri.Dir(absPath))
+	}
+	return PascalCase(base)
+}
+
+// PascalCase converts a file, directory or service name like "billing-api" to "BillingApi"
+func PascalCase(s string) string {
+	var b strings.Builder
+	upper := true
+	for _, c := range s {
+		if !unicode.IsLetter(c) && !unicode.IsDigit(c) {
+			upper = true
+			continue
+		}
+		if upper {
+			c = unicode.ToUpper(c)
+			upper = false
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
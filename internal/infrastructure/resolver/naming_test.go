@@ -0,0 +1,16 @@
+package resolver
+
+import "testing"
+
+func TestPascalCase(t *testing.T) {
+	tests := map[string]string{
+		"billing":     "Billing",
+		"billing-api": "BillingApi",
+		"user_v2":     "UserV2",
+	}
+	for name, want := range tests {
+		if got := PascalCase(name); got != want {
+			t.Errorf("PascalCase(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
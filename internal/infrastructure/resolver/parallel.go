@@ -0,0 +1,261 @@
+package resolver
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"sync"
+
+	"github.com/miorlan/openapi-bundler/internal/domain"
+	"gopkg.in/yaml.v3"
+)
+
+// stateKind is a kind of key of the resolver state that path items resolved in
+// parallel may share
+type stateKind int
+
+const (
+	fileKey     stateKind = iota // loaded files and example assets
+	nameKey                      // internal refs of components
+	identityKey                  // file#fragment identities of ref targets
+	hashKey                      // dedupe hashes of schemas
+	resourceKey                  // $id and anchor URIs
+	stateKinds
+)
+
+// footprint holds the keys of the resolver state a fork looked up or changed
+type footprint struct {
+	keys [stateKinds]map[string]bool
+	// root is set when the fork read the root document outside its components,
+	// which the other path items are resolved into
+	root bool
+}
+
+func newFootprint() *footprint {
+	f := &footprint{}
+	for kind := range f.keys {
+		f.keys[kind] = make(map[string]bool)
+	}
+	return f
+}
+
+// overlaps reports whether the lookups in f depend on the state written changed
+func (f *footprint) overlaps(written *footprint) bool {
+	if f.root {
+		return true
+	}
+	for kind, keys := range f.keys {
+		for key := range keys {
+			if written.keys[kind][key] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// add records the keys of other in f
+func (f *footprint) add(other *footprint) {
+	for kind, keys := range other.keys {
+		for key := range keys {
+			f.keys[kind][key] = true
+		}
+	}
+}
+
+// lookup records that the resolver read the state under key, when it is a fork
+func (r *Resolver) lookup(kind stateKind, key string) {
+	if r.reads != nil {
+		r.reads.keys[kind][key] = true
+	}
+}
+
+// lookupRoot records that the resolver read the root document outside its components
+func (r *Resolver) lookupRoot() {
+	if r.reads != nil {
+		r.reads.root = true
+	}
+}
+
+// forkResult is an item of a root section resolved by a fork of the resolver
+type forkResult struct {
+	node    *yaml.Node // resolved copy of the item
+	reads   *footprint
+	written *footprint
+	apply   []func(*Resolver)
+	err     error
+}
+
+// resolveSection resolves the refs of a root section like paths. With a concurrency
+// above 1 its items are resolved in parallel, each by a fork of the resolver working
+// on a copy of the item and of the state. The forks are then taken over in document
+// order. One that looked up state an earlier item changed could have resolved
+// differently after it, so that item is resolved again: the bundle is always the one
+// the sequential walk produces.
+func (r *Resolver) resolveSection(ctx context.Context, sectionNode *yaml.Node, baseDir string, config domain.Config) error {
+	if config.Concurrency <= 1 || !r.splitsIntoItems(sectionNode) {
+		return r.resolveRefs(ctx, sectionNode, baseDir, config, 0)
+	}
+
+	items := len(sectionNode.Content) / 2
+	results := make([]forkResult, items)
+	sem := make(chan struct{}, config.Concurrency)
+	var wg sync.WaitGroup
+	for i := 0; i < items; i++ {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			results[i] = r.resolveFork(ctx, sectionNode.Content[2*i].Value, sectionNode.Content[2*i+1], baseDir, config)
+		}(i)
+	}
+	wg.Wait()
+
+	written := newFootprint()
+	for i, result := range results {
+		key, item := sectionNode.Content[2*i].Value, sectionNode.Content[2*i+1]
+		if result.err != nil || result.reads.overlaps(written) {
+			result = r.resolveFork(ctx, key, item, baseDir, config)
+			if result.err != nil {
+				return result.err
+			}
+		}
+		for _, apply := range result.apply {
+			apply(r)
+		}
+		*item = *result.node
+		written.add(result.written)
+	}
+	return nil
+}
+
+// splitsIntoItems reports whether the items of a root section can be resolved on their
+// own: the section is a mapping with no keys that resolveRefs handles at its level
+func (r *Resolver) splitsIntoItems(sectionNode *yaml.Node) bool {
+	if sectionNode.Kind != yaml.MappingNode || len(sectionNode.Content) < 4 {
+		return false
+	}
+	for _, key := range []string{"$ref", "$id", "$dynamicRef", "operationRef", "externalValue"} {
+		if r.helper.HasMapKey(sectionNode, key) {
+			return false
+		}
+	}
+	return true
+}
+
+// resolveFork resolves a copy of the section item under key in a fork of the resolver
+func (r *Resolver) resolveFork(ctx context.Context, key string, item *yaml.Node, baseDir string, config domain.Config) forkResult {
+	fork := r.fork()
+	node := r.helper.CloneNode(item)
+	fork.pushPath(key)
+	err := fork.resolveRefsWithContext(ctx, node, baseDir, config, 1, nil)
+	fork.popPath()
+	if err != nil {
+		return forkResult{err: err}
+	}
+
+	written := newFootprint()
+	return forkResult{node: node, reads: fork.reads, written: written, apply: fork.changes(r, written)}
+}
+
+// fork returns a resolver sharing the loaded documents of r with its own copy of the
+// state, which records what it looks up
+func (r *Resolver) fork() *Resolver {
+	fork := *r
+	fork.currentPath = slices.Clone(r.currentPath)
+	fork.refStack = slices.Clone(r.refStack)
+	fork.idScopes = slices.Clone(r.idScopes)
+	fork.fileCache = maps.Clone(r.fileCache)
+	fork.nodeFiles = maps.Clone(r.nodeFiles)
+	fork.circularTargets = maps.Clone(r.circularTargets)
+	fork.schemaHashToPath = maps.Clone(r.schemaHashToPath)
+	fork.collectedComponents = maps.Clone(r.collectedComponents)
+	fork.collectedOrder = slices.Clone(r.collectedOrder)
+	fork.componentSources = maps.Clone(r.componentSources)
+	fork.identityRefs = maps.Clone(r.identityRefs)
+	fork.inlinedLocations = maps.Clone(r.inlinedLocations)
+	fork.operationRefs = nil
+	fork.schemaResources = maps.Clone(r.schemaResources)
+	fork.staleIDs = maps.Clone(r.staleIDs)
+	fork.assetPaths = maps.Clone(r.assetPaths)
+	fork.report = &domain.Report{Assets: slices.Clone(r.report.Assets)}
+	fork.reads = newFootprint()
+	return &fork
+}
+
+// changes returns functions applying what r, a fork of base, changed in the state to
+// another resolver. The keys it wrote go to written.
+func (r *Resolver) changes(base *Resolver, written *footprint) []func(*Resolver) {
+	files, names, identities := written.keys[fileKey], written.keys[nameKey], written.keys[identityKey]
+	collected := r.collectedOrder[len(base.collectedOrder):]
+	assets := r.report.Assets[len(base.report.Assets):]
+	for _, asset := range assets {
+		files[asset.Source] = true
+	}
+
+	return []func(*Resolver){
+		changeMap(base.fileCache, r.fileCache, files, func(target *Resolver) map[string]*yaml.Node { return target.fileCache }),
+		changeMap(base.nodeFiles, r.nodeFiles, nil, func(target *Resolver) map[*yaml.Node]string { return target.nodeFiles }),
+		changeMap(base.circularTargets, r.circularTargets, identities, func(target *Resolver) map[string]string { return target.circularTargets }),
+		changeMap(base.schemaHashToPath, r.schemaHashToPath, written.keys[hashKey], func(target *Resolver) map[string]string { return target.schemaHashToPath }),
+		changeMap(base.collectedComponents, r.collectedComponents, names, func(target *Resolver) map[string]*yaml.Node { return target.collectedComponents }),
+		changeMap(base.componentSources, r.componentSources, names, func(target *Resolver) map[string]string { return target.componentSources }),
+		changeMap(base.identityRefs, r.identityRefs, identities, func(target *Resolver) map[string]string { return target.identityRefs }),
+		changeMap(base.inlinedLocations, r.inlinedLocations, identities, func(target *Resolver) map[string]string { return target.inlinedLocations }),
+		changeMap(base.schemaResources, r.schemaResources, written.keys[resourceKey], func(target *Resolver) map[string]schemaLocation { return target.schemaResources }),
+		changeMap(base.staleIDs, r.staleIDs, nil, func(target *Resolver) map[*yaml.Node]bool { return target.staleIDs }),
+		changeMap(base.assetPaths, r.assetPaths, files, func(target *Resolver) map[string]bool { return target.assetPaths }),
+		func(target *Resolver) {
+			target.collectedOrder = append(target.collectedOrder, collected...)
+			target.operationRefs = append(target.operationRefs, r.operationRefs...)
+			target.report.Renames = append(target.report.Renames, r.report.Renames...)
+			target.report.Warnings = append(target.report.Warnings, r.report.Warnings...)
+			target.report.Assets = append(target.report.Assets, assets...)
+		},
+	}
+}
+
+// changeMap compares a map of a fork with the same map of its base and returns a
+// function applying the difference to the map field selects. Changed keys of string
+// maps are recorded in written.
+func changeMap[K comparable, V comparable](base, fork map[K]V, written map[string]bool, field func(*Resolver) map[K]V) func(*Resolver) {
+	set := make(map[K]V)
+	var deleted []K
+	for key, value := range fork {
+		if old, ok := base[key]; !ok || old != value {
+			set[key] = value
+		}
+	}
+	for key := range base {
+		if _, ok := fork[key]; !ok {
+			deleted = append(deleted, key)
+		}
+	}
+
+	if written != nil {
+		record := func(key K) {
+			if s, ok := any(key).(string); ok {
+				written[s] = true
+			}
+		}
+		for key := range set {
+			record(key)
+		}
+		for _, key := range deleted {
+			record(key)
+		}
+	}
+
+	return func(r *Resolver) {
+		m := field(r)
+		for key, value := range set {
+			m[key] = value
+		}
+		for _, key := range deleted {
+			delete(m, key)
+		}
+	}
+}
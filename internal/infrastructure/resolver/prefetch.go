@@ -0,0 +1,170 @@
+package resolver
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/miorlan/openapi-bundler/internal/domain"
+	"github.com/miorlan/openapi-bundler/internal/infrastructure/uri"
+	"gopkg.in/yaml.v3"
+)
+
+// prefetchedFile is a file loaded ahead of the resolution walk
+type prefetchedFile struct {
+	data []byte
+	// node is the parsed document, nil for text files and files that failed to parse
+	node *yaml.Node
+}
+
+// prefetch loads the external files of the ref graph before it is resolved. The graph
+// is discovered level by level: the files of a level are loaded concurrently through
+// LoadMany and parsed concurrently, then their refs make up the next level. The walk
+// that follows reads them from memory in its usual order, so the bundle does not
+// depend on scheduling. Files that fail here are loaded again when the walk reaches
+// them and report their error then.
+//
+// The path items are resolved in parallel afterwards, see resolveSection.
+//
+// In OpenAPI 3.1 documents a remote ref may name a $id resource or anchor that one
+// of the files defines rather than a file to download. Such refs wait until the other
+// files are loaded and indexed, and are skipped if they turn out to be resources.
+func (r *Resolver) prefetch(ctx context.Context, root *yaml.Node, basePath string) {
+	batch, ok := r.fileLoader.(domain.BatchFileLoader)
+	if !ok {
+		return
+	}
+
+	resources := make(map[string]bool, len(r.schemaResources))
+	for uri := range r.schemaResources {
+		resources[uri] = true
+	}
+
+	seen := make(map[string]bool)
+	var deferred []prefetchRef
+	pending := r.externalRefs(root, basePath, strings.TrimSuffix(basePath, "/")+"/", seen, nil)
+	for ctx.Err() == nil {
+		var paths []string
+		for _, ref := range pending {
+			switch {
+			case resources[ref.resource]:
+			case ref.resource != "" && uri.IsRemote(ref.path):
+				deferred = append(deferred, ref)
+			default:
+				paths = append(paths, ref.path)
+			}
+		}
+		if len(paths) == 0 {
+			if len(deferred) == 0 {
+				return
+			}
+			// Every file that could define the deferred resources is loaded
+			pending, deferred = deferred, nil
+			for _, ref := range pending {
+				if !resources[ref.resource] {
+					paths = append(paths, ref.path)
+				}
+			}
+			if len(paths) == 0 {
+				return
+			}
+		}
+		files, _ := batch.LoadMany(ctx, paths)
+
+		nodes := make([]*yaml.Node, len(paths))
+		var wg sync.WaitGroup
+		for i, path := range paths {
+			data, ok := files[path]
+			if !ok || isTextFile(path) {
+				continue
+			}
+			wg.Add(1)
+			go func(i int, data []byte) {
+				defer wg.Done()
+				var node yaml.Node
+				if err := yaml.Unmarshal(data, &node); err == nil {
+					nodes[i] = &node
+				}
+			}(i, data)
+		}
+		wg.Wait()
+
+		// Index the resources of the whole level before its refs are checked against them
+		for i, path := range paths {
+			if nodes[i] != nil && r.usesJSONSchema2020() {
+				r.walkSchemaResources(documentRoot(nodes[i]), path, func(uri string, _ []string) {
+					resources[uri] = true
+				})
+			}
+		}
+
+		pending = nil
+		for i, path := range paths {
+			data, ok := files[path]
+			if !ok {
+				continue
+			}
+			r.prefetched[path] = prefetchedFile{data: data, node: nodes[i]}
+			if nodes[i] != nil {
+				pending = r.externalRefs(nodes[i], uri.Dir(path), resolveURI(path, ""), seen, pending)
+			}
+		}
+	}
+}
+
+// prefetchRef is a file to prefetch. In OpenAPI 3.1 documents resource is the key the
+// ref is looked up under in the $id resources and anchors.
+type prefetchRef struct {
+	path     string
+	resource string
+}
+
+// externalRefs appends the files referenced within node that were not seen yet.
+// schemaBase is the base URI of JSON Schema refs, changed by $id.
+func (r *Resolver) externalRefs(node *yaml.Node, baseDir, schemaBase string, seen map[string]bool, refs []prefetchRef) []prefetchRef {
+	switch node.Kind {
+	case yaml.DocumentNode, yaml.SequenceNode:
+		for _, child := range node.Content {
+			refs = r.externalRefs(child, baseDir, schemaBase, seen, refs)
+		}
+	case yaml.MappingNode:
+		jsonSchema := r.usesJSONSchema2020()
+		if id := r.helper.GetStringValue(r.helper.GetMapValue(node, "$id")); id != "" && jsonSchema {
+			schemaBase, _, _ = strings.Cut(resolveURI(schemaBase, id), "#")
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i].Value, node.Content[i+1]
+			if (key == "$ref" || key == "$dynamicRef" && jsonSchema) && value.Kind == yaml.ScalarNode {
+				if refPath := r.getRefPath(value.Value, baseDir); refPath != "" {
+					if path := uri.Abs(refPath); !seen[path] {
+						seen[path] = true
+						ref := prefetchRef{path: path}
+						if jsonSchema {
+							ref.resource = schemaResourceKey(resolveURI(schemaBase, value.Value))
+						}
+						refs = append(refs, ref)
+					}
+				}
+				continue
+			}
+			refs = r.externalRefs(value, baseDir, schemaBase, seen, refs)
+		}
+	}
+	return refs
+}
+
+// documentRoot returns the content of a document node
+func documentRoot(node *yaml.Node) *yaml.Node {
+	if node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		return node.Content[0]
+	}
+	return node
+}
+
+// load returns the content of a file, prefetched or loaded now
+func (r *Resolver) load(ctx context.Context, path string) ([]byte, error) {
+	if file, ok := r.prefetched[uri.Abs(path)]; ok {
+		return file.data, nil
+	}
+	return r.fileLoader.Load(ctx, path)
+}
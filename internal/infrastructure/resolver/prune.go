@@ -0,0 +1,151 @@
+package resolver
+
+import (
+	"strings"
+
+	"github.com/miorlan/openapi-bundler/internal/domain"
+	"github.com/miorlan/openapi-bundler/internal/infrastructure/pointer"
+	"gopkg.in/yaml.v3"
+)
+
+// removeUnused drops the components that nothing outside the components refers to,
+// directly or through other components. Security requirements reach security schemes
+// by name and discriminator mappings reach schemas by ref or name. Components marked
+// with x-keep: true or listed in config.KeepComponents are kept with everything they use.
+func (r *Resolver) removeUnused(root *yaml.Node, config domain.Config) {
+	componentsNode := r.layout.componentsNode(root)
+	if componentsNode == nil || componentsNode.Kind != yaml.MappingNode {
+		return
+	}
+
+	keep := make(map[string]bool, len(config.KeepComponents))
+	for _, name := range config.KeepComponents {
+		keep[name] = true
+	}
+
+	used := make(map[string]bool)
+	var walk func(node *yaml.Node)
+	reach := func(componentType, name string) {
+		ref := r.componentRef(componentType, name)
+		if used[ref] {
+			return
+		}
+		if content := r.navigateToFragment(root, strings.TrimPrefix(ref, "#")); content != nil {
+			used[ref] = true
+			walk(content)
+		}
+	}
+	reachRef := func(ref string) {
+		if !strings.HasPrefix(ref, "#") {
+			return
+		}
+		tokens, err := pointer.Parse(ref)
+		if err != nil {
+			return
+		}
+		// Refs into a component, like #/components/schemas/Pet/properties/id, use it as a whole
+		n := 2
+		if r.layout.container != "" {
+			n = 3
+		}
+		if len(tokens) < n {
+			return
+		}
+		if componentType, name, ok := r.layout.parseTokens(tokens[:n]); ok {
+			reach(componentType, name)
+		}
+	}
+	walkEntry := func(key string, value *yaml.Node) {
+		switch {
+		case (key == "$ref" || key == "$dynamicRef") && value.Kind == yaml.ScalarNode:
+			reachRef(value.Value)
+		case key == "security" && value.Kind == yaml.SequenceNode:
+			for _, requirement := range value.Content {
+				if requirement.Kind == yaml.MappingNode && !r.helper.IsRef(requirement) {
+					for _, scheme := range r.helper.GetMapKeys(requirement) {
+						reach("securitySchemes", scheme)
+					}
+				}
+			}
+		case key == "discriminator":
+			_ = r.helper.IterateMap(r.helper.GetMapValue(value, "mapping"), func(_ string, target *yaml.Node) error {
+				if target.Value != "" && !strings.Contains(target.Value, "#") && !strings.Contains(target.Value, "/") {
+					reach("schemas", target.Value)
+				} else {
+					reachRef(target.Value)
+				}
+				return nil
+			})
+		}
+		walk(value)
+	}
+	walk = func(node *yaml.Node) {
+		switch node.Kind {
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				walkEntry(node.Content[i].Value, node.Content[i+1])
+			}
+		case yaml.SequenceNode:
+			for _, child := range node.Content {
+				walk(child)
+			}
+		}
+	}
+
+	// Everything outside the components is in use, along with the components kept on purpose
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if !r.layout.holdsComponents(root.Content[i].Value) {
+			walkEntry(root.Content[i].Value, root.Content[i+1])
+		}
+	}
+	r.iteratePrunableComponents(componentsNode, func(componentType, name string, content *yaml.Node) {
+		marker := r.helper.GetMapValue(content, "x-keep")
+		if keep[name] || keep[componentType+"/"+name] || (marker != nil && marker.Value == "true") {
+			reach(componentType, name)
+		}
+	})
+
+	r.iteratePrunableComponents(componentsNode, func(componentType, name string, _ *yaml.Node) {
+		if used[r.componentRef(componentType, name)] {
+			return
+		}
+		key, _ := r.layout.sectionKey(componentType)
+		if key == "" {
+			key = componentType
+		}
+		section := r.helper.GetMapValue(componentsNode, key)
+		r.helper.DeleteMapKey(section, name)
+		if len(section.Content) == 0 {
+			r.helper.DeleteMapKey(componentsNode, key)
+		}
+		r.report.Removed = append(r.report.Removed, r.layout.sectionPath(componentType)+"."+name)
+	})
+
+	if r.layout.container != "" && len(componentsNode.Content) == 0 {
+		r.helper.DeleteMapKey(root, r.layout.container)
+	}
+}
+
+// iteratePrunableComponents calls fn for every component of the component sections, in
+// document order. Extensions and sections that are not a map of components are skipped.
+func (r *Resolver) iteratePrunableComponents(componentsNode *yaml.Node, fn func(componentType, name string, content *yaml.Node)) {
+	type component struct {
+		componentType, name string
+		content             *yaml.Node
+	}
+	var components []component
+	_ = r.helper.IterateMap(componentsNode, func(key string, section *yaml.Node) error {
+		componentType, ok := r.layout.sectionType(key)
+		if !ok || strings.HasPrefix(key, "x-") || section.Kind != yaml.MappingNode {
+			return nil
+		}
+		return r.helper.IterateMap(section, func(name string, content *yaml.Node) error {
+			components = append(components, component{componentType, name, content})
+			return nil
+		})
+	})
+	// fn may delete from the sections, so they are collected first
+	for _, c := range components {
+		fn(c.componentType, c.name, c.content)
+	}
+}
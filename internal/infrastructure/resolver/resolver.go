@@ -5,13 +5,18 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
+	"math"
 	"net/url"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/miorlan/openapi-bundler/internal/domain"
 	"github.com/miorlan/openapi-bundler/internal/infrastructure/errors"
+	"github.com/miorlan/openapi-bundler/internal/infrastructure/pointer"
+	"github.com/miorlan/openapi-bundler/internal/infrastructure/uri"
 	"gopkg.in/yaml.v3"
 )
 
@@ -19,7 +24,7 @@ import (
 type Resolver struct {
 	fileLoader  domain.FileLoader
 	fileCache   map[string]*yaml.Node
-	visited     map[string]bool
+	prefetched  map[string]prefetchedFile
 	helper      *NodeHelper
 	rootNode    *yaml.Node
 	rootBaseDir string
@@ -27,23 +32,59 @@ type Resolver struct {
 	// Path tracking for JSON pointers
 	currentPath []string
 
+	// Circular reference tracking: chain of file#fragment identities being resolved,
+	// files of loaded roots and internal refs assigned to cycle targets
+	refStack        []string
+	nodeFiles       map[*yaml.Node]string
+	circularTargets map[string]string
+
 	// Base directories for different sections
-	pathsBaseDir      string
+	sectionsBaseDir   map[string]string
 	componentsBaseDir map[string]string
 
 	// Mappings for reference resolution
-	globalSchemaNames  map[string]bool
+	globalComponents   map[string]bool
 	schemaFileToName   map[string]string
 	componentFileToRef map[string]string
 
 	// Deduplication
 	schemaHashToPath map[string]string
 
-	// Collected schemas from external components.json files (ordered)
-	collectedSchemas      map[string]*yaml.Node
-	collectedSchemasOrder []string
+	// Components collected from external files, keyed by internal ref (ordered)
+	collectedComponents map[string]*yaml.Node
+	collectedOrder      []string
+
+	// Component sources: internal ref -> file#fragment it came from, and back
+	componentSources map[string]string
+	identityRefs     map[string]string
+
+	// Locations in the bundle that external content was inlined at, by file#fragment,
+	// and link operationRefs waiting for them
+	inlinedLocations map[string]string
+	operationRefs    []pendingOperationRef
+
+	// JSON Schema 2020-12: version of the root document, $id resources and anchors
+	// by absolute URI, $id scopes enclosing the node being resolved and $ids to drop
+	openAPIVersion  string
+	schemaResources map[string]schemaLocation
+	idScopes        []idScope
+	staleIDs        map[*yaml.Node]bool
+
+	// Where the root document keeps its components (OpenAPI 3.x or Swagger 2.0)
+	layout documentLayout
+
+	// Paths of the example files copied next to the bundle
+	assetPaths map[string]bool
+
+	report *domain.Report
+
+	// What a fork resolving a path item in parallel looked up, nil otherwise
+	reads *footprint
 }
 
+// componentTypes lists the component sections of an OpenAPI document
+var componentTypes = []string{"schemas", "responses", "parameters", "examples", "requestBodies", "headers", "securitySchemes", "links", "callbacks", "pathItems"}
+
 // NewResolver creates a new Resolver
 func NewResolver(fileLoader domain.FileLoader) *Resolver {
 	return &Resolver{
@@ -66,6 +107,9 @@ func (r *Resolver) ResolveNode(ctx context.Context, node *yaml.Node, basePath st
 	}
 
 	r.rootNode = node
+	r.layout = detectLayout(node)
+	r.openAPIVersion = r.helper.GetStringValue(r.helper.GetMapValue(node, "openapi"))
+	r.indexSchemaResources(node, "", strings.TrimSuffix(basePath, "/")+"/")
 	return r.expandAndResolve(ctx, node, basePath, config)
 }
 
@@ -73,22 +117,48 @@ func (r *Resolver) ResolveNode(ctx context.Context, node *yaml.Node, basePath st
 func (r *Resolver) reset(basePath string) {
 	r.rootBaseDir = basePath
 	r.fileCache = make(map[string]*yaml.Node)
-	r.visited = make(map[string]bool)
+	r.prefetched = make(map[string]prefetchedFile)
 	r.currentPath = nil
-	r.pathsBaseDir = ""
+	r.refStack = nil
+	r.nodeFiles = make(map[*yaml.Node]string)
+	r.circularTargets = make(map[string]string)
+	r.sectionsBaseDir = make(map[string]string)
 	r.componentsBaseDir = make(map[string]string)
-	r.globalSchemaNames = make(map[string]bool)
+	r.globalComponents = make(map[string]bool)
 	r.schemaFileToName = make(map[string]string)
 	r.componentFileToRef = make(map[string]string)
 	r.schemaHashToPath = make(map[string]string)
-	r.collectedSchemas = make(map[string]*yaml.Node)
-	r.collectedSchemasOrder = nil
+	r.collectedComponents = make(map[string]*yaml.Node)
+	r.collectedOrder = nil
+	r.componentSources = make(map[string]string)
+	r.identityRefs = make(map[string]string)
+	r.inlinedLocations = make(map[string]string)
+	r.operationRefs = nil
+	r.layout = openAPILayout
+	r.openAPIVersion = ""
+	r.schemaResources = make(map[string]schemaLocation)
+	r.idScopes = nil
+	r.staleIDs = make(map[*yaml.Node]bool)
+	r.assetPaths = make(map[string]bool)
+	r.report = &domain.Report{}
+}
+
+// Report returns the changes made during the last ResolveNode call
+func (r *Resolver) Report() *domain.Report {
+	return r.report
 }
 
 // expandAndResolve expands sections and resolves references in the correct order
 func (r *Resolver) expandAndResolve(ctx context.Context, node *yaml.Node, basePath string, config domain.Config) error {
-	componentsNode := r.helper.GetMapValue(node, "components")
-	pathsNode := r.helper.GetMapValue(node, "paths")
+	// Load the external files of the ref graph concurrently
+	r.prefetch(ctx, node, basePath)
+
+	// Text files may be included anywhere in the root document, like info.description
+	if err := r.includeTextRefs(ctx, node, basePath, config); err != nil {
+		return err
+	}
+
+	componentsNode := r.layout.componentsNode(node)
 
 	// Phase 1: Expand all sections (load external files)
 	if componentsNode != nil {
@@ -97,9 +167,11 @@ func (r *Resolver) expandAndResolve(ctx context.Context, node *yaml.Node, basePa
 		}
 	}
 
-	if pathsNode != nil {
-		if err := r.expandPaths(ctx, pathsNode, basePath, config); err != nil {
-			return err
+	for _, section := range r.layout.rootSections {
+		if sectionNode := r.helper.GetMapValue(node, section); sectionNode != nil {
+			if err := r.expandRootSection(ctx, sectionNode, section, basePath, config); err != nil {
+				return err
+			}
 		}
 	}
 
@@ -109,65 +181,89 @@ func (r *Resolver) expandAndResolve(ctx context.Context, node *yaml.Node, basePa
 			return err
 		}
 		// Register hashes for sub-elements (items, etc.) for deduplication in paths
-		r.registerSchemaSubElements(componentsNode)
+		r.registerSchemaSubElements(componentsNode, config)
 	}
 
-	// Phase 3: Resolve refs in paths (schemas already resolved, deduplication will work)
-	if pathsNode != nil {
-		baseDir := r.pathsBaseDir
+	// Phase 3: Resolve refs in paths and other root sections (schemas already resolved, deduplication will work)
+	for _, section := range r.layout.rootSections {
+		sectionNode := r.helper.GetMapValue(node, section)
+		if sectionNode == nil {
+			continue
+		}
+		baseDir := r.sectionsBaseDir[section]
 		if baseDir == "" {
 			baseDir = basePath
 		}
-		r.pushPath("paths")
-		if err := r.resolveRefs(ctx, pathsNode, baseDir, config, 0); err != nil {
+		r.pushPath(section)
+		if err := r.resolveSection(ctx, sectionNode, baseDir, config); err != nil {
 			r.popPath()
 			return err
 		}
 		r.popPath()
 	}
 
-	// Phase 4: Add collected schemas to components/schemas
-	if len(r.collectedSchemas) > 0 {
-		r.addCollectedSchemasToComponents(node)
+	// Links can only be resolved once every operation has its place in the bundle
+	r.resolveOperationRefs()
+
+	// Phase 4: Add collected components to the root components
+	if len(r.collectedComponents) > 0 {
+		r.addCollectedComponents(node)
+	}
+
+	// Phase 5: Keep only the operations the filter selects
+	if !config.Operations.IsEmpty() {
+		r.filterOperations(node, config.Operations)
+	}
+
+	// Phase 6: Replace remaining internal refs with their content
+	if config.Inline {
+		r.dereference(node, config)
+	}
+
+	// Phase 7: Drop the components nothing refers to any more
+	if config.RemoveUnused || !config.Operations.IsEmpty() {
+		r.removeUnused(node, config)
 	}
 
 	return nil
 }
 
-// addCollectedSchemasToComponents adds collected schemas to the root components/schemas
-func (r *Resolver) addCollectedSchemasToComponents(rootNode *yaml.Node) {
+// addCollectedComponents adds collected components to the root components section
+func (r *Resolver) addCollectedComponents(rootNode *yaml.Node) {
 	// Get or create components node
-	componentsNode := r.helper.GetMapValue(rootNode, "components")
+	componentsNode := r.layout.componentsNode(rootNode)
 	if componentsNode == nil {
 		componentsNode = &yaml.Node{Kind: yaml.MappingNode}
 		rootNode.Content = append(rootNode.Content,
-			&yaml.Node{Kind: yaml.ScalarNode, Value: "components"},
+			&yaml.Node{Kind: yaml.ScalarNode, Value: r.layout.container},
 			componentsNode,
 		)
 	}
 
-	// Get or create schemas node
-	schemasNode := r.helper.GetMapValue(componentsNode, "schemas")
-	if schemasNode == nil {
-		schemasNode = &yaml.Node{Kind: yaml.MappingNode}
-		componentsNode.Content = append(componentsNode.Content,
-			&yaml.Node{Kind: yaml.ScalarNode, Value: "schemas"},
-			schemasNode,
-		)
-	}
+	// Add collected components in order they were discovered
+	for _, ref := range r.collectedOrder {
+		componentType, name, _ := r.parseComponentFragment(strings.TrimPrefix(ref, "#"))
+		sectionKey, _ := r.layout.sectionKey(componentType)
 
-	// Add collected schemas in order they were discovered
-	for _, name := range r.collectedSchemasOrder {
-		schema := r.collectedSchemas[name]
-		// Check if schema already exists
-		if r.helper.GetMapValue(schemasNode, name) != nil {
+		// Get or create section node
+		sectionNode := r.helper.GetMapValue(componentsNode, sectionKey)
+		if sectionNode == nil {
+			sectionNode = &yaml.Node{Kind: yaml.MappingNode}
+			componentsNode.Content = append(componentsNode.Content,
+				&yaml.Node{Kind: yaml.ScalarNode, Value: sectionKey},
+				sectionNode,
+			)
+		}
+
+		// Check if component already exists
+		if r.helper.GetMapValue(sectionNode, name) != nil {
 			continue
 		}
-		schemasNode.Content = append(schemasNode.Content,
+		sectionNode.Content = append(sectionNode.Content,
 			&yaml.Node{Kind: yaml.ScalarNode, Value: name},
-			schema,
+			r.collectedComponents[ref],
 		)
-		r.globalSchemaNames[name] = true
+		r.globalComponents[ref] = true
 	}
 }
 
@@ -182,7 +278,7 @@ func (r *Resolver) expandComponents(ctx context.Context, node *yaml.Node, basePa
 		if err := r.expandComponentSections(ctx, node, basePath, config); err != nil {
 			return err
 		}
-		r.registerGlobalSchemas(node)
+		r.registerGlobalComponents(node, uri.Abs(config.RootPath), r.layout.componentsFragment())
 	}
 	return nil
 }
@@ -195,10 +291,12 @@ func (r *Resolver) expandComponentsRef(ctx context.Context, node *yaml.Node, ref
 	}
 
 	r.replaceNode(node, content)
-	r.registerGlobalSchemas(node)
+	r.registerGlobalComponents(node, uri.Abs(refPath), refFragment(ref))
 
-	baseDir := filepath.Dir(refPath)
-	r.componentsBaseDir["schemas"] = baseDir
+	baseDir := uri.Dir(refPath)
+	for _, section := range r.layout.sections {
+		r.componentsBaseDir[section.componentType] = baseDir
+	}
 
 	if schemasNode := r.helper.GetMapValue(node, "schemas"); schemasNode != nil {
 		r.buildSchemaMapping(schemasNode, baseDir)
@@ -209,10 +307,9 @@ func (r *Resolver) expandComponentsRef(ctx context.Context, node *yaml.Node, ref
 
 // expandComponentSections expands individual component sections (schemas, parameters, etc.)
 func (r *Resolver) expandComponentSections(ctx context.Context, node *yaml.Node, basePath string, config domain.Config) error {
-	componentTypes := []string{"schemas", "responses", "parameters", "examples", "requestBodies", "headers", "securitySchemes", "links", "callbacks"}
-
-	for _, ct := range componentTypes {
-		sectionNode := r.helper.GetMapValue(node, ct)
+	for _, section := range r.layout.sections {
+		ct := section.componentType
+		sectionNode := r.helper.GetMapValue(node, section.key)
 		if sectionNode == nil {
 			continue
 		}
@@ -224,13 +321,16 @@ func (r *Resolver) expandComponentSections(ctx context.Context, node *yaml.Node,
 
 		content, refPath, err := r.loadRefContent(ctx, ref, basePath, config)
 		if err != nil {
-			return fmt.Errorf("failed to expand components.%s: %w", ct, err)
+			return fmt.Errorf("failed to expand %s: %w", r.layout.sectionPath(ct), err)
 		}
 
-		baseDir := filepath.Dir(refPath)
+		baseDir := uri.Dir(refPath)
 		r.componentsBaseDir[ct] = baseDir
 		r.buildComponentMapping(content, baseDir, ct)
 
+		absPath := uri.Abs(refPath)
+		r.registerSectionSources(content, ct, absPath, refFragment(ref))
+
 		if ct == "schemas" {
 			r.buildSchemaMapping(content, baseDir)
 		}
@@ -241,20 +341,20 @@ func (r *Resolver) expandComponentSections(ctx context.Context, node *yaml.Node,
 	return nil
 }
 
-// expandPaths expands the paths section
-func (r *Resolver) expandPaths(ctx context.Context, node *yaml.Node, basePath string, config domain.Config) error {
+// expandRootSection expands a root section like paths that may itself be a $ref
+func (r *Resolver) expandRootSection(ctx context.Context, node *yaml.Node, section string, basePath string, config domain.Config) error {
 	ref := r.helper.GetRef(node)
 	if ref == "" {
-		r.pathsBaseDir = basePath
+		r.sectionsBaseDir[section] = basePath
 		return nil
 	}
 
 	content, refPath, err := r.loadRefContent(ctx, ref, basePath, config)
 	if err != nil {
-		return fmt.Errorf("failed to expand paths: %w", err)
+		return fmt.Errorf("failed to expand %s: %w", section, err)
 	}
 
-	r.pathsBaseDir = filepath.Dir(refPath)
+	r.sectionsBaseDir[section] = uri.Dir(refPath)
 	r.replaceNode(node, content)
 	return nil
 }
@@ -265,8 +365,13 @@ func (r *Resolver) resolveComponentRefs(ctx context.Context, node *yaml.Node, co
 		return nil
 	}
 
-	r.pushPath("components")
-	defer r.popPath()
+	if r.layout.container != "" {
+		r.pushPath(r.layout.container)
+		defer r.popPath()
+	}
+
+	// Refs between component files may point to components defined further down
+	r.registerDefinitionSources(node)
 
 	for i := 0; i < len(node.Content); i += 2 {
 		if i+1 >= len(node.Content) {
@@ -275,7 +380,12 @@ func (r *Resolver) resolveComponentRefs(ctx context.Context, node *yaml.Node, co
 		sectionName := node.Content[i].Value
 		sectionNode := node.Content[i+1]
 
-		baseDir := r.componentsBaseDir[sectionName]
+		componentType, ok := r.layout.sectionType(sectionName)
+		if !ok {
+			continue
+		}
+
+		baseDir := r.componentsBaseDir[componentType]
 		if baseDir == "" {
 			baseDir = r.rootBaseDir
 		}
@@ -283,7 +393,7 @@ func (r *Resolver) resolveComponentRefs(ctx context.Context, node *yaml.Node, co
 		r.pushPath(sectionName)
 
 		// First inline component definitions
-		if err := r.inlineComponentDefinitions(ctx, sectionNode, baseDir, config); err != nil {
+		if err := r.inlineComponentDefinitions(ctx, sectionNode, componentType, baseDir, config); err != nil {
 			r.popPath()
 			return fmt.Errorf("failed to inline %s: %w", sectionName, err)
 		}
@@ -300,8 +410,33 @@ func (r *Resolver) resolveComponentRefs(ctx context.Context, node *yaml.Node, co
 	return nil
 }
 
+// registerDefinitionSources records the file of every component defined by an external $ref
+func (r *Resolver) registerDefinitionSources(node *yaml.Node) {
+	_ = r.helper.IterateMap(node, func(sectionName string, sectionNode *yaml.Node) error {
+		componentType, ok := r.layout.sectionType(sectionName)
+		if !ok {
+			return nil
+		}
+		baseDir := r.componentsBaseDir[componentType]
+		if baseDir == "" {
+			baseDir = r.rootBaseDir
+		}
+		return r.helper.IterateMap(sectionNode, func(componentName string, componentValue *yaml.Node) error {
+			ref := r.helper.GetRef(componentValue)
+			if ref == "" || strings.HasPrefix(ref, "#") {
+				return nil
+			}
+			if refPath := r.getRefPath(ref, baseDir); refPath != "" {
+				absPath := uri.Abs(refPath)
+				r.registerComponentSource(r.componentRef(componentType, componentName), refIdentity(absPath, refFragment(ref)))
+			}
+			return nil
+		})
+	})
+}
+
 // inlineComponentDefinitions inlines $refs at the component definition level
-func (r *Resolver) inlineComponentDefinitions(ctx context.Context, node *yaml.Node, baseDir string, config domain.Config) error {
+func (r *Resolver) inlineComponentDefinitions(ctx context.Context, node *yaml.Node, componentType string, baseDir string, config domain.Config) error {
 	if node == nil || node.Kind != yaml.MappingNode {
 		return nil
 	}
@@ -310,6 +445,7 @@ func (r *Resolver) inlineComponentDefinitions(ctx context.Context, node *yaml.No
 		if i+1 >= len(node.Content) {
 			break
 		}
+		componentName := node.Content[i].Value
 		componentValue := node.Content[i+1]
 
 		ref := r.helper.GetRef(componentValue)
@@ -317,17 +453,54 @@ func (r *Resolver) inlineComponentDefinitions(ctx context.Context, node *yaml.No
 			continue
 		}
 
-		content, _, err := r.loadRefContent(ctx, ref, baseDir, config)
+		content, refPath, err := r.loadRefContent(ctx, ref, baseDir, config)
 		if err != nil {
 			return fmt.Errorf("failed to load component %s: %w", ref, err)
 		}
 
+		// Usages of the same source elsewhere map to this component
+		absPath := uri.Abs(refPath)
+		identity := refIdentity(absPath, refFragment(ref))
+		r.registerComponentSource(r.componentRef(componentType, componentName), identity)
+
+		// Refs inside the definition are relative to its own file
+		if err := r.resolveDefinitionRefs(ctx, content, componentName, identity, refPath, config); err != nil {
+			return fmt.Errorf("failed to resolve component %s: %w", ref, err)
+		}
+
 		r.replaceNode(componentValue, content)
 	}
 
 	return nil
 }
 
+// resolveDefinitionRefs resolves the refs of a component definition loaded from refPath
+// within that file, so its internal refs and $defs do not get lost
+func (r *Resolver) resolveDefinitionRefs(ctx context.Context, content *yaml.Node, componentName, identity, refPath string, config domain.Config) error {
+	fileRoot, err := r.loadFile(ctx, refPath, config)
+	if err != nil {
+		return err
+	}
+	if fileRoot.Kind == yaml.DocumentNode && len(fileRoot.Content) > 0 {
+		fileRoot = fileRoot.Content[0]
+	}
+
+	baseDir := uri.Dir(refPath)
+	if _, fragment, _ := strings.Cut(identity, "#"); fragment == "" {
+		if err := r.hoistSchemaDefs(ctx, content, fileRoot, baseDir, config, 0); err != nil {
+			return err
+		}
+	}
+
+	r.pushPath(componentName)
+	r.recordLocation(identity)
+	r.pushRef(identity)
+	err = r.resolveRefsWithContext(ctx, content, baseDir, config, 0, fileRoot)
+	r.popRef()
+	r.popPath()
+	return err
+}
+
 // resolveRefs recursively resolves all $ref in a node
 func (r *Resolver) resolveRefs(ctx context.Context, node *yaml.Node, baseDir string, config domain.Config, depth int) error {
 	return r.resolveRefsWithContext(ctx, node, baseDir, config, depth, nil)
@@ -354,7 +527,33 @@ func (r *Resolver) resolveRefsWithContext(ctx context.Context, node *yaml.Node,
 	case yaml.MappingNode:
 		ref := r.helper.GetRef(node)
 		if ref != "" {
-			return r.resolveRef(ctx, node, ref, baseDir, config, depth, externalRoot)
+			if err := r.resolveSiblingRefs(ctx, node, baseDir, config, depth, externalRoot); err != nil {
+				return err
+			}
+			if err := r.resolveRef(ctx, node, ref, baseDir, config, depth, externalRoot); err != nil {
+				return err
+			}
+			r.applyKeptRefSiblings(node, config)
+			if r.helper.GetRef(node) != ref {
+				r.markStaleIDs()
+			}
+			return nil
+		}
+
+		if r.pushIDScope(node, baseDir, externalRoot) {
+			defer r.popIDScope()
+		}
+
+		// Link objects point to operations with a URI rather than a $ref
+		if operationRef := r.helper.GetMapValue(node, "operationRef"); operationRef != nil {
+			r.trackOperationRef(operationRef, baseDir, externalRoot)
+		}
+
+		// Example objects may point to their value with a URL of their own
+		if config.EmbedExamples && r.helper.HasMapKey(node, "externalValue") {
+			if err := r.embedExternalValue(ctx, node, baseDir, config); err != nil {
+				return err
+			}
 		}
 
 		// Process children with path tracking
@@ -364,7 +563,13 @@ func (r *Resolver) resolveRefsWithContext(ctx context.Context, node *yaml.Node,
 			}
 			key := node.Content[i].Value
 			r.pushPath(key)
-			if err := r.resolveRefsWithContext(ctx, node.Content[i+1], baseDir, config, depth+1, externalRoot); err != nil {
+			var err error
+			if key == "$dynamicRef" && r.usesJSONSchema2020() {
+				err = r.resolveDynamicRef(ctx, node.Content[i+1], baseDir, config, depth, externalRoot)
+			} else {
+				err = r.resolveRefsWithContext(ctx, node.Content[i+1], baseDir, config, depth+1, externalRoot)
+			}
+			if err != nil {
 				r.popPath()
 				return err
 			}
@@ -384,8 +589,23 @@ func (r *Resolver) resolveRefsWithContext(ctx context.Context, node *yaml.Node,
 
 // resolveRef resolves a single $ref
 func (r *Resolver) resolveRef(ctx context.Context, node *yaml.Node, ref string, baseDir string, config domain.Config, depth int, externalRoot *yaml.Node) error {
+	// 3.1 schemas may refer to $id resources and anchors rather than files
+	if r.usesJSONSchema2020() {
+		if resolved, err := r.resolveSchemaRef(ctx, node, ref, baseDir, config, depth, externalRoot); resolved || err != nil {
+			return err
+		}
+	}
+
 	if strings.HasPrefix(ref, "#") {
 		if externalRoot != nil {
+			// A whole file may still point into the root document
+			fragment := strings.TrimPrefix(ref, "#")
+			if r.navigateToFragment(externalRoot, fragment) == nil {
+				r.lookupRoot()
+				if r.navigateToFragment(r.rootNode, fragment) != nil {
+					return nil
+				}
+			}
 			return r.resolveInternalRef(ctx, node, ref, baseDir, config, depth, externalRoot)
 		}
 		return nil // Skip internal refs to main document
@@ -396,44 +616,24 @@ func (r *Resolver) resolveRef(ctx context.Context, node *yaml.Node, ref string,
 
 // resolveInternalRef resolves an internal $ref within an external file
 func (r *Resolver) resolveInternalRef(ctx context.Context, node *yaml.Node, ref string, baseDir string, config domain.Config, depth int, externalRoot *yaml.Node) error {
-	fragment := strings.TrimPrefix(ref, "#")
-
-	// If this is a schema reference, collect it and use global ref
-	if strings.HasPrefix(fragment, "/components/schemas/") {
-		schemaName := strings.TrimPrefix(fragment, "/components/schemas/")
-
-		// If already global, just use internal ref
-		if r.globalSchemaNames[schemaName] {
-			r.helper.SetRef(node, "#/components/schemas/"+schemaName)
-			return nil
-		}
+	identity := refIdentity(r.nodeFiles[externalRoot], strings.TrimPrefix(ref, "#"))
+	return r.withRefIdentity(node, identity, config, func() error {
+		return r.resolveInternalRefContent(ctx, node, ref, baseDir, config, depth, externalRoot)
+	})
+}
 
-		// If already collected, use internal ref
-		if _, exists := r.collectedSchemas[schemaName]; exists {
-			r.helper.SetRef(node, "#/components/schemas/"+schemaName)
-			return nil
-		}
+// resolveInternalRefContent replaces an internal ref of an external file with its content
+func (r *Resolver) resolveInternalRefContent(ctx context.Context, node *yaml.Node, ref string, baseDir string, config domain.Config, depth int, externalRoot *yaml.Node) error {
+	fragment := strings.TrimPrefix(ref, "#")
 
-		// Collect schema from external file
-		schemaContent := r.navigateToFragment(externalRoot, fragment)
-		if schemaContent != nil {
-			schemaContent = r.helper.CloneNode(schemaContent)
-			// Resolve internal refs within the schema
-			if err := r.resolveRefsWithContext(ctx, schemaContent, baseDir, config, depth+1, externalRoot); err != nil {
-				return err
-			}
-			// Store for later addition to components/schemas
-			r.collectedSchemas[schemaName] = schemaContent
-			r.collectedSchemasOrder = append(r.collectedSchemasOrder, schemaName)
-			// Convert to internal ref
-			r.helper.SetRef(node, "#/components/schemas/"+schemaName)
-			return nil
-		}
+	// If this is a component reference, collect it and use global ref
+	if collected, err := r.collectComponent(ctx, node, fragment, externalRoot, baseDir, config, depth); collected || err != nil {
+		return err
 	}
 
-	content := r.navigateToFragment(externalRoot, fragment)
-	if content == nil {
-		return fmt.Errorf("internal reference %s not found", ref)
+	content, err := r.resolveFragment(externalRoot, fragment)
+	if err != nil {
+		return fmt.Errorf("internal reference %s not found: %w", ref, err)
 	}
 
 	content = r.helper.CloneNode(content)
@@ -442,11 +642,11 @@ func (r *Resolver) resolveInternalRef(ctx context.Context, node *yaml.Node, ref
 		return err
 	}
 
-	if r.tryDeduplicateSchema(node, content) {
+	if r.tryDeduplicateSchema(node, content, config) {
 		return nil
 	}
 
-	r.replaceNode(node, content)
+	r.inlineRef(node, content, config)
 	return nil
 }
 
@@ -454,24 +654,30 @@ func (r *Resolver) resolveInternalRef(ctx context.Context, node *yaml.Node, ref
 func (r *Resolver) resolveExternalRef(ctx context.Context, node *yaml.Node, ref string, baseDir string, config domain.Config, depth int) error {
 	refPath := r.getRefPath(ref, baseDir)
 	if refPath == "" {
-		return fmt.Errorf("invalid reference: %s", ref)
+		return invalidRefError(ref, baseDir)
 	}
 
-	absPath, _ := filepath.Abs(refPath)
-
-	// Check for circular references
-	visitKey := fmt.Sprintf("%s:%p", absPath, node)
-	if r.visited[visitKey] {
-		return nil
+	// Markdown and plain-text files are included as text
+	if isTextFile(refPath) {
+		return r.includeText(ctx, node, refPath, config)
 	}
-	r.visited[visitKey] = true
-	defer delete(r.visited, visitKey)
+
+	absPath := uri.Abs(refPath)
 
 	// Try to convert to internal ref
 	if internalRef := r.tryConvertToInternalRef(absPath); internalRef != "" {
 		r.helper.SetRef(node, internalRef)
 		return nil
 	}
+	r.lookup(identityKey, refIdentity(absPath, refFragment(ref)))
+	if internalRef, ok := r.identityRefs[refIdentity(absPath, refFragment(ref))]; ok {
+		r.helper.SetRef(node, internalRef)
+		return nil
+	}
+	if internalRef, ok := r.refIntoComponent(absPath, refFragment(ref)); ok {
+		r.helper.SetRef(node, internalRef)
+		return nil
+	}
 
 	// Load content
 	content, err := r.loadFile(ctx, refPath, config)
@@ -482,6 +688,7 @@ func (r *Resolver) resolveExternalRef(ctx context.Context, node *yaml.Node, ref
 	if content.Kind == yaml.DocumentNode && len(content.Content) > 0 {
 		content = content.Content[0]
 	}
+	r.nodeFiles[content] = absPath
 
 	// Handle fragment
 	fragment := ""
@@ -489,47 +696,68 @@ func (r *Resolver) resolveExternalRef(ctx context.Context, node *yaml.Node, ref
 		fragment = ref[idx+1:]
 	}
 
-	return r.resolveRefWithFragment(ctx, node, content, fragment, refPath, config, depth)
+	return r.withRefIdentity(node, refIdentity(absPath, fragment), config, func() error {
+		return r.resolveRefWithFragment(ctx, node, content, fragment, refPath, config, depth)
+	})
 }
 
-// resolveRefWithFragment resolves a ref with an optional fragment
-func (r *Resolver) resolveRefWithFragment(ctx context.Context, node *yaml.Node, content *yaml.Node, fragment string, refPath string, config domain.Config, depth int) error {
-	newBaseDir := filepath.Dir(refPath)
+// refIntoComponent points a ref into a file that defines a whole component at the same
+// place inside that component. $defs are hoisted into components of their own and are left out.
+func (r *Resolver) refIntoComponent(absPath, fragment string) (string, bool) {
+	tokens, err := pointer.Parse(fragment)
+	if err != nil || len(tokens) == 0 || tokens[0] == "$defs" || tokens[0] == "definitions" {
+		return "", false
+	}
+	r.lookup(identityKey, refIdentity(absPath, ""))
+	internalRef, ok := r.identityRefs[refIdentity(absPath, "")]
+	if !ok {
+		return "", false
+	}
+	return internalRef + strings.TrimPrefix(pointer.Format(tokens...), "#"), true
+}
 
-	// Handle component schema references - collect and convert to internal ref
-	if strings.HasPrefix(fragment, "/components/schemas/") {
-		schemaName := strings.TrimPrefix(fragment, "/components/schemas/")
+// withRefIdentity runs resolve with identity on the resolution stack, detecting cycles
+func (r *Resolver) withRefIdentity(node *yaml.Node, identity string, config domain.Config, resolve func() error) error {
+	r.lookup(identityKey, identity)
+	if internalRef, ok := r.circularTargets[identity]; ok {
+		r.replaceNode(node, r.helper.CreateRefNode(internalRef))
+		return nil
+	}
 
-		// If already global, just use internal ref
-		if r.globalSchemaNames[schemaName] {
-			r.helper.SetRef(node, "#/components/schemas/"+schemaName)
-			return nil
-		}
+	if chain := r.cycleChain(identity); chain != nil {
+		return r.handleCircularRef(node, identity, chain, config)
+	}
 
-		// Collect schema from external file
-		schemaContent := r.navigateToFragment(content, fragment)
-		if schemaContent != nil {
-			schemaContent = r.helper.CloneNode(schemaContent)
-			// Resolve internal refs within the schema
-			if err := r.resolveRefsWithContext(ctx, schemaContent, newBaseDir, config, depth+1, content); err != nil {
-				return err
-			}
-			// Store for later addition to components/schemas (preserve order)
-			if _, exists := r.collectedSchemas[schemaName]; !exists {
-				r.collectedSchemas[schemaName] = schemaContent
-				r.collectedSchemasOrder = append(r.collectedSchemasOrder, schemaName)
-			}
-			// Convert to internal ref
-			r.helper.SetRef(node, "#/components/schemas/"+schemaName)
-			return nil
-		}
+	// The target has its own $id scopes
+	scopes := r.idScopes
+	r.idScopes = nil
+	r.pushRef(identity)
+	err := resolve()
+	r.popRef()
+	r.idScopes = scopes
+	if err != nil {
+		return err
+	}
+
+	r.finishCircularTarget(node, identity)
+	return nil
+}
+
+// resolveRefWithFragment resolves a ref with an optional fragment
+func (r *Resolver) resolveRefWithFragment(ctx context.Context, node *yaml.Node, content *yaml.Node, fragment string, refPath string, config domain.Config, depth int) error {
+	newBaseDir := uri.Dir(refPath)
+	fileRoot := content
+
+	// Handle component references - collect and convert to internal ref
+	if collected, err := r.collectComponent(ctx, node, fragment, content, newBaseDir, config, depth); collected || err != nil {
+		return err
 	}
 
 	// Navigate to fragment if present
 	if fragment != "" && fragment != "/" {
-		fragmentContent := r.navigateToFragment(content, fragment)
-		if fragmentContent == nil {
-			return fmt.Errorf("fragment %s not found", fragment)
+		fragmentContent, err := r.resolveFragment(content, fragment)
+		if err != nil {
+			return fmt.Errorf("fragment %s not found: %w", fragment, err)
 		}
 
 		// For component refs, use external file context
@@ -538,10 +766,10 @@ func (r *Resolver) resolveRefWithFragment(ctx context.Context, node *yaml.Node,
 			if err := r.resolveRefsWithContext(ctx, fragmentContent, newBaseDir, config, depth+1, content); err != nil {
 				return err
 			}
-			if r.tryDeduplicateSchema(node, fragmentContent) {
+			if r.tryDeduplicateSchema(node, fragmentContent, config) {
 				return nil
 			}
-			r.replaceNode(node, fragmentContent)
+			r.inlineRef(node, fragmentContent, config)
 			return nil
 		}
 
@@ -550,26 +778,140 @@ func (r *Resolver) resolveRefWithFragment(ctx context.Context, node *yaml.Node,
 
 	content = r.helper.CloneNode(content)
 
-	if err := r.resolveRefs(ctx, content, newBaseDir, config, depth+1); err != nil {
+	// A whole schema file brings its own definitions along
+	if fragment == "" || fragment == "/" {
+		if collected, err := r.collectFileComponent(ctx, node, fileRoot, newBaseDir, config, depth); collected || err != nil {
+			return err
+		}
+		if err := r.hoistSchemaDefs(ctx, content, fileRoot, newBaseDir, config, depth); err != nil {
+			return err
+		}
+	}
+
+	if err := r.resolveRefsWithContext(ctx, content, newBaseDir, config, depth+1, fileRoot); err != nil {
 		return err
 	}
 
-	if r.tryDeduplicateSchema(node, content) {
+	if r.tryDeduplicateSchema(node, content, config) {
 		return nil
 	}
 
-	r.replaceNode(node, content)
+	r.inlineRef(node, content, config)
+	r.recordLocation(refIdentity(r.nodeFiles[fileRoot], fragment))
 	return nil
 }
 
+// collectComponent hoists a /components/<type>/<name> fragment of an external file into
+// the root components and turns node into an internal ref to it
+func (r *Resolver) collectComponent(ctx context.Context, node *yaml.Node, fragment string, externalRoot *yaml.Node, baseDir string, config domain.Config, depth int) (bool, error) {
+	componentType, name, ok := r.parseComponentFragment(fragment)
+	if !ok {
+		return false, nil
+	}
+	return r.hoistComponent(ctx, node, componentType, name, fragment, externalRoot, baseDir, config, depth)
+}
+
+// collectFileComponent hoists a whole external file into the root components when the
+// layout keeps what is referenced at the current location as a component
+func (r *Resolver) collectFileComponent(ctx context.Context, node *yaml.Node, fileRoot *yaml.Node, baseDir string, config domain.Config, depth int) (bool, error) {
+	if r.layout.hoistType == nil {
+		return false, nil
+	}
+	componentType := r.layout.hoistType(r.currentPath)
+	if componentType == "" {
+		return false, nil
+	}
+	file := r.nodeFiles[fileRoot]
+	name := strings.TrimSuffix(uri.Base(file), filepath.Ext(uri.Base(file)))
+	return r.hoistComponent(ctx, node, componentType, name, "", fileRoot, baseDir, config, depth)
+}
+
+// hoistComponent stores the content at fragment of an external file as a root component
+// and turns node into an internal ref to it
+func (r *Resolver) hoistComponent(ctx context.Context, node *yaml.Node, componentType, name, fragment string, externalRoot *yaml.Node, baseDir string, config domain.Config, depth int) (bool, error) {
+	identity := refIdentity(r.nodeFiles[externalRoot], fragment)
+
+	// If this source was already collected or defined in root, just use its internal ref
+	r.lookup(identityKey, identity)
+	if internalRef, ok := r.identityRefs[identity]; ok {
+		r.helper.SetRef(node, internalRef)
+		return true, nil
+	}
+
+	// Collect component from external file
+	componentContent := r.navigateToFragment(externalRoot, fragment)
+	if componentContent == nil {
+		return false, nil
+	}
+	componentContent = r.helper.CloneNode(componentContent)
+
+	// Resolve internal refs within the component at the location it is hoisted to
+	refSite := r.currentPath
+	r.currentPath = r.layout.refTokens(componentType, name)
+	err := r.resolveRefsWithContext(ctx, componentContent, baseDir, config, depth+1, externalRoot)
+	r.currentPath = refSite
+	if err != nil {
+		return false, err
+	}
+
+	internalRef, err := r.claimComponentName(componentType, name, identity, componentContent, config)
+	if err != nil {
+		return false, err
+	}
+	if tentativeRef := r.componentRef(componentType, name); internalRef != tentativeRef {
+		r.forgetLocations(tentativeRef)
+	}
+
+	// Store for later addition to components (preserve order)
+	r.lookup(nameKey, internalRef)
+	if _, exists := r.collectedComponents[internalRef]; !exists && !r.globalComponents[internalRef] {
+		r.collectedComponents[internalRef] = componentContent
+		r.collectedOrder = append(r.collectedOrder, internalRef)
+	}
+
+	// Convert to internal ref
+	r.helper.SetRef(node, internalRef)
+	return true, nil
+}
+
+// parseComponentFragment splits a component fragment like /components/<type>/<name>
+// (/definitions/<name> in Swagger 2.0). Top-level /$defs/<name> and /definitions/<name>
+// of schema files are schemas.
+func (r *Resolver) parseComponentFragment(fragment string) (string, string, bool) {
+	tokens, err := pointer.Parse(fragment)
+	if err != nil {
+		return "", "", false
+	}
+	if componentType, name, ok := r.layout.parseTokens(tokens); ok {
+		return componentType, name, true
+	}
+	if len(tokens) == 2 && (tokens[0] == "$defs" || tokens[0] == "definitions") && tokens[1] != "" {
+		return "schemas", tokens[1], true
+	}
+	return "", "", false
+}
+
+// refFragment returns the fragment of a ref without the leading #
+func refFragment(ref string) string {
+	if idx := strings.Index(ref, "#"); idx >= 0 {
+		return ref[idx+1:]
+	}
+	return ""
+}
+
+// componentRef builds an internal ref to a root component
+func (r *Resolver) componentRef(componentType, name string) string {
+	return r.layout.ref(componentType, name)
+}
+
 // tryConvertToInternalRef tries to convert an absolute path to an internal ref
 func (r *Resolver) tryConvertToInternalRef(absPath string) string {
 	// Check schema mapping
 	if name, ok := r.schemaFileToName[absPath]; ok {
-		return "#/components/schemas/" + name
+		return r.componentRef("schemas", name)
 	}
 	if name, ok := r.schemaFileToName[strings.TrimSuffix(absPath, filepath.Ext(absPath))]; ok {
-		return "#/components/schemas/" + name
+		return r.componentRef("schemas", name)
 	}
 
 	// Check component mapping
@@ -585,12 +927,17 @@ func (r *Resolver) tryConvertToInternalRef(absPath string) string {
 
 // tryDeduplicateSchema checks if content was already seen and uses a ref instead
 // Only deduplicates to #/components/schemas/... refs (oapi-codegen compatible)
-func (r *Resolver) tryDeduplicateSchema(node *yaml.Node, content *yaml.Node) bool {
-	hash := r.hashNode(content)
+func (r *Resolver) tryDeduplicateSchema(node *yaml.Node, content *yaml.Node, config domain.Config) bool {
+	if config.Dedupe == domain.DedupeOff {
+		return false
+	}
+	hash := r.hashNode(content, config.Dedupe)
+	schemasPrefix := r.componentRef("schemas", "")
 
+	r.lookup(hashKey, hash)
 	if existingPath, ok := r.schemaHashToPath[hash]; ok {
 		// Only use refs that point to components/schemas (oapi-codegen compatible)
-		if strings.HasPrefix(existingPath, "#/components/schemas/") {
+		if strings.HasPrefix(existingPath, schemasPrefix) {
 			r.helper.SetRef(node, existingPath)
 			return true
 		}
@@ -598,7 +945,7 @@ func (r *Resolver) tryDeduplicateSchema(node *yaml.Node, content *yaml.Node) boo
 
 	// Only register schemas under #/components/schemas/ for deduplication
 	if currentPath := r.getCurrentJSONPointer(); currentPath != "" {
-		if strings.HasPrefix(currentPath, "#/components/schemas/") {
+		if strings.HasPrefix(currentPath, schemasPrefix) {
 			r.schemaHashToPath[hash] = currentPath
 		}
 	}
@@ -612,7 +959,7 @@ func (r *Resolver) tryDeduplicateSchema(node *yaml.Node, content *yaml.Node) boo
 func (r *Resolver) loadRefContent(ctx context.Context, ref string, baseDir string, config domain.Config) (*yaml.Node, string, error) {
 	refPath := r.getRefPath(ref, baseDir)
 	if refPath == "" {
-		return nil, "", fmt.Errorf("invalid reference: %s", ref)
+		return nil, "", invalidRefError(ref, baseDir)
 	}
 
 	content, err := r.loadFile(ctx, refPath, config)
@@ -628,9 +975,9 @@ func (r *Resolver) loadRefContent(ctx context.Context, ref string, baseDir strin
 	if idx := strings.Index(ref, "#"); idx >= 0 {
 		fragment := ref[idx+1:]
 		if fragment != "" && fragment != "/" {
-			content = r.navigateToFragment(content, fragment)
-			if content == nil {
-				return nil, "", fmt.Errorf("fragment %s not found in %s", fragment, ref)
+			content, err = r.resolveFragment(content, fragment)
+			if err != nil {
+				return nil, "", fmt.Errorf("fragment %s not found in %s: %w", fragment, ref, err)
 			}
 		}
 	}
@@ -647,32 +994,37 @@ func (r *Resolver) replaceNode(dst, src *yaml.Node) {
 	dst.Style = src.Style
 }
 
-// registerGlobalSchemas registers all schemas as global
-func (r *Resolver) registerGlobalSchemas(componentsNode *yaml.Node) {
+// registerGlobalComponents registers all root components as global. The components
+// are recorded as defined at absPath#fragment, except those an external $ref defines.
+func (r *Resolver) registerGlobalComponents(componentsNode *yaml.Node, absPath, fragment string) {
 	if componentsNode == nil || componentsNode.Kind != yaml.MappingNode {
 		return
 	}
 
-	schemasNode := r.helper.GetMapValue(componentsNode, "schemas")
-	if schemasNode == nil || schemasNode.Kind != yaml.MappingNode {
-		return
-	}
-
-	for i := 0; i < len(schemasNode.Content); i += 2 {
-		if i+1 >= len(schemasNode.Content) {
-			break
+	for _, section := range r.layout.sections {
+		sectionNode := r.helper.GetMapValue(componentsNode, section.key)
+		if sectionNode == nil || sectionNode.Kind != yaml.MappingNode {
+			continue
+		}
+		for i := 0; i+1 < len(sectionNode.Content); i += 2 {
+			name := sectionNode.Content[i].Value
+			ref := r.componentRef(section.componentType, name)
+			r.globalComponents[ref] = true
+			if valueRef := r.helper.GetRef(sectionNode.Content[i+1]); valueRef == "" || strings.HasPrefix(valueRef, "#") {
+				r.registerComponentSource(ref, refIdentity(absPath, fragment+"/"+pointer.Escape(section.key)+"/"+pointer.Escape(name)))
+			}
 		}
-		r.globalSchemaNames[schemasNode.Content[i].Value] = true
 	}
 }
 
 // registerSchemaSubElements registers hashes for schema sub-elements
-func (r *Resolver) registerSchemaSubElements(componentsNode *yaml.Node) {
-	if componentsNode == nil || componentsNode.Kind != yaml.MappingNode {
+func (r *Resolver) registerSchemaSubElements(componentsNode *yaml.Node, config domain.Config) {
+	if config.Dedupe == domain.DedupeOff || componentsNode == nil || componentsNode.Kind != yaml.MappingNode {
 		return
 	}
 
-	schemasNode := r.helper.GetMapValue(componentsNode, "schemas")
+	schemasKey, _ := r.layout.sectionKey("schemas")
+	schemasNode := r.helper.GetMapValue(componentsNode, schemasKey)
 	if schemasNode == nil || schemasNode.Kind != yaml.MappingNode {
 		return
 	}
@@ -684,8 +1036,9 @@ func (r *Resolver) registerSchemaSubElements(componentsNode *yaml.Node) {
 		schemaName := schemasNode.Content[i].Value
 		schemaNode := schemasNode.Content[i+1]
 
-		r.registerSubElement(schemaNode, "items", "#/components/schemas/"+schemaName+"/items")
-		r.registerSubElement(schemaNode, "additionalProperties", "#/components/schemas/"+schemaName+"/additionalProperties")
+		schemaRef := r.componentRef("schemas", schemaName)
+		r.registerSubElement(schemaNode, "items", schemaRef+"/items", config.Dedupe)
+		r.registerSubElement(schemaNode, "additionalProperties", schemaRef+"/additionalProperties", config.Dedupe)
 
 		// Register property items
 		if propsNode := r.helper.GetMapValue(schemaNode, "properties"); propsNode != nil && propsNode.Kind == yaml.MappingNode {
@@ -695,17 +1048,17 @@ func (r *Resolver) registerSchemaSubElements(componentsNode *yaml.Node) {
 				}
 				propName := propsNode.Content[j].Value
 				propNode := propsNode.Content[j+1]
-				r.registerSubElement(propNode, "items", "#/components/schemas/"+schemaName+"/properties/"+propName+"/items")
+				r.registerSubElement(propNode, "items", schemaRef+"/properties/"+propName+"/items", config.Dedupe)
 			}
 		}
 	}
 }
 
 // registerSubElement registers a hash for a sub-element if it exists
-func (r *Resolver) registerSubElement(parent *yaml.Node, key string, path string) {
+func (r *Resolver) registerSubElement(parent *yaml.Node, key string, path string, mode domain.DedupeMode) {
 	node := r.helper.GetMapValue(parent, key)
 	if node != nil && node.Kind == yaml.MappingNode {
-		hash := r.hashNode(node)
+		hash := r.hashNode(node, mode)
 		if _, exists := r.schemaHashToPath[hash]; !exists {
 			r.schemaHashToPath[hash] = path
 		}
@@ -742,7 +1095,7 @@ func (r *Resolver) buildComponentMapping(sectionNode *yaml.Node, baseDir string,
 		}
 		componentName := sectionNode.Content[i].Value
 		componentValue := sectionNode.Content[i+1]
-		internalRef := fmt.Sprintf("#/components/%s/%s", componentType, componentName)
+		internalRef := r.componentRef(componentType, componentName)
 
 		r.mapRefToName(componentValue, baseDir, internalRef, r.componentFileToRef)
 		r.mapNameToFileWithRef(baseDir, componentName, internalRef, r.componentFileToRef)
@@ -761,7 +1114,7 @@ func (r *Resolver) mapRefToName(node *yaml.Node, baseDir string, name string, ma
 		return
 	}
 
-	absPath, _ := filepath.Abs(refPath)
+	absPath := uri.Abs(refPath)
 	mapping[absPath] = name
 	mapping[strings.TrimSuffix(absPath, filepath.Ext(absPath))] = name
 }
@@ -773,72 +1126,76 @@ func (r *Resolver) mapNameToFile(baseDir string, name string, mapping map[string
 
 // mapNameToFileWithRef maps possible file paths to a ref
 func (r *Resolver) mapNameToFileWithRef(baseDir string, name string, ref string, mapping map[string]string) {
+	checker, ok := r.fileLoader.(domain.FileChecker)
+	if !ok {
+		return
+	}
 	for _, ext := range []string{".json", ".yaml", ".yml"} {
-		p := filepath.Join(baseDir, name+ext)
-		if absPath, err := filepath.Abs(p); err == nil {
-			if _, err := os.Stat(p); err == nil {
-				mapping[absPath] = ref
-				mapping[strings.TrimSuffix(absPath, ext)] = ref
-			}
+		p := uri.Resolve(baseDir, name+ext)
+		if checker.Exists(p) {
+			absPath := uri.Abs(p)
+			mapping[absPath] = ref
+			mapping[strings.TrimSuffix(absPath, ext)] = ref
 		}
 	}
 }
 
-// navigateToFragment navigates to a JSON pointer fragment
+// navigateToFragment navigates to a JSON pointer fragment, returning nil if it does not exist
 func (r *Resolver) navigateToFragment(node *yaml.Node, fragment string) *yaml.Node {
-	if node == nil || fragment == "" {
-		return node
+	content, err := r.resolveFragment(node, fragment)
+	if err != nil {
+		return nil
 	}
+	return content
+}
 
-	fragment = strings.TrimPrefix(fragment, "/")
-	if fragment == "" {
-		return node
+// resolveFragment navigates to a JSON pointer fragment.
+// "/" refers to the whole document, as does the empty fragment.
+func (r *Resolver) resolveFragment(node *yaml.Node, fragment string) (*yaml.Node, error) {
+	if node == nil || fragment == "" || fragment == "/" {
+		return node, nil
 	}
-
-	current := node
-	for _, part := range strings.Split(fragment, "/") {
-		if part == "" {
-			continue
-		}
-		// Unescape JSON pointer
-		part = strings.ReplaceAll(part, "~1", "/")
-		part = strings.ReplaceAll(part, "~0", "~")
-
-		if current.Kind != yaml.MappingNode {
-			return nil
-		}
-		current = r.helper.GetMapValue(current, part)
-		if current == nil {
-			return nil
-		}
+	if !strings.HasPrefix(fragment, "/") {
+		fragment = "/" + fragment
 	}
-
-	return current
+	return pointer.Resolve(node, fragment)
 }
 
 // loadFile loads and parses a file with caching
 func (r *Resolver) loadFile(ctx context.Context, path string, config domain.Config) (*yaml.Node, error) {
-	path = filepath.Clean(path)
+	path = uri.Abs(path)
 
+	r.lookup(fileKey, path)
 	if cached, ok := r.fileCache[path]; ok {
 		return cached, nil
 	}
 
-	data, err := r.fileLoader.Load(ctx, path)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return nil, &errors.ErrFileNotFound{Path: path}
+	node := r.prefetched[path].node
+	if node == nil {
+		data, err := r.load(ctx, path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil, &errors.ErrFileNotFound{Path: path}
+			}
+			return nil, fmt.Errorf("failed to load file: %w", err)
+		}
+
+		node = &yaml.Node{}
+		if err := yaml.Unmarshal(data, node); err != nil {
+			return nil, fmt.Errorf("failed to parse file: %w", err)
 		}
-		return nil, fmt.Errorf("failed to load file: %w", err)
 	}
 
-	var node yaml.Node
-	if err := yaml.Unmarshal(data, &node); err != nil {
-		return nil, fmt.Errorf("failed to parse file: %w", err)
+	r.fileCache[path] = node
+
+	root := node
+	if root.Kind == yaml.DocumentNode && len(root.Content) > 0 {
+		root = root.Content[0]
 	}
+	r.nodeFiles[root] = path
+	r.indexSchemaResources(root, path, path)
 
-	r.fileCache[path] = &node
-	return &node, nil
+	return node, nil
 }
 
 // getRefPath resolves a reference path relative to baseDir
@@ -852,60 +1209,109 @@ func (r *Resolver) getRefPath(ref string, baseDir string) string {
 		refPath = ref[:idx]
 	}
 
-	if strings.HasPrefix(refPath, "http://") || strings.HasPrefix(refPath, "https://") {
-		return refPath
-	}
+	return uri.Resolve(baseDir, refPath)
+}
 
-	if strings.HasPrefix(refPath, "./") || strings.HasPrefix(refPath, "../") || !strings.HasPrefix(refPath, "/") {
-		return filepath.Join(baseDir, refPath)
+// invalidRefError reports a ref getRefPath found no file for
+func invalidRefError(ref, baseDir string) error {
+	if uri.IsURI(baseDir) && !strings.HasPrefix(ref, "#") {
+		return fmt.Errorf("invalid reference: %s: a document loaded from %s cannot refer to local files", ref, baseDir)
 	}
-
-	return refPath
+	return fmt.Errorf("invalid reference: %s", ref)
 }
 
-// hashNode computes a hash of a yaml.Node
-func (r *Resolver) hashNode(node *yaml.Node) string {
+// hashNode computes a hash of a yaml.Node.
+// Canonical mode ignores mapping key order and compares scalars by value.
+func (r *Resolver) hashNode(node *yaml.Node, mode domain.DedupeMode) string {
 	if node == nil {
 		return ""
 	}
 	var buf strings.Builder
-	r.writeNodeHash(&buf, node)
+	r.writeNodeHash(&buf, node, mode == domain.DedupeCanonical)
 	hash := sha256.Sum256([]byte(buf.String()))
 	return hex.EncodeToString(hash[:])
 }
 
 // writeNodeHash writes node content for hashing
-func (r *Resolver) writeNodeHash(buf *strings.Builder, node *yaml.Node) {
+func (r *Resolver) writeNodeHash(buf *strings.Builder, node *yaml.Node, canonical bool) {
 	if node == nil {
 		return
 	}
 	switch node.Kind {
 	case yaml.DocumentNode:
 		for _, child := range node.Content {
-			r.writeNodeHash(buf, child)
+			r.writeNodeHash(buf, child, canonical)
 		}
 	case yaml.MappingNode:
+		pairs := make([][2]*yaml.Node, 0, len(node.Content)/2)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			pairs = append(pairs, [2]*yaml.Node{node.Content[i], node.Content[i+1]})
+		}
+		// Object members are unordered; sequences (e.g. required, allOf) keep their order
+		if canonical {
+			sort.SliceStable(pairs, func(i, j int) bool {
+				return pairs[i][0].Value < pairs[j][0].Value
+			})
+		}
 		buf.WriteString("{")
-		for i := 0; i < len(node.Content); i += 2 {
-			if i+1 >= len(node.Content) {
-				break
-			}
-			buf.WriteString(node.Content[i].Value)
+		for _, pair := range pairs {
+			buf.WriteString(strconv.Quote(pair[0].Value))
 			buf.WriteString(":")
-			r.writeNodeHash(buf, node.Content[i+1])
+			r.writeNodeHash(buf, pair[1], canonical)
 			buf.WriteString(",")
 		}
 		buf.WriteString("}")
 	case yaml.SequenceNode:
 		buf.WriteString("[")
 		for _, child := range node.Content {
-			r.writeNodeHash(buf, child)
+			r.writeNodeHash(buf, child, canonical)
 			buf.WriteString(",")
 		}
 		buf.WriteString("]")
 	case yaml.ScalarNode:
-		buf.WriteString(node.Value)
+		if canonical {
+			buf.WriteString(canonicalScalar(node))
+			return
+		}
+		// The resolved tag keeps "1" and 1 apart
+		buf.WriteString(node.ShortTag())
+		buf.WriteString(" ")
+		buf.WriteString(strconv.Quote(node.Value))
+	case yaml.AliasNode:
+		r.writeNodeHash(buf, node.Alias, canonical)
+	}
+}
+
+// canonicalScalar renders a scalar by its JSON value, so 1, 1.0 and 0x1 hash the same
+// while the string "1" does not
+func canonicalScalar(node *yaml.Node) string {
+	switch node.ShortTag() {
+	case "!!null":
+		return "null"
+	case "!!bool", "!!int", "!!float":
+		var v interface{}
+		if err := node.Decode(&v); err != nil {
+			break
+		}
+		switch val := v.(type) {
+		case bool:
+			return strconv.FormatBool(val)
+		case int:
+			return strconv.Itoa(val)
+		case int64:
+			return strconv.FormatInt(val, 10)
+		case uint64:
+			return strconv.FormatUint(val, 10)
+		case float64:
+			// Whole floats within the int64 range hash like the equal int; converting
+			// others to int64 is undefined
+			if val == math.Trunc(val) && val >= math.MinInt64 && val < math.MaxInt64 {
+				return strconv.FormatInt(int64(val), 10)
+			}
+			return strconv.FormatFloat(val, 'g', -1, 64)
+		}
 	}
+	return strconv.Quote(node.Value)
 }
 
 // getCurrentJSONPointer returns the current JSON pointer path
@@ -0,0 +1,172 @@
+package resolver
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/miorlan/openapi-bundler/internal/domain"
+	"github.com/miorlan/openapi-bundler/internal/infrastructure/pointer"
+	"gopkg.in/yaml.v3"
+)
+
+// refSiblings returns the key/value pairs next to $ref and whether they are only
+// summary and description, which OpenAPI 3.1 Reference Objects allow to override
+func refSiblings(node *yaml.Node) ([]*yaml.Node, bool) {
+	var siblings []*yaml.Node
+	annotationsOnly := true
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key := node.Content[i].Value
+		if key == "$ref" {
+			continue
+		}
+		siblings = append(siblings, node.Content[i], node.Content[i+1])
+		if key != "summary" && key != "description" {
+			annotationsOnly = false
+		}
+	}
+	return siblings, annotationsOnly
+}
+
+// resolveSiblingRefs resolves refs inside the keywords next to a $ref
+func (r *Resolver) resolveSiblingRefs(ctx context.Context, node *yaml.Node, baseDir string, config domain.Config, depth int, externalRoot *yaml.Node) error {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key := node.Content[i].Value
+		if key == "$ref" {
+			continue
+		}
+		r.pushPath(key)
+		err := r.resolveRefsWithContext(ctx, node.Content[i+1], baseDir, config, depth+1, externalRoot)
+		r.popPath()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// inlineRef replaces a $ref node with the content it points to, applying the sibling
+// policy to the keywords written next to the $ref
+func (r *Resolver) inlineRef(node, content *yaml.Node, config domain.Config) {
+	siblings, annotationsOnly := refSiblings(node)
+	if len(siblings) == 0 || content.Kind != yaml.MappingNode {
+		r.replaceNode(node, content)
+		return
+	}
+
+	schema := r.atSchema()
+	policy := config.RefSiblings
+	if policy == "" || policy == domain.RefSiblingsAuto {
+		// 3.1 schema keywords apply next to the target; everywhere else siblings override it
+		policy = domain.RefSiblingsMerge
+		if r.usesJSONSchema2020() && !annotationsOnly && schema {
+			policy = domain.RefSiblingsAllOf
+		}
+	}
+	if policy == domain.RefSiblingsAllOf && !schema {
+		// Parameters, responses and other objects have no allOf
+		policy = domain.RefSiblingsMerge
+	}
+
+	switch policy {
+	case domain.RefSiblingsAllOf:
+		r.replaceNode(node, wrapAllOf(content, siblings))
+	case domain.RefSiblingsDrop:
+		r.warnDroppedSiblings(r.helper.GetRef(node), siblings)
+		r.replaceNode(node, content)
+	default:
+		for i := 0; i < len(siblings); i += 2 {
+			r.helper.SetMapValue(content, siblings[i].Value, siblings[i+1])
+		}
+		r.replaceNode(node, content)
+	}
+}
+
+// applyKeptRefSiblings applies the sibling policy to a $ref that stays an internal ref
+func (r *Resolver) applyKeptRefSiblings(node *yaml.Node, config domain.Config) {
+	ref := r.helper.GetRef(node)
+	siblings, _ := refSiblings(node)
+	if !strings.HasPrefix(ref, "#") || len(siblings) == 0 {
+		return
+	}
+
+	policy := config.RefSiblings
+	if policy == "" || policy == domain.RefSiblingsAuto {
+		// 3.1 allows keywords next to $ref. Before 3.1 they are ignored, so schema refs
+		// keep their target through allOf and other refs get a merged copy.
+		if r.usesJSONSchema2020() {
+			return
+		}
+		policy = domain.RefSiblingsMerge
+		if strings.HasPrefix(ref, r.componentRef("schemas", "")) {
+			policy = domain.RefSiblingsAllOf
+		}
+	}
+	if policy == domain.RefSiblingsAllOf && !strings.HasPrefix(ref, r.componentRef("schemas", "")) && !r.atSchema() {
+		policy = domain.RefSiblingsMerge
+	}
+
+	switch policy {
+	case domain.RefSiblingsAllOf:
+		r.replaceNode(node, wrapAllOf(r.helper.CreateRefNode(ref), siblings))
+	case domain.RefSiblingsDrop:
+		r.warnDroppedSiblings(ref, siblings)
+		r.replaceNode(node, r.helper.CreateRefNode(ref))
+	default:
+		target := r.componentContent(ref)
+		if target == nil || target.Kind != yaml.MappingNode {
+			r.replaceNode(node, wrapAllOf(r.helper.CreateRefNode(ref), siblings))
+			return
+		}
+		content := r.helper.CloneNode(target)
+		for i := 0; i < len(siblings); i += 2 {
+			r.helper.SetMapValue(content, siblings[i].Value, siblings[i+1])
+		}
+		r.replaceNode(node, content)
+	}
+}
+
+// atSchema reports whether the node being resolved is a schema, the only place
+// where the target of a $ref can be wrapped in allOf
+func (r *Resolver) atSchema() bool {
+	if strings.HasPrefix(pointer.Format(r.currentPath...)+"/", r.componentRef("schemas", "")) {
+		return true
+	}
+	asyncAPI := r.helper.HasMapKey(r.rootNode, "asyncapi")
+	for _, token := range r.currentPath {
+		switch token {
+		case "schema", "$defs", "definitions":
+			return true
+		case "payload":
+			if asyncAPI {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// wrapAllOf puts target first in the allOf of a mapping made of siblings
+func wrapAllOf(target *yaml.Node, siblings []*yaml.Node) *yaml.Node {
+	wrapped := &yaml.Node{Kind: yaml.MappingNode, Content: siblings}
+	helper := &NodeHelper{}
+	if allOf := helper.GetMapValue(wrapped, "allOf"); allOf != nil && allOf.Kind == yaml.SequenceNode {
+		allOf.Content = append([]*yaml.Node{target}, allOf.Content...)
+		return wrapped
+	}
+	helper.SetMapValue(wrapped, "allOf", &yaml.Node{Kind: yaml.SequenceNode, Content: []*yaml.Node{target}})
+	return wrapped
+}
+
+// warnDroppedSiblings reports the keywords removed next to a $ref
+func (r *Resolver) warnDroppedSiblings(ref string, siblings []*yaml.Node) {
+	keys := make([]string, 0, len(siblings)/2)
+	for i := 0; i < len(siblings); i += 2 {
+		keys = append(keys, siblings[i].Value)
+	}
+	location := r.getCurrentJSONPointer()
+	if location == "" {
+		location = "#"
+	}
+	r.report.Warnings = append(r.report.Warnings, fmt.Sprintf("dropped keywords next to $ref %s at %s: %s", ref, location, strings.Join(keys, ", ")))
+}
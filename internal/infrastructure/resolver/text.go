@@ -0,0 +1,140 @@
+package resolver
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/miorlan/openapi-bundler/internal/domain"
+	"github.com/miorlan/openapi-bundler/internal/infrastructure/errors"
+	"github.com/miorlan/openapi-bundler/internal/infrastructure/uri"
+	"gopkg.in/yaml.v3"
+)
+
+// textExtensions are the files a $ref includes as text, like description: {$ref: ./intro.md}
+var textExtensions = map[string]bool{".md": true, ".markdown": true, ".txt": true}
+
+// isTextFile reports whether a ref location is a text file rather than a YAML or JSON document
+func isTextFile(location string) bool {
+	return textExtensions[strings.ToLower(filepath.Ext(uri.Base(location)))]
+}
+
+var (
+	// markdownInlineLink matches the target of [text](target) and ![alt](target)
+	markdownInlineLink = regexp.MustCompile(`(\]\(\s*<?)([^)\s>]+)`)
+	// markdownLinkDefinition matches the target of a [label]: target definition
+	markdownLinkDefinition = regexp.MustCompile(`^(\s{0,3}\[[^\]]+\]:\s*<?)([^\s>]+)`)
+	// htmlLink matches the target of src="..." and href="..." attributes
+	htmlLink = regexp.MustCompile(`((?:src|href)=["'])([^"']+)`)
+)
+
+// includeText replaces node with the content of a text file as a literal block scalar
+func (r *Resolver) includeText(ctx context.Context, node *yaml.Node, refPath string, config domain.Config) error {
+	data, err := r.load(ctx, refPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &errors.ErrFileNotFound{Path: refPath}
+		}
+		return fmt.Errorf("failed to load file: %w", err)
+	}
+	if config.MaxFileSize > 0 && int64(len(data)) > config.MaxFileSize {
+		return fmt.Errorf("file size %d exceeds maximum allowed size %d", len(data), config.MaxFileSize)
+	}
+
+	text := strings.ReplaceAll(string(data), "\r\n", "\n")
+	if ext := strings.ToLower(filepath.Ext(uri.Base(refPath))); ext == ".md" || ext == ".markdown" {
+		text = r.rewriteMarkdownLinks(text, uri.Dir(refPath), config)
+	}
+
+	r.replaceNode(node, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Style: yaml.LiteralStyle, Value: text})
+	return nil
+}
+
+// includeTextRefs includes the text files referenced within a document, before
+// any other file is loaded into it
+func (r *Resolver) includeTextRefs(ctx context.Context, node *yaml.Node, baseDir string, config domain.Config) error {
+	switch node.Kind {
+	case yaml.MappingNode:
+		if ref := r.helper.GetRef(node); ref != "" {
+			if refPath := r.getRefPath(ref, baseDir); refPath != "" && isTextFile(refPath) {
+				return r.includeText(ctx, node, refPath, config)
+			}
+			return nil
+		}
+		for i := 1; i < len(node.Content); i += 2 {
+			if err := r.includeTextRefs(ctx, node.Content[i], baseDir, config); err != nil {
+				return err
+			}
+		}
+	case yaml.SequenceNode:
+		for _, child := range node.Content {
+			if err := r.includeTextRefs(ctx, child, baseDir, config); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// rewriteMarkdownLinks makes the relative links of a Markdown file included from dir
+// relative to the directory the bundle is written to. Fenced code blocks are left alone.
+func (r *Resolver) rewriteMarkdownLinks(text, dir string, config domain.Config) string {
+	bundleDir := config.BundleDir
+	if bundleDir == "" {
+		bundleDir = r.rootBaseDir
+	}
+	rewrite := func(match string, pattern *regexp.Regexp) string {
+		parts := pattern.FindStringSubmatch(match)
+		return parts[1] + rebaseLink(parts[2], dir, bundleDir)
+	}
+
+	lines := strings.Split(text, "\n")
+	fence := ""
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if fence != "" {
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+			continue
+		}
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			fence = trimmed[:3]
+			continue
+		}
+
+		line = markdownInlineLink.ReplaceAllStringFunc(line, func(m string) string { return rewrite(m, markdownInlineLink) })
+		line = markdownLinkDefinition.ReplaceAllStringFunc(line, func(m string) string { return rewrite(m, markdownLinkDefinition) })
+		lines[i] = htmlLink.ReplaceAllStringFunc(line, func(m string) string { return rewrite(m, htmlLink) })
+	}
+	return strings.Join(lines, "\n")
+}
+
+// rebaseLink resolves a relative link of a file in dir and makes it relative to bundleDir.
+// Anchors, absolute paths and links with a scheme are kept, and so are the links of remote files.
+func rebaseLink(link, dir, bundleDir string) string {
+	if link == "" || strings.HasPrefix(link, "#") || strings.HasPrefix(link, "/") || strings.Contains(strings.SplitN(link, "/", 2)[0], ":") {
+		return link
+	}
+
+	target, suffix := link, ""
+	if idx := strings.IndexAny(link, "?#"); idx >= 0 {
+		target, suffix = link[:idx], link[idx:]
+	}
+
+	resolved := uri.Resolve(dir, target)
+	if uri.IsURI(resolved) || uri.IsURI(bundleDir) {
+		if rel, ok := uri.Rel(bundleDir, resolved); ok && !uri.IsRemote(resolved) {
+			return rel + suffix
+		}
+		return resolved + suffix
+	}
+	rel, err := filepath.Rel(bundleDir, resolved)
+	if err != nil {
+		return link
+	}
+	return strings.ReplaceAll(filepath.ToSlash(rel), " ", "%20") + suffix
+}
@@ -0,0 +1,300 @@
+// Package splitter explodes a single OpenAPI, Swagger or AsyncAPI document into a tree
+// of files, one per path item and component, that bundles back into the same document.
+package splitter
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/miorlan/openapi-bundler/internal/domain"
+	"github.com/miorlan/openapi-bundler/internal/infrastructure/pointer"
+	"github.com/miorlan/openapi-bundler/internal/infrastructure/resolver"
+	"github.com/miorlan/openapi-bundler/internal/infrastructure/uri"
+	"gopkg.in/yaml.v3"
+)
+
+// File is one document of the split tree
+type File struct {
+	// Path is slash-separated and relative to the directory of the root file
+	Path string
+	Node *yaml.Node
+}
+
+// target is a part of the source document moved to its own file
+type target struct {
+	tokens []string
+	file   string
+	node   *yaml.Node
+}
+
+// Splitter splits a document into files
+type Splitter struct {
+	naming domain.SplitNaming
+	helper *resolver.NodeHelper
+
+	rootFile string
+	inputDir string
+	rootDir  string
+	targets  []target
+}
+
+// NewSplitter creates a new Splitter naming files with the given convention
+func NewSplitter(naming domain.SplitNaming) *Splitter {
+	return &Splitter{
+		naming: naming,
+		helper: &resolver.NodeHelper{},
+	}
+}
+
+// Split moves every path item and component of root into its own file and rewrites
+// internal refs to relative file refs. rootPath is where the root file is written and
+// inputDir the directory relative refs of the source document are resolved against.
+// The root file comes first in the result; root itself is modified in place.
+func (s *Splitter) Split(root *yaml.Node, rootPath, inputDir string) ([]File, error) {
+	doc := root
+	if doc.Kind == yaml.DocumentNode && len(doc.Content) > 0 {
+		doc = doc.Content[0]
+	}
+	if doc.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("document root must be a mapping")
+	}
+
+	s.rootFile = filepath.Base(rootPath)
+	s.inputDir = inputDir
+	s.rootDir = filepath.Dir(rootPath)
+	if abs, err := filepath.Abs(s.rootDir); err == nil {
+		s.rootDir = abs
+	}
+	s.targets = nil
+	s.planTargets(doc, path.Ext(s.rootFile))
+
+	files := []File{{Path: s.rootFile, Node: root}}
+	skip := make(map[*yaml.Node]bool, len(s.targets))
+	for _, t := range s.targets {
+		s.rewriteRefs(t.node, t.file, nil)
+		skip[t.node] = true
+		files = append(files, File{Path: t.file, Node: &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{t.node}}})
+	}
+	s.rewriteRefs(doc, s.rootFile, skip)
+
+	for _, t := range s.targets {
+		parent := s.navigate(doc, t.tokens[:len(t.tokens)-1])
+		s.helper.SetMapValue(parent, t.tokens[len(t.tokens)-1], s.helper.CreateRefNode(relativeRef(s.rootFile, t.file)))
+	}
+	return files, nil
+}
+
+// planTargets picks the path items and components that get their own file
+func (s *Splitter) planTargets(doc *yaml.Node, ext string) {
+	used := make(map[string]bool)
+	add := func(tokens []string, dir, name string, node *yaml.Node) {
+		// Values that are only a ref already live elsewhere
+		if node.Kind != yaml.MappingNode || s.helper.IsRef(node) || strings.HasPrefix(name, "x-") {
+			return
+		}
+		base := s.fileName(name)
+		file := dir + "/" + base + ext
+		for i := 2; used[strings.ToLower(file)]; i++ {
+			file = dir + "/" + base + strconv.Itoa(i) + ext
+		}
+		used[strings.ToLower(file)] = true
+		s.targets = append(s.targets, target{tokens: tokens, file: file, node: node})
+	}
+
+	swagger := strings.HasPrefix(s.helper.GetStringValue(s.helper.GetMapValue(doc, "swagger")), "2.")
+	if !s.helper.HasMapKey(doc, "asyncapi") {
+		_ = s.helper.IterateMap(s.helper.GetMapValue(doc, "paths"), func(key string, value *yaml.Node) error {
+			add([]string{"paths", key}, "paths", pathFileName(key), value)
+			return nil
+		})
+	}
+
+	if swagger {
+		for _, section := range []string{"definitions", "parameters", "responses"} {
+			_ = s.helper.IterateMap(s.helper.GetMapValue(doc, section), func(name string, value *yaml.Node) error {
+				add([]string{section, name}, section, name, value)
+				return nil
+			})
+		}
+		return
+	}
+
+	_ = s.helper.IterateMap(s.helper.GetMapValue(doc, "components"), func(section string, sectionNode *yaml.Node) error {
+		if sectionNode.Kind != yaml.MappingNode || strings.HasPrefix(section, "x-") {
+			return nil
+		}
+		return s.helper.IterateMap(sectionNode, func(name string, value *yaml.Node) error {
+			add([]string{"components", section, name}, "components/"+section, name, value)
+			return nil
+		})
+	})
+}
+
+// rewriteRefs rewrites the refs of a node written to file, skipping the given subtrees
+func (s *Splitter) rewriteRefs(node *yaml.Node, file string, skip map[*yaml.Node]bool) {
+	if node == nil || skip[node] {
+		return
+	}
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i].Value, node.Content[i+1]
+			if (key == "$ref" || key == "$dynamicRef" || key == "operationRef") && value.Kind == yaml.ScalarNode {
+				value.Value = s.rewriteRef(value.Value, file)
+				continue
+			}
+			s.rewriteRefs(value, file, skip)
+		}
+	case yaml.SequenceNode:
+		for _, child := range node.Content {
+			s.rewriteRefs(child, file, skip)
+		}
+	}
+}
+
+// rewriteRef turns a ref of the source document into a ref valid from file
+func (s *Splitter) rewriteRef(ref, file string) string {
+	if uri.IsURI(ref) {
+		return ref
+	}
+
+	location, fragment, _ := strings.Cut(ref, "#")
+	if location != "" {
+		// A relative file ref of the source document, now relative to its new file
+		target := uri.Resolve(s.inputDir, location)
+		if target == "" || uri.IsURI(target) {
+			return ref
+		}
+		rel, err := filepath.Rel(filepath.Join(s.rootDir, filepath.FromSlash(path.Dir(file))), target)
+		if err != nil {
+			return ref
+		}
+		location = filepath.ToSlash(rel)
+		if !strings.HasPrefix(location, ".") {
+			location = "./" + location
+		}
+		if fragment != "" {
+			return location + "#" + fragment
+		}
+		return location
+	}
+
+	tokens, err := pointer.Parse(fragment)
+	if err != nil {
+		return ref
+	}
+	for _, t := range s.targets {
+		if !hasPrefix(tokens, t.tokens) {
+			continue
+		}
+		rest := tokens[len(t.tokens):]
+		if t.file == file && len(rest) > 0 {
+			return pointer.Format(rest...)
+		}
+		if len(rest) > 0 {
+			return relativeRef(file, t.file) + pointer.Format(rest...)
+		}
+		return relativeRef(file, t.file)
+	}
+	if file == s.rootFile {
+		return ref
+	}
+	return relativeRef(file, s.rootFile) + "#" + fragment
+}
+
+// navigate follows map keys from node
+func (s *Splitter) navigate(node *yaml.Node, tokens []string) *yaml.Node {
+	for _, token := range tokens {
+		node = s.helper.GetMapValue(node, token)
+	}
+	return node
+}
+
+// fileName applies the naming convention to a path item or component name
+func (s *Splitter) fileName(name string) string {
+	switch s.naming {
+	case domain.SplitNamingKebab:
+		return joinWords(name, "-")
+	case domain.SplitNamingSnake:
+		return joinWords(name, "_")
+	default:
+		return strings.Map(func(c rune) rune {
+			if strings.ContainsRune(`/\:*?"<>|#%`, c) || unicode.IsControl(c) {
+				return '_'
+			}
+			return c
+		}, name)
+	}
+}
+
+// pathFileName names the file of a path item: /users/{id} becomes users_{id}
+func pathFileName(p string) string {
+	name := strings.ReplaceAll(strings.Trim(p, "/"), "/", "_")
+	if name == "" {
+		return "root"
+	}
+	return name
+}
+
+// joinWords splits a name into lower case words at separators and case changes
+// and joins them with sep: UserProfile and user_profile both become user-profile
+func joinWords(name, sep string) string {
+	var words []string
+	var word []rune
+	runes := []rune(name)
+	flush := func() {
+		if len(word) > 0 {
+			words = append(words, strings.ToLower(string(word)))
+			word = word[:0]
+		}
+	}
+	for i, c := range runes {
+		if !unicode.IsLetter(c) && !unicode.IsDigit(c) {
+			flush()
+			continue
+		}
+		if unicode.IsUpper(c) && len(word) > 0 {
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				flush()
+			}
+		}
+		word = append(word, c)
+	}
+	flush()
+	if len(words) == 0 {
+		return "unnamed"
+	}
+	return strings.Join(words, sep)
+}
+
+// relativeRef builds a ref from one file of the tree to another
+func relativeRef(from, to string) string {
+	rel, err := filepath.Rel(path.Dir(from), to)
+	if err != nil {
+		return to
+	}
+	rel = filepath.ToSlash(rel)
+	if !strings.HasPrefix(rel, ".") {
+		rel = "./" + rel
+	}
+	return rel
+}
+
+// hasPrefix reports whether tokens starts with prefix
+func hasPrefix(tokens, prefix []string) bool {
+	if len(tokens) < len(prefix) {
+		return false
+	}
+	for i := range prefix {
+		if tokens[i] != prefix[i] {
+			return false
+		}
+	}
+	return true
+}
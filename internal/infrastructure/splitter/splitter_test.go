@@ -0,0 +1,42 @@
+package splitter
+
+import (
+	"testing"
+
+	"github.com/miorlan/openapi-bundler/internal/domain"
+)
+
+func TestSplitter_FileName(t *testing.T) {
+	tests := []struct {
+		name   string
+		naming domain.SplitNaming
+		want   string
+	}{
+		{"UserProfile", domain.SplitNamingOriginal, "UserProfile"},
+		{"UserProfile", domain.SplitNamingKebab, "user-profile"},
+		{"UserProfile", domain.SplitNamingSnake, "user_profile"},
+		{"HTTPError", domain.SplitNamingKebab, "http-error"},
+		{"user_id2Value", domain.SplitNamingKebab, "user-id2-value"},
+		{"pets_{petId}", domain.SplitNamingSnake, "pets_pet_id"},
+		{"a/b:c", domain.SplitNamingOriginal, "a_b_c"},
+	}
+
+	for _, tt := range tests {
+		if got := NewSplitter(tt.naming).fileName(tt.name); got != tt.want {
+			t.Errorf("fileName(%q, %s) = %q, want %q", tt.name, tt.naming, got, tt.want)
+		}
+	}
+}
+
+func TestPathFileName(t *testing.T) {
+	tests := map[string]string{
+		"/":              "root",
+		"/pets":          "pets",
+		"/pets/{petId}/": "pets_{petId}",
+	}
+	for path, want := range tests {
+		if got := pathFileName(path); got != want {
+			t.Errorf("pathFileName(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+// Package uri resolves $ref locations with RFC 3986 reference resolution.
+// A location is either an absolute URI, such as an http(s) URL or embed:specs/pet.yaml,
+// or a local file path; file:// URIs are turned into local paths, so a file has one
+// identity however it is referenced.
+package uri
+
+import (
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// IsRemote reports whether a location is an http or https URL
+func IsRemote(location string) bool {
+	return strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://")
+}
+
+// Scheme returns the lower-case scheme of a location, or "" for a file path. A single
+// letter before the colon is a Windows drive letter, not a scheme.
+func Scheme(location string) string {
+	i := strings.IndexByte(location, ':')
+	if i < 2 {
+		return ""
+	}
+	for j, c := range location[:i] {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		case j > 0 && (c >= '0' && c <= '9' || c == '+' || c == '-' || c == '.'):
+		default:
+			return ""
+		}
+	}
+	return strings.ToLower(location[:i])
+}
+
+// IsURI reports whether a location is a URI rather than a file path: it has a scheme
+// other than file
+func IsURI(location string) bool {
+	scheme := Scheme(location)
+	return scheme != "" && scheme != "file"
+}
+
+// Resolve resolves a ref without fragment against the directory baseDir. Relative refs
+// of documents loaded from URIs stay URIs, keeping their query; relative refs of local
+// documents are percent-decoded into file paths. URIs of other schemes are kept as is.
+// A file URI written in a document loaded from a URI resolves to "": such documents
+// must not read local files into the bundle.
+func Resolve(baseDir, ref string) string {
+	refURL, err := url.Parse(ref)
+	if err != nil {
+		// Not a valid URI reference, like a file name with a stray %: take it literally
+		refURL = &url.URL{Path: ref}
+	}
+
+	switch {
+	case refURL.Scheme == "file":
+		if IsURI(baseDir) {
+			return ""
+		}
+		return LocalPath(ref)
+	case IsRemote(ref):
+		return refURL.String()
+	case IsURI(ref):
+		return ref
+	case refURL.Scheme != "":
+		// A Windows drive letter: a path written as is
+		refURL = &url.URL{Path: ref}
+	}
+
+	if IsURI(baseDir) {
+		base, err := url.Parse(baseDir)
+		if err != nil {
+			return ref
+		}
+		if opaque(base) {
+			return resolveOpaque(base, refURL)
+		}
+		if !strings.HasSuffix(base.Path, "/") {
+			base.Path += "/"
+		}
+		return base.ResolveReference(refURL).String()
+	}
+
+	p := filepath.FromSlash(refURL.Path)
+	if filepath.IsAbs(p) {
+		return filepath.Clean(p)
+	}
+	return filepath.Join(LocalPath(baseDir), p)
+}
+
+// Dir returns the directory of a location. Directories of URIs end with a slash; a
+// data: URI has none beyond its scheme.
+func Dir(location string) string {
+	if !IsURI(location) {
+		return filepath.Dir(LocalPath(location))
+	}
+	u, err := url.Parse(location)
+	if err != nil {
+		return location
+	}
+	switch {
+	case u.Scheme == "data":
+		return "data:"
+	case opaque(u):
+		return u.Scheme + ":" + u.Opaque[:strings.LastIndex(u.Opaque, "/")+1]
+	}
+	return u.ResolveReference(&url.URL{Path: "."}).String()
+}
+
+// Abs returns the form of a location used as its identity: the URI without fragment
+// or the absolute file path
+func Abs(location string) string {
+	if !IsURI(location) {
+		abs, err := filepath.Abs(LocalPath(location))
+		if err != nil {
+			return location
+		}
+		return abs
+	}
+	if !IsRemote(location) {
+		location, _, _ = strings.Cut(location, "#")
+		return location
+	}
+	u, err := url.Parse(location)
+	if err != nil {
+		return location
+	}
+	u.Fragment = ""
+	u.RawFragment = ""
+	return u.String()
+}
+
+// Base returns the file name of a location, without the query of a URI. A data: URI
+// is named data.
+func Base(location string) string {
+	if !IsURI(location) {
+		return filepath.Base(LocalPath(location))
+	}
+	u, err := url.Parse(location)
+	if err != nil {
+		return path.Base(location)
+	}
+	switch {
+	case u.Scheme == "data":
+		return "data"
+	case opaque(u):
+		return path.Base(u.Opaque)
+	}
+	return path.Base(u.Path)
+}
+
+// Rel returns target relative to the directory baseDir, if it lies inside it. Opaque
+// URIs of one scheme, like embed:, share a single tree with no other names, so their
+// relative path may climb out of baseDir with ../
+func Rel(baseDir, target string) (string, bool) {
+	if IsURI(baseDir) != IsURI(target) {
+		return "", false
+	}
+	if rel, ok := relOpaque(baseDir, target); ok {
+		return rel, true
+	}
+	if IsURI(target) {
+		prefix := strings.TrimSuffix(baseDir, "/") + "/"
+		if !strings.HasPrefix(target, prefix) {
+			return "", false
+		}
+		return strings.TrimPrefix(target, prefix), true
+	}
+	rel, err := filepath.Rel(baseDir, target)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+// relOpaque returns target relative to baseDir when both are opaque URIs of one scheme
+func relOpaque(baseDir, target string) (string, bool) {
+	base, err := url.Parse(baseDir)
+	if err != nil || base.Scheme == "" || base.Scheme == "data" || !opaque(base) {
+		return "", false
+	}
+	u, err := url.Parse(target)
+	if err != nil || u.Scheme != base.Scheme || !opaque(u) {
+		return "", false
+	}
+	rel, err := filepath.Rel(filepath.FromSlash("/"+base.Opaque), filepath.FromSlash("/"+u.Opaque))
+	if err != nil {
+		return "", false
+	}
+	rel = filepath.ToSlash(rel)
+	if u.RawQuery != "" {
+		rel += "?" + u.RawQuery
+	}
+	return rel, true
+}
+
+// LocalPath turns a file:// URI into a file path. Other locations are returned unchanged.
+func LocalPath(location string) string {
+	if !strings.HasPrefix(location, "file:") {
+		return location
+	}
+	u, err := url.Parse(location)
+	if err != nil {
+		return location
+	}
+	p := u.Path
+	if p == "" {
+		// file:relative/path
+		p = u.Opaque
+	}
+	// file:///C:/dir on Windows
+	if len(p) > 2 && p[0] == '/' && p[2] == ':' && filepath.Separator == '\\' {
+		p = p[1:]
+	}
+	return filepath.FromSlash(p)
+}
+
+// opaque reports whether a URI has a path without authority and leading slash, like
+// embed:specs/pet.yaml or the bare embed:
+func opaque(u *url.URL) bool {
+	return u.Opaque != "" || (u.Host == "" && u.Path == "")
+}
+
+// resolveOpaque resolves ref against the directory of an opaque URI, within its path:
+// embed:specs/ and ../common/pet.yaml give embed:common/pet.yaml
+func resolveOpaque(base, ref *url.URL) string {
+	p := ref.EscapedPath()
+	if !strings.HasPrefix(p, "/") {
+		p = path.Join("/"+base.Opaque, p)
+	}
+	resolved := base.Scheme + ":" + strings.TrimPrefix(path.Clean(p), "/")
+	if ref.RawQuery != "" {
+		resolved += "?" + ref.RawQuery
+	}
+	return resolved
+}
@@ -0,0 +1,106 @@
+package uri
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		name    string
+		baseDir string
+		ref     string
+		want    string
+	}{
+		{name: "remote parent", baseDir: "https://example.com/api/v1/", ref: "../common/errors.yaml", want: "https://example.com/api/common/errors.yaml"},
+		{name: "remote without slash", baseDir: "https://example.com/api", ref: "pets.yaml", want: "https://example.com/api/pets.yaml"},
+		{name: "remote query", baseDir: "https://example.com/api/", ref: "schema.yaml?version=2", want: "https://example.com/api/schema.yaml?version=2"},
+		{name: "remote absolute path", baseDir: "https://example.com/api/v1/", ref: "/shared/pet.yaml", want: "https://example.com/shared/pet.yaml"},
+		{name: "remote encoded", baseDir: "https://example.com/api/", ref: "My%20Schema.yaml", want: "https://example.com/api/My%20Schema.yaml"},
+		{name: "absolute URL", baseDir: "/specs", ref: "http://example.com/pet.yaml", want: "http://example.com/pet.yaml"},
+		{name: "local relative", baseDir: "/specs/api", ref: "../common/errors.yaml", want: filepath.FromSlash("/specs/common/errors.yaml")},
+		{name: "local encoded", baseDir: "/specs", ref: "My%20Schema.yaml", want: filepath.FromSlash("/specs/My Schema.yaml")},
+		{name: "local query dropped", baseDir: "/specs", ref: "pet.yaml?v=1", want: filepath.FromSlash("/specs/pet.yaml")},
+		{name: "local stray percent", baseDir: "/specs", ref: "100%.yaml", want: filepath.FromSlash("/specs/100%.yaml")},
+		{name: "file URI", baseDir: "/specs", ref: "file:///specs/pet.yaml", want: filepath.FromSlash("/specs/pet.yaml")},
+		{name: "file URI from remote", baseDir: "https://example.com/", ref: "file:///etc/passwd", want: ""},
+		{name: "file URI from opaque", baseDir: "embed:specs/", ref: "file:///etc/passwd", want: ""},
+		{name: "remote root path stays remote", baseDir: "https://example.com/api/", ref: "/etc/passwd", want: "https://example.com/etc/passwd"},
+		{name: "other scheme kept", baseDir: "/specs", ref: "env:PET_SCHEMA", want: "env:PET_SCHEMA"},
+		{name: "opaque relative", baseDir: "embed:specs/api/", ref: "../common/pet.yaml", want: "embed:specs/common/pet.yaml"},
+		{name: "opaque root", baseDir: "embed:", ref: "schemas/pet.yaml?v=1", want: "embed:schemas/pet.yaml?v=1"},
+		{name: "opaque above root", baseDir: "embed:specs/", ref: "../../pet.yaml", want: "embed:pet.yaml"},
+		{name: "hierarchical scheme", baseDir: "s3://bucket/specs/", ref: "pet.yaml", want: "s3://bucket/specs/pet.yaml"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Resolve(tt.baseDir, tt.ref); got != tt.want {
+				t.Errorf("Resolve(%q, %q) = %q, want %q", tt.baseDir, tt.ref, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDir(t *testing.T) {
+	tests := map[string]string{
+		"https://example.com/api/openapi.yaml?token=a/b": "https://example.com/api/",
+		"https://example.com/openapi.yaml":               "https://example.com/",
+		"file:///specs/api/openapi.yaml":                 filepath.FromSlash("/specs/api"),
+		filepath.FromSlash("/specs/openapi.yaml"):        filepath.FromSlash("/specs"),
+		"embed:specs/api/openapi.yaml":                   "embed:specs/api/",
+		"embed:openapi.yaml":                             "embed:",
+		"data:application/yaml;base64,dHlwZTogb2JqZWN0":  "data:",
+	}
+	for location, want := range tests {
+		if got := Dir(location); got != want {
+			t.Errorf("Dir(%q) = %q, want %q", location, got, want)
+		}
+	}
+}
+
+func TestBaseAndRel(t *testing.T) {
+	if got := Base("https://example.com/schemas/Pet.yaml?v=1"); got != "Pet.yaml" {
+		t.Errorf("Base() = %q, want Pet.yaml", got)
+	}
+	if got, ok := Rel("https://example.com/api/", "https://example.com/api/schemas/pet.yaml"); !ok || got != "schemas/pet.yaml" {
+		t.Errorf("Rel() = %q, %v, want schemas/pet.yaml", got, ok)
+	}
+	if _, ok := Rel(filepath.FromSlash("/specs"), "https://example.com/api/pet.yaml"); ok {
+		t.Error("Rel() of a URL against a local directory should fail")
+	}
+	if got := Base("embed:specs/Pet.yaml"); got != "Pet.yaml" {
+		t.Errorf("Base() = %q, want Pet.yaml", got)
+	}
+	if got := Abs("env:PET_SCHEMA#/properties"); got != "env:PET_SCHEMA" {
+		t.Errorf("Abs() = %q, want env:PET_SCHEMA", got)
+	}
+	if _, ok := Rel(filepath.FromSlash("/specs/api"), filepath.FromSlash("/specs/common/pet.yaml")); ok {
+		t.Error("Rel() outside the base directory should fail")
+	}
+	if got, ok := Rel("embed:specs/api/", "embed:specs/common/pet.yaml"); !ok || got != "../common/pet.yaml" {
+		t.Errorf("Rel() = %q, %v, want ../common/pet.yaml", got, ok)
+	}
+	if _, ok := Rel("embed:specs/", "other:specs/pet.yaml"); ok {
+		t.Error("Rel() across schemes should fail")
+	}
+}
+
+func TestScheme(t *testing.T) {
+	tests := map[string]string{
+		"https://example.com/pet.yaml": "https",
+		"Embed:specs/pet.yaml":         "embed",
+		"git+ssh://host/repo":          "git+ssh",
+		"C:\\specs\\pet.yaml":          "",
+		"./schemas/pet.yaml":           "",
+		"1abc:pet.yaml":                "",
+	}
+	for location, want := range tests {
+		if got := Scheme(location); got != want {
+			t.Errorf("Scheme(%q) = %q, want %q", location, got, want)
+		}
+	}
+	if IsURI("file:///specs/pet.yaml") || !IsURI("env:PET") {
+		t.Error("IsURI() should be false for file URIs and true for other schemes")
+	}
+}
@@ -1,10 +1,16 @@
 package validator
 
 import (
+	"encoding/json"
 	"fmt"
+	"os"
+	"strings"
 
+	"github.com/getkin/kin-openapi/openapi2"
+	"github.com/getkin/kin-openapi/openapi2conv"
 	"github.com/getkin/kin-openapi/openapi3"
 	"github.com/miorlan/openapi-bundler/internal/domain"
+	"gopkg.in/yaml.v3"
 )
 
 type Validator struct{}
@@ -14,10 +20,39 @@ func NewValidator() domain.Validator {
 }
 
 func (v *Validator) Validate(filePath string) error {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return fmt.Errorf("invalid OpenAPI specification: %w", err)
+	}
+	return v.ValidateData(data)
+}
+
+func (v *Validator) ValidateData(data []byte) error {
+	var header struct {
+		Swagger  string `yaml:"swagger"`
+		AsyncAPI string `yaml:"asyncapi"`
+		Info     struct {
+			Title   string `yaml:"title"`
+			Version string `yaml:"version"`
+		} `yaml:"info"`
+	}
+	if err := yaml.Unmarshal(data, &header); err == nil {
+		if strings.HasPrefix(header.Swagger, "2.") {
+			return validateSwagger(data)
+		}
+		// AsyncAPI has no schema validator here; only the required fields are checked
+		if header.AsyncAPI != "" {
+			if header.Info.Title == "" || header.Info.Version == "" {
+				return fmt.Errorf("invalid AsyncAPI specification: info.title and info.version are required")
+			}
+			return nil
+		}
+	}
+
 	loader := openapi3.NewLoader()
 	loader.IsExternalRefsAllowed = false
 
-	_, err := loader.LoadFromFile(filePath)
+	_, err := loader.LoadFromData(data)
 	if err != nil {
 		return fmt.Errorf("invalid OpenAPI specification: %w", err)
 	}
@@ -25,3 +60,68 @@ func (v *Validator) Validate(filePath string) error {
 	return nil
 }
 
+// validateSwagger checks a Swagger 2.0 document by converting it to OpenAPI 3
+func validateSwagger(data []byte) error {
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		return fmt.Errorf("invalid Swagger specification: %w", err)
+	}
+	raw, err := jsonValue(&node)
+	if err != nil {
+		return fmt.Errorf("invalid Swagger specification: %w", err)
+	}
+	jsonData, err := json.Marshal(raw)
+	if err != nil {
+		return fmt.Errorf("invalid Swagger specification: %w", err)
+	}
+
+	var doc openapi2.T
+	if err := json.Unmarshal(jsonData, &doc); err != nil {
+		return fmt.Errorf("invalid Swagger specification: %w", err)
+	}
+	if _, err := openapi2conv.ToV3(&doc); err != nil {
+		return fmt.Errorf("invalid Swagger specification: %w", err)
+	}
+
+	return nil
+}
+
+// jsonValue converts a YAML node to JSON-compatible values. Mapping keys are kept
+// as strings, so unquoted status codes like 200 stay valid object keys.
+func jsonValue(node *yaml.Node) (interface{}, error) {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		if len(node.Content) == 0 {
+			return nil, nil
+		}
+		return jsonValue(node.Content[0])
+	case yaml.MappingNode:
+		m := make(map[string]interface{}, len(node.Content)/2)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			value, err := jsonValue(node.Content[i+1])
+			if err != nil {
+				return nil, err
+			}
+			m[node.Content[i].Value] = value
+		}
+		return m, nil
+	case yaml.SequenceNode:
+		s := make([]interface{}, 0, len(node.Content))
+		for _, child := range node.Content {
+			value, err := jsonValue(child)
+			if err != nil {
+				return nil, err
+			}
+			s = append(s, value)
+		}
+		return s, nil
+	case yaml.AliasNode:
+		return jsonValue(node.Alias)
+	default:
+		var value interface{}
+		if err := node.Decode(&value); err != nil {
+			return nil, err
+		}
+		return value, nil
+	}
+}
@@ -58,3 +58,55 @@ func TestValidator_Validate_FileNotFound(t *testing.T) {
 	}
 }
 
+
+func TestValidator_Validate_Swagger2(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "swagger.yaml")
+
+	content := `swagger: "2.0"
+info:
+  title: Test API
+  version: 1.0.0
+paths:
+  /pets:
+    get:
+      responses:
+        200:
+          description: Success
+          schema:
+            $ref: '#/definitions/Pet'
+definitions:
+  Pet:
+    type: object
+`
+
+	if err := os.WriteFile(testFile, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	validator := NewValidator()
+	if err := validator.Validate(testFile); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+}
+
+func TestValidator_Validate_AsyncAPI(t *testing.T) {
+	tmpDir := t.TempDir()
+	validFile := filepath.Join(tmpDir, "valid.yaml")
+	invalidFile := filepath.Join(tmpDir, "invalid.yaml")
+
+	if err := os.WriteFile(validFile, []byte("asyncapi: 3.0.0\ninfo:\n  title: Events\n  version: 1.0.0\n"), 0644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	if err := os.WriteFile(invalidFile, []byte("asyncapi: 3.0.0\ninfo:\n  title: Events\n"), 0644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	validator := NewValidator()
+	if err := validator.Validate(validFile); err != nil {
+		t.Errorf("Validate() error = %v", err)
+	}
+	if err := validator.Validate(invalidFile); err == nil {
+		t.Error("Validate() expected error for missing info.version")
+	}
+}
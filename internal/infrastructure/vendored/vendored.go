@@ -0,0 +1,288 @@
+// Package vendored keeps the remote files of a spec under a local directory, listed in
+// a manifest, so the spec can be bundled without network access
+package vendored
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/miorlan/openapi-bundler/internal/domain"
+	"github.com/miorlan/openapi-bundler/internal/infrastructure/uri"
+)
+
+// ManifestFile is the name of the manifest within the vendor directory
+const ManifestFile = "manifest.json"
+
+// Manifest lists the vendored files
+type Manifest struct {
+	Files []File `json:"files"`
+}
+
+// File is a vendored remote file
+type File struct {
+	URL string `json:"url"`
+	// Path is relative to the vendor directory, with forward slashes
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+}
+
+// Recorder is a FileLoader that keeps a copy of every remote file it loads
+type Recorder struct {
+	loader domain.FileLoader
+	mu     sync.Mutex
+	files  map[string][]byte
+}
+
+// NewRecorder creates a Recorder loading files through loader
+func NewRecorder(loader domain.FileLoader) *Recorder {
+	return &Recorder{loader: loader, files: make(map[string][]byte)}
+}
+
+func (r *Recorder) Load(ctx context.Context, path string) ([]byte, error) {
+	data, err := r.loader.Load(ctx, path)
+	if err == nil {
+		r.record(path, data)
+	}
+	return data, err
+}
+
+// LoadMany loads through the wrapped loader's LoadMany when it has one, so recording
+// keeps the prefetch concurrent
+func (r *Recorder) LoadMany(ctx context.Context, paths []string) (map[string][]byte, error) {
+	batch, ok := r.loader.(domain.BatchFileLoader)
+	if !ok {
+		files := make(map[string][]byte, len(paths))
+		for _, path := range paths {
+			data, err := r.Load(ctx, path)
+			if err != nil {
+				return files, fmt.Errorf("failed to load %s: %w", path, err)
+			}
+			files[path] = data
+		}
+		return files, nil
+	}
+
+	files, err := batch.LoadMany(ctx, paths)
+	for path, data := range files {
+		r.record(path, data)
+	}
+	return files, err
+}
+
+// Exists checks the file with the wrapped loader, so that recording resolves refs like
+// the bundle does
+func (r *Recorder) Exists(path string) bool {
+	checker, ok := r.loader.(domain.FileChecker)
+	return ok && checker.Exists(path)
+}
+
+// Files returns the remote files loaded so far, keyed by URL
+func (r *Recorder) Files() map[string][]byte {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	files := make(map[string][]byte, len(r.files))
+	for url, data := range r.files {
+		files[url] = data
+	}
+	return files
+}
+
+func (r *Recorder) record(path string, data []byte) {
+	if !uri.IsRemote(path) {
+		return
+	}
+	r.mu.Lock()
+	r.files[path] = data
+	r.mu.Unlock()
+}
+
+// Write stores files, keyed by URL, under dir as host/path and writes the manifest.
+// Files of a previous manifest that are no longer needed are removed.
+func Write(dir string, files map[string][]byte) (*Manifest, error) {
+	previous, err := readManifest(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create vendor directory: %w", err)
+	}
+
+	urls := make([]string, 0, len(files))
+	for u := range files {
+		urls = append(urls, u)
+	}
+	sort.Strings(urls)
+
+	manifest := &Manifest{Files: make([]File, 0, len(urls))}
+	used := make(map[string]bool)
+	for _, u := range urls {
+		name := fileName(u)
+		if used[name] {
+			name = withHash(name, u)
+		}
+		used[name] = true
+
+		target, err := vendorPath(dir, name)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return nil, fmt.Errorf("failed to create directory for %s: %w", u, err)
+		}
+		if err := os.WriteFile(target, files[u], 0644); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", u, err)
+		}
+		manifest.Files = append(manifest.Files, File{URL: u, Path: name, SHA256: checksum(files[u])})
+	}
+
+	if previous != nil {
+		for _, f := range previous.Files {
+			if target, err := vendorPath(dir, f.Path); err == nil && !used[f.Path] {
+				_ = os.Remove(target)
+			}
+		}
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, ManifestFile), append(data, '\n'), 0644); err != nil {
+		return nil, fmt.Errorf("failed to write manifest: %w", err)
+	}
+	return manifest, nil
+}
+
+// Store serves remote files from a vendor directory. The manifest is read on first use.
+type Store struct {
+	dir   string
+	once  sync.Once
+	files map[string]File
+	err   error
+}
+
+// NewStore creates a Store for the vendor directory dir
+func NewStore(dir string) *Store {
+	return &Store{dir: dir}
+}
+
+// Load returns the vendored copy of url. It fails with ErrNotVendored when the manifest
+// does not list url, and with a checksum error when the file was changed after vendoring.
+func (s *Store) Load(url string) ([]byte, error) {
+	s.once.Do(s.open)
+	if s.err != nil {
+		return nil, s.err
+	}
+
+	f, ok := s.files[url]
+	if !ok {
+		return nil, &domain.ErrNotVendored{URL: url, Dir: s.dir}
+	}
+	target, err := vendorPath(s.dir, f.Path)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(target)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read vendored %s: %w", url, err)
+	}
+	if checksum(data) != f.SHA256 {
+		return nil, fmt.Errorf("vendored %s does not match the manifest checksum, run the vendor command again", f.Path)
+	}
+	return data, nil
+}
+
+func (s *Store) open() {
+	manifest, err := readManifest(s.dir)
+	if err != nil {
+		s.err = fmt.Errorf("offline: failed to read vendor manifest: %w", err)
+		return
+	}
+	s.files = make(map[string]File, len(manifest.Files))
+	for _, f := range manifest.Files {
+		s.files[f.URL] = f
+	}
+}
+
+func readManifest(dir string) (*Manifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, ManifestFile))
+	if err != nil {
+		return nil, err
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", ManifestFile, err)
+	}
+	return &manifest, nil
+}
+
+// fileName places a URL under its host and path: https://example.com:8443/api/pet.yaml
+// is example.com_8443/api/pet.yaml. URLs with a query get a hash of it in their name.
+func fileName(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return withHash("remote", rawURL)
+	}
+	segments := []string{safeSegment(u.Host)}
+	for _, segment := range strings.Split(path.Clean("/"+u.Path), "/") {
+		if segment != "" {
+			segments = append(segments, safeSegment(segment))
+		}
+	}
+	if len(segments) == 1 {
+		segments = append(segments, "index")
+	}
+	name := strings.Join(segments, "/")
+	if u.RawQuery != "" {
+		name = withHash(name, rawURL)
+	}
+	return name
+}
+
+// safeSegment makes a host or path segment a plain file name: characters other than
+// ASCII letters, digits, '.', '-' and '_' become '_', and so does a name of dots only
+func safeSegment(segment string) string {
+	segment = strings.Map(func(c rune) rune {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '.', c == '-', c == '_':
+			return c
+		}
+		return '_'
+	}, segment)
+	if strings.Trim(segment, ".") == "" {
+		return "_"
+	}
+	return segment
+}
+
+// vendorPath returns the file a manifest path names under dir. Paths that would leave
+// dir are refused, so neither a URL nor an edited manifest reaches other files.
+func vendorPath(dir, name string) (string, error) {
+	target := filepath.Join(dir, filepath.FromSlash(name))
+	rel, err := filepath.Rel(dir, target)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("vendored path %s is outside %s", name, dir)
+	}
+	return target, nil
+}
+
+// withHash adds a short hash of key to name, before its extension
+func withHash(name, key string) string {
+	ext := path.Ext(name)
+	return strings.TrimSuffix(name, ext) + "-" + checksum([]byte(key))[:8] + ext
+}
+
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
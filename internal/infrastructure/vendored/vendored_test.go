@@ -0,0 +1,87 @@
+package vendored
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/miorlan/openapi-bundler/internal/domain"
+)
+
+func TestFileName(t *testing.T) {
+	tests := map[string]string{
+		"https://example.com/api/pet.yaml":       "example.com/api/pet.yaml",
+		"https://example.com:8443/pet.yaml":      "example.com_8443/pet.yaml",
+		"https://example.com/../../etc/pet.yaml": "example.com/etc/pet.yaml",
+		"https://example.com/":                   "example.com/index",
+		"https://example.com/pet.yaml?v=2":       "example.com/pet-" + checksum([]byte("https://example.com/pet.yaml?v=2"))[:8] + ".yaml",
+		"https://../pet.yaml":                    "_/pet.yaml",
+		"https://[::1]:8080/My%20Pet.yaml":       "___1__8080/My_Pet.yaml",
+		"https://example.com/a%2F..%2F..%2Fx":    "example.com/x",
+	}
+	for url, want := range tests {
+		if got := fileName(url); got != want {
+			t.Errorf("fileName(%q) = %q, want %q", url, got, want)
+		}
+	}
+}
+
+func TestWriteAndStore(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string][]byte{
+		"https://example.com/pet.yaml": []byte("type: object"),
+		"http://example.com/pet.yaml":  []byte("type: string"),
+		"https://example.com/old.yaml": []byte("type: number"),
+		"https://example.com/docs.md":  []byte("# Docs"),
+	}
+	if _, err := Write(dir, files); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	delete(files, "https://example.com/old.yaml")
+	manifest, err := Write(dir, files)
+	if err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if len(manifest.Files) != 3 {
+		t.Errorf("manifest has %d files, want 3", len(manifest.Files))
+	}
+	if _, err := os.Stat(filepath.Join(dir, "example.com", "old.yaml")); !os.IsNotExist(err) {
+		t.Error("Write() should remove files of the previous manifest that are no longer needed")
+	}
+
+	store := NewStore(dir)
+	for url, want := range files {
+		data, err := store.Load(url)
+		if err != nil {
+			t.Fatalf("Load(%q) error = %v", url, err)
+		}
+		if string(data) != string(want) {
+			t.Errorf("Load(%q) = %q, want %q", url, data, want)
+		}
+	}
+
+	var notVendored *domain.ErrNotVendored
+	if _, err := store.Load("https://example.com/missing.yaml"); !errors.As(err, &notVendored) {
+		t.Errorf("Load() of a missing URL error = %v, want ErrNotVendored", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "example.com", "docs.md"), []byte("changed"), 0644); err != nil {
+		t.Fatalf("Failed to modify vendored file: %v", err)
+	}
+	if _, err := store.Load("https://example.com/docs.md"); err == nil {
+		t.Error("Load() of a modified file should fail the checksum")
+	}
+}
+
+func TestVendorPath(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := vendorPath(dir, "example.com/pet.yaml"); err != nil {
+		t.Errorf("vendorPath() error = %v", err)
+	}
+	for _, name := range []string{"../pet.yaml", "example.com/../../pet.yaml", ".", ".."} {
+		if _, err := vendorPath(dir, name); err == nil {
+			t.Errorf("vendorPath(%q) should refuse a path outside the vendor directory", name)
+		}
+	}
+}
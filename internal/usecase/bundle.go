@@ -4,11 +4,13 @@ import (
 	"context"
 	"fmt"
 	"path/filepath"
-	"strings"
 
 	"github.com/miorlan/openapi-bundler/internal/domain"
+	"github.com/miorlan/openapi-bundler/internal/infrastructure/overlay"
 	"github.com/miorlan/openapi-bundler/internal/infrastructure/parser"
 	"github.com/miorlan/openapi-bundler/internal/infrastructure/resolver"
+	"github.com/miorlan/openapi-bundler/internal/infrastructure/uri"
+	"gopkg.in/yaml.v3"
 )
 
 // Config contains bundler configuration
@@ -17,6 +19,27 @@ type Config struct {
 	MaxFileSize int64
 	MaxDepth    int
 	Inline      bool
+	// CircularRefs selects how circular references are handled (keep by default)
+	CircularRefs domain.CircularRefPolicy
+	// NameCollisions selects how conflicting component names are resolved (suffix by default)
+	NameCollisions domain.NameCollisionStrategy
+	// Dedupe selects how duplicate schemas are detected (exact by default)
+	Dedupe domain.DedupeMode
+	// RefSiblings selects what happens to keywords next to a $ref (auto by default)
+	RefSiblings domain.RefSiblingPolicy
+	// EmbedExamples loads externalValue example files into the bundle
+	EmbedExamples bool
+	// EmbedExamplesMaxSize is the size above which example files are copied next to the output instead
+	EmbedExamplesMaxSize int64
+	// RemoveUnused drops unreferenced components, except KeepComponents and those marked x-keep
+	RemoveUnused   bool
+	KeepComponents []string
+	// Operations keeps only the matching operations and what they use
+	Operations domain.OperationFilter
+	// Overlays are Overlay 1.0 documents applied in order to the resolved document
+	Overlays []string
+	// Concurrency is how many path items are resolved at the same time
+	Concurrency int
 }
 
 // BundleUseCase bundles OpenAPI specs using yaml.Node to preserve order
@@ -41,49 +64,139 @@ func NewBundleUseCase(
 
 // Execute bundles the OpenAPI specification
 func (uc *BundleUseCase) Execute(ctx context.Context, inputPath, outputPath string, config Config) error {
+	_, err := uc.ExecuteWithReport(ctx, inputPath, outputPath, config)
+	return err
+}
+
+// ExecuteWithReport bundles the OpenAPI specification and reports the changes made to it
+func (uc *BundleUseCase) ExecuteWithReport(ctx context.Context, inputPath, outputPath string, config Config) (*domain.Report, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	root, report, err := uc.resolve(ctx, inputPath, getBasePath(outputPath), config)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := uc.applyOverlays(ctx, root, report, config.Overlays); err != nil {
+		return nil, err
+	}
+
+	if err := uc.write(root, report, outputPath, config.Validate); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// ExecuteToBytes bundles the specification and returns it in format instead of writing
+// it. Files the bundle refers to, like large examples, are only listed in the report.
+func (uc *BundleUseCase) ExecuteToBytes(ctx context.Context, inputPath string, format domain.FileFormat, config Config) ([]byte, *domain.Report, error) {
 	if ctx.Err() != nil {
-		return ctx.Err()
+		return nil, nil, ctx.Err()
+	}
+
+	root, report, err := uc.resolve(ctx, inputPath, "", config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := uc.applyOverlays(ctx, root, report, config.Overlays); err != nil {
+		return nil, nil, err
+	}
+
+	data, err := marshal(root, format)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if config.Validate {
+		if err := uc.validator.ValidateData(data); err != nil {
+			return nil, nil, fmt.Errorf("validation failed: %w", err)
+		}
 	}
+	return data, report, nil
+}
 
+// resolve loads the spec at inputPath and resolves all of its references. Relative
+// links of included text files are rewritten against bundleDir.
+func (uc *BundleUseCase) resolve(ctx context.Context, inputPath, bundleDir string, config Config) (*yaml.Node, *domain.Report, error) {
 	// Load input file
 	data, err := uc.fileLoader.Load(ctx, inputPath)
 	if err != nil {
-		return fmt.Errorf("failed to load input file: %w", err)
+		return nil, nil, fmt.Errorf("failed to load input file: %w", err)
 	}
 
 	if config.MaxFileSize > 0 && int64(len(data)) > config.MaxFileSize {
-		return fmt.Errorf("file size %d exceeds maximum allowed size %d", len(data), config.MaxFileSize)
+		return nil, nil, fmt.Errorf("file size %d exceeds maximum allowed size %d", len(data), config.MaxFileSize)
 	}
 
 	// Parse as yaml.Node to preserve order
 	p := parser.NewParser()
 	root, err := p.ParseFile(data)
 	if err != nil {
-		return fmt.Errorf("failed to parse input file: %w", err)
+		return nil, nil, fmt.Errorf("failed to parse input file: %w", err)
 	}
 
-	// Set output format based on output file extension
-	outputFormat := domain.DetectFormat(outputPath)
-	p.SetOutputFormat(outputFormat)
-
 	// Get base path
 	basePath := getBasePath(inputPath)
 
 	// Resolve all references
 	r := resolver.NewResolver(uc.fileLoader)
 	domainConfig := domain.Config{
-		MaxFileSize: config.MaxFileSize,
-		MaxDepth:    config.MaxDepth,
-		Inline:      config.Inline,
+		MaxFileSize:          config.MaxFileSize,
+		MaxDepth:             config.MaxDepth,
+		Inline:               config.Inline,
+		CircularRefs:         config.CircularRefs,
+		NameCollisions:       config.NameCollisions,
+		Dedupe:               config.Dedupe,
+		RefSiblings:          config.RefSiblings,
+		RootPath:             inputPath,
+		BundleDir:            bundleDir,
+		EmbedExamples:        config.EmbedExamples,
+		EmbedExamplesMaxSize: config.EmbedExamplesMaxSize,
+		RemoveUnused:         config.RemoveUnused,
+		KeepComponents:       config.KeepComponents,
+		Operations:           config.Operations,
+		Concurrency:          config.Concurrency,
 	}
 	if err := r.ResolveNode(ctx, root, basePath, domainConfig); err != nil {
-		return fmt.Errorf("failed to resolve references: %w", err)
+		return nil, nil, fmt.Errorf("failed to resolve references: %w", err)
 	}
+	return root, r.Report(), nil
+}
+
+// applyOverlays applies Overlay documents to root in order. Actions whose target
+// matches nothing are reported as warnings.
+func (uc *BundleUseCase) applyOverlays(ctx context.Context, root *yaml.Node, report *domain.Report, overlays []string) error {
+	for _, overlayPath := range overlays {
+		data, err := uc.fileLoader.Load(ctx, overlayPath)
+		if err != nil {
+			return fmt.Errorf("failed to load overlay %s: %w", overlayPath, err)
+		}
+
+		o, err := overlay.Parse(data)
+		if err != nil {
+			return fmt.Errorf("overlay %s: %w", overlayPath, err)
+		}
+
+		warnings, err := o.Apply(root)
+		for _, warning := range warnings {
+			report.Warnings = append(report.Warnings, fmt.Sprintf("overlay %s: %s", overlayPath, warning))
+		}
+		if err != nil {
+			return fmt.Errorf("failed to apply overlay %s: %w", overlayPath, err)
+		}
+	}
+	return nil
+}
 
-	// Marshal result
-	outputData, err := p.MarshalNode(root)
+// write writes the document to outputPath in the format of its extension, with the
+// assets of the report next to it, and validates it if requested
+func (uc *BundleUseCase) write(root *yaml.Node, report *domain.Report, outputPath string, validate bool) error {
+	outputData, err := marshal(root, domain.DetectFormat(outputPath))
 	if err != nil {
-		return fmt.Errorf("failed to marshal result: %w", err)
+		return err
 	}
 
 	// Write output
@@ -91,26 +204,42 @@ func (uc *BundleUseCase) Execute(ctx context.Context, inputPath, outputPath stri
 		return fmt.Errorf("failed to write output file: %w", err)
 	}
 
+	// Write the files the bundle refers to next to it
+	for _, asset := range report.Assets {
+		assetPath := filepath.Join(filepath.Dir(outputPath), filepath.FromSlash(asset.Path))
+		if err := uc.fileWriter.Write(assetPath, asset.Data); err != nil {
+			return fmt.Errorf("failed to write %s: %w", asset.Path, err)
+		}
+	}
+
 	// Validate if requested
-	if config.Validate {
+	if validate {
 		if err := uc.validator.Validate(outputPath); err != nil {
 			_ = uc.fileWriter.Write(outputPath, nil)
 			return fmt.Errorf("validation failed: %w", err)
 		}
 	}
-
 	return nil
 }
 
+// marshal encodes the document in format
+func marshal(root *yaml.Node, format domain.FileFormat) ([]byte, error) {
+	p := parser.NewParser()
+	p.SetOutputFormat(format)
+
+	data, err := p.MarshalNode(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal result: %w", err)
+	}
+	return data, nil
+}
+
 func getBasePath(path string) string {
-	if strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://") {
-		lastSlash := strings.LastIndex(path, "/")
-		if lastSlash >= 0 {
-			return path[:lastSlash+1]
-		}
-		return path + "/"
+	if uri.IsURI(path) {
+		return uri.Dir(path)
 	}
 
+	path = uri.LocalPath(path)
 	absPath, err := filepath.Abs(path)
 	if err != nil {
 		return filepath.Dir(path)
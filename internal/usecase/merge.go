@@ -0,0 +1,97 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/miorlan/openapi-bundler/internal/domain"
+	"github.com/miorlan/openapi-bundler/internal/infrastructure/merger"
+	"github.com/miorlan/openapi-bundler/internal/infrastructure/uri"
+)
+
+// MergeConfig contains merge configuration
+type MergeConfig struct {
+	// Config applies to bundling each input; Validate checks the merged document
+	Config
+	// OverridePaths takes an operation defined by several inputs from the last one
+	// instead of failing with ErrPathConflict
+	OverridePaths bool
+}
+
+// MergeUseCase combines several independent OpenAPI specs into one
+type MergeUseCase struct {
+	bundle *BundleUseCase
+}
+
+// NewMergeUseCase creates a new MergeUseCase
+func NewMergeUseCase(
+	fileLoader domain.FileLoader,
+	fileWriter domain.FileWriter,
+	validator domain.Validator,
+) *MergeUseCase {
+	return &MergeUseCase{
+		bundle: NewBundleUseCase(fileLoader, fileWriter, validator),
+	}
+}
+
+// Execute bundles every input, merges them and writes the result to outputPath. The
+// report lists the changes made while bundling the inputs and the components renamed
+// because several inputs define them differently.
+func (uc *MergeUseCase) Execute(ctx context.Context, inputs []domain.MergeInput, outputPath string, config MergeConfig) (*domain.Report, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if len(inputs) == 0 {
+		return nil, fmt.Errorf("no input files to merge")
+	}
+
+	report := &domain.Report{}
+	docs := make([]merger.Document, 0, len(inputs))
+	for _, input := range inputs {
+		root, inputReport, err := uc.bundle.resolve(ctx, input.Path, getBasePath(outputPath), config.Config)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", input.Path, err)
+		}
+		report.Renames = append(report.Renames, inputReport.Renames...)
+		report.Warnings = append(report.Warnings, inputReport.Warnings...)
+		report.Assets = append(report.Assets, inputReport.Assets...)
+		report.Removed = append(report.Removed, inputReport.Removed...)
+
+		name := input.Name
+		if name == "" {
+			name = serviceName(input.Path)
+		}
+		docs = append(docs, merger.Document{Root: root, Name: name, Source: input.Path, PathPrefix: input.PathPrefix})
+	}
+
+	root, mergeReport, err := merger.NewMerger(config.OverridePaths).Merge(docs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to merge: %w", err)
+	}
+	report.Renames = append(report.Renames, mergeReport.Renames...)
+
+	if err := uc.bundle.applyOverlays(ctx, root, report, config.Overlays); err != nil {
+		return nil, err
+	}
+
+	if err := uc.bundle.write(root, report, outputPath, config.Validate); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// serviceName names a service after its spec file, or its directory for generic
+// file names: services/billing/openapi.yaml is billing
+func serviceName(path string) string {
+	base := uri.Base(path)
+	name := strings.TrimSuffix(base, filepath.Ext(base))
+	switch strings.ToLower(name) {
+	case "index", "openapi", "api", "spec", "swagger":
+		if dir := uri.Base(uri.Dir(path)); dir != "" && dir != "." && dir != "/" {
+			return dir
+		}
+	}
+	return name
+}
@@ -0,0 +1,78 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"github.com/miorlan/openapi-bundler/internal/domain"
+	"github.com/miorlan/openapi-bundler/internal/infrastructure/parser"
+	"github.com/miorlan/openapi-bundler/internal/infrastructure/splitter"
+)
+
+// SplitConfig contains splitter configuration
+type SplitConfig struct {
+	MaxFileSize int64
+	// Naming selects how files are named after path items and components (original by default)
+	Naming domain.SplitNaming
+}
+
+// SplitUseCase explodes a single OpenAPI spec into a multi-file tree
+type SplitUseCase struct {
+	fileLoader domain.FileLoader
+	fileWriter domain.FileWriter
+}
+
+// NewSplitUseCase creates a new SplitUseCase
+func NewSplitUseCase(fileLoader domain.FileLoader, fileWriter domain.FileWriter) *SplitUseCase {
+	return &SplitUseCase{
+		fileLoader: fileLoader,
+		fileWriter: fileWriter,
+	}
+}
+
+// Execute writes the root file to outputPath and every path item and component to its
+// own file under paths/ and components/<type>/ next to it. It returns the written files.
+func (uc *SplitUseCase) Execute(ctx context.Context, inputPath, outputPath string, config SplitConfig) ([]string, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	data, err := uc.fileLoader.Load(ctx, inputPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load input file: %w", err)
+	}
+
+	if config.MaxFileSize > 0 && int64(len(data)) > config.MaxFileSize {
+		return nil, fmt.Errorf("file size %d exceeds maximum allowed size %d", len(data), config.MaxFileSize)
+	}
+
+	p := parser.NewParser()
+	root, err := p.ParseFile(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse input file: %w", err)
+	}
+	p.SetOutputFormat(domain.DetectFormat(outputPath))
+
+	files, err := splitter.NewSplitter(config.Naming).Split(root, outputPath, getBasePath(inputPath))
+	if err != nil {
+		return nil, fmt.Errorf("failed to split document: %w", err)
+	}
+
+	outputDir := filepath.Dir(outputPath)
+	written := make([]string, 0, len(files))
+	for _, file := range files {
+		fileData, err := p.MarshalNode(file.Node)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal %s: %w", file.Path, err)
+		}
+
+		path := filepath.Join(outputDir, filepath.FromSlash(file.Path))
+		if err := uc.fileWriter.Write(path, fileData); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", file.Path, err)
+		}
+		written = append(written, path)
+	}
+
+	return written, nil
+}
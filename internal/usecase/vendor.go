@@ -0,0 +1,56 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/miorlan/openapi-bundler/internal/domain"
+	"github.com/miorlan/openapi-bundler/internal/infrastructure/vendored"
+)
+
+// VendorUseCase stores the remote files specs refer to in a local directory
+type VendorUseCase struct {
+	fileLoader domain.FileLoader
+}
+
+// NewVendorUseCase creates a new VendorUseCase
+func NewVendorUseCase(fileLoader domain.FileLoader) *VendorUseCase {
+	return &VendorUseCase{fileLoader: fileLoader}
+}
+
+// Execute resolves every input, with its overlays, the way a bundle would and writes
+// the remote files that were loaded to dir along with a manifest. externalValue
+// example files are always loaded, so the vendor directory serves bundles with and
+// without EmbedExamples. It returns the URLs of the vendored files.
+func (uc *VendorUseCase) Execute(ctx context.Context, inputs []string, dir string, config Config) ([]string, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if len(inputs) == 0 {
+		return nil, fmt.Errorf("no input files to vendor")
+	}
+
+	config.EmbedExamples = true
+	recorder := vendored.NewRecorder(uc.fileLoader)
+	bundle := NewBundleUseCase(recorder, nil, nil)
+	for _, input := range inputs {
+		root, report, err := bundle.resolve(ctx, input, dir, config)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", input, err)
+		}
+		if err := bundle.applyOverlays(ctx, root, report, config.Overlays); err != nil {
+			return nil, fmt.Errorf("%s: %w", input, err)
+		}
+	}
+
+	manifest, err := vendored.Write(dir, recorder.Files())
+	if err != nil {
+		return nil, fmt.Errorf("failed to vendor: %w", err)
+	}
+
+	urls := make([]string, 0, len(manifest.Files))
+	for _, f := range manifest.Files {
+		urls = append(urls, f.URL)
+	}
+	return urls, nil
+}